@@ -172,11 +172,11 @@ func main() {
 	// This is the program we're going to execute
 	//
 	prog := `
- 10 PRINT "HELLO, I AM EMBEDDED BASIC IN YOUR GOLANG!\n"
+ 10 PRINT "HELLO, I AM EMBEDDED BASIC IN YOUR GOLANG!"
  20 LET S = S + PI
  30 POKE 23659 , 0
  40 PEEK 30
- 50 PRINT "\n" "I'M NOW CREATING AN IMAGE!!!!\n"
+ 50 PRINT "\n" "I'M NOW CREATING AN IMAGE!!!!"
  60 REM
  70 REM Draw 100 random pixels
  80 REM
@@ -188,12 +188,12 @@ func main() {
 160 REM
 170 LET R = RND 30
 180 IF R < 2 THEN LET R=2
-190 PRINT "\tWe will draw", R, "random circles upon the image\n"
+190 PRINT "\tWe will draw "; R; " random circles upon the image"
 200 FOR I = 1 TO R
 240  CIRCLE RND 600, RND 400, RND 100
 250 NEXT I
 260 SAVE
-270 PRINT "\tOPEN 'out.png' TO VIEW YOUR IMAGE!\n"
+270 PRINT "\tOPEN 'out.png' TO VIEW YOUR IMAGE!"
 `
 
 	//
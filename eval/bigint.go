@@ -0,0 +1,132 @@
+// bigint.go - Helpers for arbitrary-precision integer arithmetic.
+
+package eval
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/skx/gobasic/object"
+	"github.com/skx/gobasic/token"
+)
+
+// maxExact is the largest integer which a float64 can hold exactly.
+//
+// Integers no larger than this are stored as plain numbers, so only
+// the results which need it become big integers.
+const maxExact = 1 << 53
+
+// bigIntAware lists the builtins which accept big integers as-is,
+// all others receive them converted to plain numbers.
+var bigIntAware = map[string]bool{
+	"STR$": true,
+	"VAL$": true,
+}
+
+// toBigInt returns the value of the given object as a big integer.
+//
+// The second return value is false if the object isn't an integer.
+func toBigInt(obj object.Object) (*big.Int, bool) {
+	switch v := obj.(type) {
+	case *object.BigIntObject:
+		return v.Value, true
+	case *object.NumberObject:
+		if math.IsInf(v.Value, 0) || v.Value != math.Trunc(v.Value) {
+			return nil, false
+		}
+		out, _ := big.NewFloat(v.Value).Int(nil)
+		return out, true
+	}
+	return nil, false
+}
+
+// bigIntResult wraps the given integer in an object, which will be
+// a plain number if it is small enough to be held exactly.
+func bigIntResult(val *big.Int) object.Object {
+	if val.IsInt64() && val.Int64() <= maxExact && val.Int64() >= -maxExact {
+		return &object.NumberObject{Value: float64(val.Int64())}
+	}
+	return &object.BigIntObject{Value: val}
+}
+
+// demoteBigInt converts a big integer to a plain number, losing
+// precision if necessary.  Other objects are returned unchanged.
+func demoteBigInt(obj object.Object) object.Object {
+	if obj.Type() == object.BIGINT {
+		f, _ := new(big.Float).SetInt(obj.(*object.BigIntObject).Value).Float64()
+		return &object.NumberObject{Value: f}
+	}
+	return obj
+}
+
+// bigIntArith applies the given operator to two integers, using
+// arbitrary precision.
+//
+// The second return value is false if either argument isn't an
+// integer, or the result of a division isn't, in which case the
+// caller should fall back to floating-point arithmetic.
+func bigIntArith(op token.Type, a object.Object, b object.Object) (object.Object, bool) {
+
+	x, ok := toBigInt(a)
+	if !ok {
+		return nil, false
+	}
+	y, ok := toBigInt(b)
+	if !ok {
+		return nil, false
+	}
+
+	out := new(big.Int)
+
+	switch op {
+	case token.PLUS:
+		out.Add(x, y)
+	case token.MINUS:
+		out.Sub(x, y)
+	case token.ASTERISK:
+		out.Mul(x, y)
+	case token.SLASH:
+		if y.Sign() == 0 {
+			return object.Error("Division by zero!"), true
+		}
+		rem := new(big.Int)
+		out.QuoRem(x, y, rem)
+		if rem.Sign() != 0 {
+			return nil, false
+		}
+	case token.MOD:
+		if y.Sign() == 0 {
+			return object.Error("Division by zero!"), true
+		}
+		out.Rem(x, y)
+	case token.AND:
+		out.And(x, y)
+	case token.OR:
+		out.Or(x, y)
+	default:
+		return object.Error("Token not handled for two integers: %s", op), true
+	}
+
+	return bigIntResult(out), true
+}
+
+// bigIntCompare applies the given comparison to two big integers.
+func bigIntCompare(op token.Type, x *big.Int, y *big.Int) bool {
+	c := x.Cmp(y)
+
+	switch op {
+	case token.ASSIGN:
+		return c == 0
+	case token.NOT_EQUALS:
+		return c != 0
+	case token.GT:
+		return c > 0
+	case token.GT_EQUALS:
+		return c >= 0
+	case token.LT:
+		return c < 0
+	case token.LT_EQUALS:
+		return c <= 0
+	}
+	return false
+}
@@ -3,6 +3,7 @@
 package eval
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/skx/gobasic/object"
@@ -44,6 +45,8 @@ func NewBuiltins() *Builtins {
 //  nARGS - The number of arguments the built-in requires.
 //          NOTE: Arguments are comma-separated in the BASIC program,
 //          but commas are stripped out.
+//          A negative number means the built-in is variadic, and
+//          will receive as many arguments as were supplied.
 //  FT    - The function which provides the implementation.
 func (b *Builtins) Register(name string, nArgs int, ft BuiltinSig) {
 	b.lock.Lock()
@@ -61,3 +64,26 @@ func (b *Builtins) Get(name string) (int, BuiltinSig) {
 
 	return b.argRegistry[name], b.fnRegistry[name]
 }
+
+// Names returns the names of all the registered built-ins, sorted.
+func (b *Builtins) Names() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var names []string
+	for name := range b.fnRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Arity returns the number of arguments the given built-in requires,
+// and whether it exists.
+func (b *Builtins) Arity(name string) (int, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, ok := b.fnRegistry[name]
+	return b.argRegistry[name], ok
+}
@@ -7,35 +7,120 @@
 package eval
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
-	"math/rand"
+	"math/big"
+	"math/bits"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/skx/gobasic/object"
 )
 
-// init ensures that we've initialized our random-number state
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// dateFormat is the format used for dates, DD/MM/YYYY.
+const dateFormat = "02/01/2006"
+
+// timeFormat is the format used for times, HH:MM:SS.
+const timeFormat = "15:04:05"
+
+// maxRepeat is the longest string of repeated characters which TAB,
+// SPACE$, and STRING$ will build, which stops a program from
+// exhausting our memory.
+const maxRepeat = 65536
+
+// maxFactorial is the largest number whose factorial is calculated in
+// big-integer mode, which stops a program from exhausting our memory.
+const maxFactorial = 10000
+
+// formatClock formats the current time, for DATE$ and TIME$, with the
+// given default layout, or the layout given as the optional argument.
+func formatClock(env Interpreter, name string, layout string, args []object.Object) object.Object {
+
+	if len(args) > 1 {
+		return object.Error("%s: expected zero or one arguments, got %d", name, len(args))
+	}
+	if len(args) == 1 {
+		if args[0].Type() != object.STRING {
+			return object.Error("Wrong type")
+		}
+		layout = args[0].(*object.StringObject).Value
+	}
+
+	return &object.StringObject{Value: env.clock().Format(layout)}
 }
 
-// DUMP just displays the only argument it received.
+// formatWord formats the given integer, for HEX$ and OCT$, as a 32-bit
+// value, such that negative numbers use their two's complement form.
+func formatWord(name string, format string, obj object.Object) object.Object {
+
+	// Get the (float) argument.
+	if obj.Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := obj.(*object.NumberObject).Value
+
+	if i != math.Trunc(i) {
+		return object.Error("%s: %s is not an integer", name, formatNumber(i))
+	}
+	if i < math.MinInt32 || i > math.MaxUint32 {
+		return object.Error("%s: %s is out of range", name, formatNumber(i))
+	}
+
+	return &object.StringObject{Value: fmt.Sprintf(format, uint32(int64(i)))}
+}
+
+// parseDate converts an object to a date, if it is a valid date-string.
+func parseDate(obj object.Object) (time.Time, error) {
+	if obj.Type() != object.STRING {
+		return time.Time{}, fmt.Errorf("Wrong type")
+	}
+	str := obj.(*object.StringObject).Value
+
+	d, err := time.Parse(dateFormat, str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s'", str)
+	}
+	return d, nil
+}
+
+// ansiAttribute returns a builtin which returns the ANSI escape-sequence
+// to enable the given text-attribute.
+//
+// If our output isn't a terminal the builtin returns an empty string,
+// to avoid filling files with escape-sequences.
+func ansiAttribute(code string) BuiltinSig {
+	return func(env Interpreter, args []object.Object) object.Object {
+		if !isTTY(env.output) {
+			return &object.StringObject{Value: ""}
+		}
+		return &object.StringObject{Value: "\033[" + code + "m"}
+	}
+}
+
+// DUMP just displays the only argument it received, upon our output.
 func DUMP(env Interpreter, args []object.Object) object.Object {
 
 	// Get the (float) argument.
 	if args[0].Type() == object.NUMBER {
 		i := args[0].(*object.NumberObject).Value
-		fmt.Printf("NUMBER: %f\n", i)
+		fmt.Fprintf(env.output, "NUMBER: %f\n", i)
 	}
 	if args[0].Type() == object.STRING {
 		s := args[0].(*object.StringObject).Value
-		fmt.Printf("STRING: %s\n", s)
+		fmt.Fprintf(env.output, "STRING: %s\n", s)
 	}
 	if args[0].Type() == object.ERROR {
 		s := args[0].(*object.ErrorObject).Value
-		fmt.Printf("Error: %s\n", s)
+		fmt.Fprintf(env.output, "Error: %s\n", s)
 	}
 
 	// Otherwise return as-is.
@@ -80,6 +165,89 @@ func BIN(env Interpreter, args []object.Object) object.Object {
 
 }
 
+// BITCOUNT returns the number of bits which are set in the given number.
+//
+// Negative numbers are treated as their two's complement bit-pattern,
+// so BITCOUNT -1 is 64.
+func BITCOUNT(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	return &object.NumberObject{Value: float64(bits.OnesCount64(uint64(int64(i))))}
+}
+
+// BSEARCH searches the given numeric array, which must be sorted into
+// ascending order, for the given number.
+//
+// It returns one more than the index of the number, or zero if it isn't
+// found, so `BSEARCH(A, 3)` is 1 if A(0) is 3.
+func BSEARCH(env Interpreter, args []object.Object) object.Object {
+
+	arr, ok := args[0].(*object.ArrayObject)
+	if !ok || args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	val := args[1].(*object.NumberObject).Value
+
+	for _, elem := range arr.Value {
+		if elem.Type() != object.NUMBER {
+			return object.Error("Wrong type")
+		}
+	}
+
+	i := sort.Search(len(arr.Value), func(i int) bool {
+		return arr.Value[i].(*object.NumberObject).Value >= val
+	})
+	if i < len(arr.Value) && arr.Value[i].(*object.NumberObject).Value == val {
+		return &object.NumberObject{Value: float64(i + 1)}
+	}
+	return &object.NumberObject{Value: 0}
+}
+
+// BSEARCHSTR searches the given string array, which must be sorted into
+// ascending order, for the given string.
+//
+// As with BSEARCH it returns one more than the index of the string, or
+// zero if it isn't found.
+func BSEARCHSTR(env Interpreter, args []object.Object) object.Object {
+
+	arr, ok := args[0].(*object.ArrayObject)
+	if !ok || args[1].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	val := args[1].(*object.StringObject).Value
+
+	for _, elem := range arr.Value {
+		if elem.Type() != object.STRING {
+			return object.Error("Wrong type")
+		}
+	}
+
+	i := sort.Search(len(arr.Value), func(i int) bool {
+		return arr.Value[i].(*object.StringObject).Value >= val
+	})
+	if i < len(arr.Value) && arr.Value[i].(*object.StringObject).Value == val {
+		return &object.NumberObject{Value: float64(i + 1)}
+	}
+	return &object.NumberObject{Value: 0}
+}
+
+// CEIL rounds a number up, so `CEIL 2.1` is 3.
+func CEIL(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	return &object.NumberObject{Value: math.Ceil(i)}
+}
+
 // CHR returns the character specified by the given ASCII code.
 func CHR(env Interpreter, args []object.Object) object.Object {
 
@@ -112,7 +280,367 @@ func CODE(env Interpreter, args []object.Object) object.Object {
 
 }
 
-// INT implements INT
+// COMPLEX creates a complex number from its real and imaginary parts.
+func COMPLEX(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) arguments.
+	if args[0].Type() != object.NUMBER ||
+		args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	re := args[0].(*object.NumberObject).Value
+	im := args[1].(*object.NumberObject).Value
+
+	return &object.ComplexObject{Value: complex(re, im)}
+}
+
+// DATE returns the current date, as DD/MM/YYYY, unless a layout is
+// given in the form used by Go's time package, such as "2006-01-02".
+func DATE(env Interpreter, args []object.Object) object.Object {
+	return formatClock(env, "DATE$", dateFormat, args)
+}
+
+// DATEADD adds a number of days, months, or years to a date.
+func DATEADD(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (date) argument.
+	d, err := parseDate(args[0])
+	if err != nil {
+		return object.Error("DATEADD$: %s", err.Error())
+	}
+
+	// Get the (float) argument.
+	if args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	n := int(args[1].(*object.NumberObject).Value)
+
+	// Get the (string) argument.
+	if args[2].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	unit := args[2].(*object.StringObject).Value
+
+	switch strings.ToUpper(unit) {
+	case "DAY":
+		d = d.AddDate(0, 0, n)
+	case "MONTH":
+		d = d.AddDate(0, n, 0)
+	case "YEAR":
+		d = d.AddDate(n, 0, 0)
+	default:
+		return object.Error("DATEADD$: invalid unit '%s'", unit)
+	}
+
+	return &object.StringObject{Value: d.Format(dateFormat)}
+}
+
+// DATEDIFF returns the number of whole days, months, or years which
+// must be added to the first date to reach the second.
+func DATEDIFF(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (date) arguments.
+	d1, err := parseDate(args[0])
+	if err != nil {
+		return object.Error("DATEDIFF: %s", err.Error())
+	}
+	d2, err := parseDate(args[1])
+	if err != nil {
+		return object.Error("DATEDIFF: %s", err.Error())
+	}
+
+	// Get the (string) argument.
+	if args[2].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	unit := args[2].(*object.StringObject).Value
+
+	//
+	// Months are awkward, so count them once and derive
+	// years from the result.
+	//
+	months := (d2.Year()-d1.Year())*12 + int(d2.Month()-d1.Month())
+	if months > 0 && d2.Day() < d1.Day() {
+		months--
+	}
+	if months < 0 && d2.Day() > d1.Day() {
+		months++
+	}
+
+	switch strings.ToUpper(unit) {
+	case "DAY":
+		return &object.NumberObject{Value: math.Round(d2.Sub(d1).Hours() / 24)}
+	case "MONTH":
+		return &object.NumberObject{Value: float64(months)}
+	case "YEAR":
+		return &object.NumberObject{Value: float64(months / 12)}
+	}
+	return object.Error("DATEDIFF: invalid unit '%s'", unit)
+}
+
+// DATEVALID returns 1 if the given string is a valid date, 0 otherwise.
+func DATEVALID(env Interpreter, args []object.Object) object.Object {
+
+	_, err := parseDate(args[0])
+	if err != nil {
+		return &object.NumberObject{Value: 0}
+	}
+	return &object.NumberObject{Value: 1}
+}
+
+// ENVIRON returns the contents of an environment variable.
+//
+// When given a string the value of the named variable is returned,
+// when given a number N the Nth entry of the environment is returned
+// in the form "KEY=VALUE".  Numbers outside the range of the
+// environment result in an empty string, which allows a program to
+// enumerate the environment by counting upwards from 1.
+//
+// The environment may not be read in sandbox mode, as it often holds
+// secrets.
+func ENVIRON(env Interpreter, args []object.Object) object.Object {
+
+	if env.sandbox {
+		return object.Error("ENVIRON$: the environment may not be read in sandbox mode")
+	}
+
+	// Looking up a variable by name?
+	if args[0].Type() == object.STRING {
+		name := args[0].(*object.StringObject).Value
+		return &object.StringObject{Value: os.Getenv(name)}
+	}
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := int(args[0].(*object.NumberObject).Value)
+
+	vars := os.Environ()
+	if i < 1 || i > len(vars) {
+		return &object.StringObject{Value: ""}
+	}
+	return &object.StringObject{Value: vars[i-1]}
+}
+
+// EXEC runs the given command via the shell, and returns its output,
+// without any trailing newline.
+//
+// If the command fails its error-output is included in the error we
+// return.  Commands may not be run in sandbox mode.
+func EXEC(env Interpreter, args []object.Object) object.Object {
+
+	if env.sandbox {
+		return object.Error("EXEC$: commands may not be run in sandbox mode")
+	}
+
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	command := args[0].(*object.StringObject).Value
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return object.Error("EXEC$: %s - %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return &object.StringObject{Value: strings.TrimSuffix(stdout.String(), "\n")}
+}
+
+// FACTORIAL returns the factorial of the given number.
+//
+// In big-integer mode the result is exact, for numbers up to
+// maxFactorial, otherwise large results lose precision.
+func FACTORIAL(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	if i < 0 || i != math.Trunc(i) {
+		return object.Error("FACTORIAL: %s is not a positive integer", formatNumber(i))
+	}
+
+	if env.bigIntMode {
+		if i > maxFactorial {
+			return object.Error("FACTORIAL: %s is too large, the maximum is %d", formatNumber(i), maxFactorial)
+		}
+		return bigIntResult(new(big.Int).MulRange(1, int64(i)))
+	}
+
+	out := 1.0
+	for n := 2.0; n <= i && !math.IsInf(out, 1); n++ {
+		out *= n
+	}
+	return &object.NumberObject{Value: out}
+}
+
+// FIX truncates a number towards zero, so `FIX -2.7` is -2.
+func FIX(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	return &object.NumberObject{Value: math.Trunc(i)}
+}
+
+// GETCH reads a single character from STDIN, blocking until one is
+// available, and returns its ASCII code.
+func GETCH(env Interpreter, args []object.Object) object.Object {
+
+	b, err := env.STDIN.ReadByte()
+	if err != nil {
+		return object.Error("GETCH: %s", err.Error())
+	}
+	return &object.NumberObject{Value: float64(b)}
+}
+
+// HEX converts a number to a hexadecimal string.
+//
+// Negative numbers use their 32-bit two's complement representation,
+// so `HEX$ -1` is "FFFFFFFF".
+func HEX(env Interpreter, args []object.Object) object.Object {
+	return formatWord("HEX$", "%X", args[0])
+}
+
+// IMAG returns the imaginary part of a complex number.
+//
+// Plain numbers have no imaginary part, so return zero.
+func IMAG(env Interpreter, args []object.Object) object.Object {
+
+	c, ok := toComplex(args[0])
+	if !ok {
+		return object.Error("Wrong type")
+	}
+	return &object.NumberObject{Value: imag(c)}
+}
+
+// INKEY returns the key which has been pressed, without waiting for
+// one, or an empty string if there is none.
+//
+// Keys which have already been read into our buffer are returned first,
+// otherwise we poll STDIN if it is a terminal.
+func INKEY(env Interpreter, args []object.Object) object.Object {
+
+	if env.STDIN.Buffered() == 0 {
+		if env.stdinFile == nil || !isTTY(env.stdinFile) {
+			return &object.StringObject{Value: ""}
+		}
+
+		key, err := pollKey(env.stdinFile.Fd())
+		if err != nil {
+			return object.Error("INKEY$: %s", err.Error())
+		}
+		return &object.StringObject{Value: key}
+	}
+
+	b, err := env.STDIN.ReadByte()
+	if err != nil {
+		return object.Error("INKEY$: %s", err.Error())
+	}
+	return &object.StringObject{Value: string(b)}
+}
+
+// INSTR returns the 1-based position of the first occurrence of one
+// string within another, or 0 if it isn't present.
+//
+// Given three arguments the first is the position at which the search
+// begins, for example `INSTR(3, "Steve", "e")` returns 5.
+func INSTR(env Interpreter, args []object.Object) object.Object {
+
+	if len(args) != 2 && len(args) != 3 {
+		return object.Error("INSTR: expected two or three arguments, got %d", len(args))
+	}
+
+	// Get the optional (float) starting position.
+	start := 1.0
+	if len(args) == 3 {
+		if args[0].Type() != object.NUMBER {
+			return object.Error("Wrong type")
+		}
+		n := args[0].(*object.NumberObject).Value
+		if n < 1 || n != math.Trunc(n) {
+			return object.Error("INSTR: invalid starting position %s", formatNumber(n))
+		}
+		start = n
+		args = args[1:]
+	}
+
+	// Get the (string) arguments.
+	if args[0].Type() != object.STRING ||
+		args[1].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	haystack := args[0].(*object.StringObject).Value
+	needle := args[1].(*object.StringObject).Value
+
+	// Compare before converting, as huge positions overflow an int.
+	if start > float64(len(haystack)+1) {
+		return &object.NumberObject{Value: 0}
+	}
+
+	i := strings.Index(haystack[int(start)-1:], needle)
+	if i < 0 {
+		return &object.NumberObject{Value: 0}
+	}
+	return &object.NumberObject{Value: start + float64(i)}
+}
+
+// INSTRALL finds all the occurrences of a substring within a string.
+//
+// As we have no arrays the 1-based positions of the matches are stored
+// in a series of variables named INSTRALL_0, INSTRALL_1, etc, and the
+// number of matches is returned.
+//
+// Matches don't overlap, the search resumes after the end of each
+// match, so "AA" occurs twice in "AAAA", rather than three times.
+func INSTRALL(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	haystack := args[0].(*object.StringObject).Value
+
+	// Get the (string) argument.
+	if args[1].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	needle := args[1].(*object.StringObject).Value
+
+	if needle == "" {
+		return object.Error("INSTRALL: Empty search-string")
+	}
+
+	count := 0
+	offset := 0
+	for {
+		i := strings.Index(haystack[offset:], needle)
+		if i < 0 {
+			break
+		}
+
+		// Positions are 1-based.
+		pos := offset + i + 1
+		env.SetVariable(fmt.Sprintf("INSTRALL_%d", count), &object.NumberObject{Value: float64(pos)})
+
+		count++
+		offset += i + len(needle)
+	}
+
+	return &object.NumberObject{Value: float64(count)}
+}
+
+// INT implements INT, which rounds down, so `INT -2.7` is -3.
 func INT(env Interpreter, args []object.Object) object.Object {
 
 	// Get the (float) argument.
@@ -121,8 +649,7 @@ func INT(env Interpreter, args []object.Object) object.Object {
 	}
 	i := args[0].(*object.NumberObject).Value
 
-	// Truncate.
-	return &object.NumberObject{Value: float64(int(i))}
+	return &object.NumberObject{Value: math.Floor(i)}
 }
 
 // LEFT returns the N left-most characters of the string.
@@ -161,6 +688,54 @@ func LEN(env Interpreter, args []object.Object) object.Object {
 	return &object.NumberObject{Value: float64(len(in))}
 }
 
+// LTRIM removes the leading whitespace from the given string.
+func LTRIM(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	return &object.StringObject{Value: strings.TrimLeft(in, " \t\r\n")}
+}
+
+// LOWER converts the given string to lower-case.
+func LOWER(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	return &object.StringObject{Value: strings.ToLower(in)}
+}
+
+// MAX returns the larger of two numbers.
+func MAX(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) arguments.
+	if args[0].Type() != object.NUMBER ||
+		args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+
+	return &object.NumberObject{Value: math.Max(args[0].(*object.NumberObject).Value, args[1].(*object.NumberObject).Value)}
+}
+
+// MIN returns the smaller of two numbers.
+func MIN(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) arguments.
+	if args[0].Type() != object.NUMBER ||
+		args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+
+	return &object.NumberObject{Value: math.Min(args[0].(*object.NumberObject).Value, args[1].(*object.NumberObject).Value)}
+}
+
 // MID returns the N characters from the given offset
 func MID(env Interpreter, args []object.Object) object.Object {
 
@@ -198,6 +773,129 @@ func MID(env Interpreter, args []object.Object) object.Object {
 	return &object.StringObject{Value: out}
 }
 
+// OCT converts a number to an octal string.
+//
+// Negative numbers use their 32-bit two's complement representation,
+// as with HEX$.
+func OCT(env Interpreter, args []object.Object) object.Object {
+	return formatWord("OCT$", "%o", args[0])
+}
+
+// PRINT formats its arguments as the PRINT statement would, returning
+// the result as a string rather than displaying it.
+//
+// The interpreter handles PRINT$ itself, as it needs to see the
+// separators between the arguments, so this is only used if it's
+// invoked directly, in which case they're separated as if by a comma.
+func PRINT(env Interpreter, args []object.Object) object.Object {
+
+	out := ""
+
+	for i, arg := range args {
+
+		// Arguments are separated as if by a comma, which
+		// advances to the next print-zone.
+		if i > 0 {
+			out += strings.Repeat(" ", printZone-utf8.RuneCountInString(out)%printZone)
+		}
+
+		// 1.  String
+		if arg.Type() == object.STRING {
+			out += arg.(*object.StringObject).Value
+		}
+
+		// 2.  Number
+		if arg.Type() == object.NUMBER {
+			out += formatNumber(arg.(*object.NumberObject).Value)
+		}
+	}
+
+	return &object.StringObject{Value: out}
+}
+
+// REAL returns the real part of a complex number.
+func REAL(env Interpreter, args []object.Object) object.Object {
+
+	c, ok := toComplex(args[0])
+	if !ok {
+		return object.Error("Wrong type")
+	}
+	return &object.NumberObject{Value: real(c)}
+}
+
+// PLOT sets a single point to the given colour, via the handler
+// registered with SetGraphicsMode.
+func PLOT(env Interpreter, args []object.Object) object.Object {
+	if !env.graphicsMode {
+		return object.Error("PLOT: not in graphics mode")
+	}
+
+	var n []int
+	for _, arg := range args {
+		if arg.Type() != object.NUMBER {
+			return object.Error("Wrong type")
+		}
+		n = append(n, int(arg.(*object.NumberObject).Value))
+	}
+
+	env.graphics.Plot(n[0], n[1], n[2])
+	return &object.NumberObject{Value: 0}
+}
+
+// PROFILE returns the number of times each line of the program has
+// been executed, as a string of "LINE:COUNT" entries, one per line.
+func PROFILE(env Interpreter, args []object.Object) object.Object {
+
+	profile := env.LineProfile()
+
+	// Sort the lines into numerical order.
+	var lines []string
+	for line := range profile {
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(lines[i], 64)
+		b, _ := strconv.ParseFloat(lines[j], 64)
+		return a < b
+	})
+
+	out := ""
+	for _, line := range lines {
+		out += fmt.Sprintf("%s:%d\n", line, profile[line])
+	}
+	return &object.StringObject{Value: out}
+}
+
+// PROFILECLEAR discards the execution-counts returned by PROFILE.
+func PROFILECLEAR(env Interpreter, args []object.Object) object.Object {
+	env.ResetProfile()
+	return &object.NumberObject{Value: 0}
+}
+
+// PROGRAM returns the source of the program which is running.
+//
+// With no arguments the whole program is returned, otherwise two
+// arguments give the first and last line-numbers to return.
+func PROGRAM(env Interpreter, args []object.Object) object.Object {
+
+	if len(args) == 0 {
+		return &object.StringObject{Value: env.listing(math.Inf(-1), math.Inf(1))}
+	}
+	if len(args) != 2 {
+		return object.Error("PROGRAM$: expected zero or two arguments, got %d", len(args))
+	}
+
+	// Get the (float) arguments.
+	if args[0].Type() != object.NUMBER ||
+		args[1].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	from := args[0].(*object.NumberObject).Value
+	to := args[1].(*object.NumberObject).Value
+
+	return &object.StringObject{Value: env.listing(from, to)}
+}
+
 // RIGHT returns the N right-most characters of the string.
 func RIGHT(env Interpreter, args []object.Object) object.Object {
 
@@ -236,7 +934,51 @@ func RND(env Interpreter, args []object.Object) object.Object {
 	}
 
 	// Return the random number
-	return &object.NumberObject{Value: float64(rand.Intn(int(i)))}
+	return &object.NumberObject{Value: float64(env.rng.Intn(int(i)))}
+}
+
+// ROUND rounds a number to the nearest integer, with halves rounded
+// away from zero.
+//
+// Given a second argument the number is rounded to that many decimal
+// places, for example `ROUND(2.45, 1)` returns 2.5, while a negative
+// count rounds to tens, hundreds, etc.
+func ROUND(env Interpreter, args []object.Object) object.Object {
+
+	if len(args) != 1 && len(args) != 2 {
+		return object.Error("ROUND: expected one or two arguments, got %d", len(args))
+	}
+
+	// Get the (float) arguments.
+	for _, arg := range args {
+		if arg.Type() != object.NUMBER {
+			return object.Error("Wrong type")
+		}
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	if len(args) == 1 {
+		return &object.NumberObject{Value: math.Round(i)}
+	}
+
+	n := args[1].(*object.NumberObject).Value
+	if n != math.Trunc(n) {
+		return object.Error("ROUND: %s is not an integer", formatNumber(n))
+	}
+	scale := math.Pow10(int(n))
+	return &object.NumberObject{Value: math.Round(i*scale) / scale}
+}
+
+// RTRIM removes the trailing whitespace from the given string.
+func RTRIM(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	return &object.StringObject{Value: strings.TrimRight(in, " \t\r\n")}
 }
 
 // SGN is the sign function (sometimes called signum).
@@ -258,18 +1000,250 @@ func SGN(env Interpreter, args []object.Object) object.Object {
 
 }
 
+// SPACE returns a string of the given number of spaces.
+func SPACE(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	n := args[0].(*object.NumberObject).Value
+
+	if n < 0 {
+		return object.Error("SPACE$: negative argument")
+	}
+	if n > maxRepeat {
+		return object.Error("SPACE$: %s is too large", formatNumber(n))
+	}
+	return &object.StringObject{Value: strings.Repeat(" ", int(n))}
+}
+
+// SPLIT splits a string by the given delimiter.
+//
+// As we have no arrays the pieces are stored in a series of variables
+// named SPLIT_0$, SPLIT_1$, etc, and the number of pieces is returned.
+func SPLIT(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	// Get the (string) argument.
+	if args[1].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	delim := args[1].(*object.StringObject).Value
+
+	pieces := strings.Split(in, delim)
+	for i, piece := range pieces {
+		env.SetVariable(fmt.Sprintf("SPLIT_%d$", i), &object.StringObject{Value: piece})
+	}
+
+	return &object.NumberObject{Value: float64(len(pieces))}
+}
+
 // SQR implements square root.
+//
+// In complex mode the square root of a negative number is a complex
+// number, rather than NaN.
 func SQR(env Interpreter, args []object.Object) object.Object {
 
+	// Complex argument?
+	if args[0].Type() == object.COMPLEX {
+		c := args[0].(*object.ComplexObject).Value
+		return &object.ComplexObject{Value: cmplx.Sqrt(c)}
+	}
+
 	// Get the (float) argument.
 	if args[0].Type() != object.NUMBER {
 		return object.Error("Wrong type")
 	}
 	i := args[0].(*object.NumberObject).Value
 
+	if i < 0 && env.complexMode {
+		return &object.ComplexObject{Value: cmplx.Sqrt(complex(i, 0))}
+	}
+
 	return &object.NumberObject{Value: math.Sqrt(i)}
 }
 
+// STACKDEPTH returns the depth of the GOSUB stack.
+func STACKDEPTH(env Interpreter, args []object.Object) object.Object {
+	return &object.NumberObject{Value: float64(env.gstack.Len())}
+}
+
+// STACKFRAME returns the line-number of the GOSUB statement at the
+// given depth of the GOSUB stack, where 1 is the most recent.
+func STACKFRAME(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	offset, err := env.gstack.Peek(int(i))
+	if err != nil {
+		return object.Error("STACKFRAME$: %s", err.Error())
+	}
+	return &object.StringObject{Value: env.lineAt(offset)}
+}
+
+// STRING returns a string of the given length, made by repeating the
+// character given as a number, as CHR$ would convert it, or as the
+// first character of a string.
+func STRING(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) length.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	n := args[0].(*object.NumberObject).Value
+	if n < 0 {
+		return object.Error("STRING$: negative argument")
+	}
+	if n > maxRepeat {
+		return object.Error("STRING$: %s is too large", formatNumber(n))
+	}
+
+	// Get the character.
+	var r rune
+	switch c := args[1].(type) {
+	case *object.NumberObject:
+		if c.Value < 0 || c.Value > 255 {
+			return object.Error("STRING$: character code %s out of range", formatNumber(c.Value))
+		}
+		r = rune(c.Value)
+	case *object.StringObject:
+		if c.Value == "" {
+			return object.Error("STRING$: empty string")
+		}
+		r = []rune(c.Value)[0]
+	default:
+		return object.Error("Wrong type")
+	}
+
+	return &object.StringObject{Value: strings.Repeat(string(r), int(n))}
+}
+
+// STRERR returns the description of the given operating-system
+// error-code, for example "permission denied".
+func STRERR(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	if i < 0 {
+		return object.Error("STRERR$: invalid error-code %s", formatNumber(i))
+	}
+	return &object.StringObject{Value: syscall.Errno(i).Error()}
+}
+
+// SYS returns details of the internal state of the interpreter.
+//
+// The argument selects what is returned:
+//
+//  0 - The current line-number.
+//  1 - The depth of the GOSUB stack.
+//  2 - The number of variables which have been set.
+//  3 - The number of open FOR loops.
+func SYS(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	switch i {
+	case 0:
+		line, err := strconv.ParseFloat(env.lineno, 64)
+		if err != nil {
+			return object.Error("SYS: invalid line-number '%s'", env.lineno)
+		}
+		return &object.NumberObject{Value: line}
+	case 1:
+		return &object.NumberObject{Value: float64(env.gstack.Len())}
+	case 2:
+		return &object.NumberObject{Value: float64(env.vars.Count())}
+	case 3:
+		return &object.NumberObject{Value: float64(env.loops.Len())}
+	}
+	return object.Error("SYS: invalid argument %s", formatNumber(i))
+}
+
+// TAB returns the spaces required to move the cursor to the given
+// column, for use in PRINT statements such as `PRINT TAB(20); "X"`.
+//
+// If the cursor is already beyond the column an empty string is
+// returned.
+func TAB(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	n := args[0].(*object.NumberObject).Value
+
+	if n < 1 || n > maxRepeat {
+		return object.Error("TAB: invalid column %s", formatNumber(n))
+	}
+
+	count := int(n) - env.printColumn
+	if count < 0 {
+		count = 0
+	}
+	return &object.StringObject{Value: strings.Repeat(" ", count)}
+}
+
+// outputSize returns the width and height of the terminal which the
+// given output is written to, or 80 columns by 24 lines if it isn't a
+// terminal.
+func outputSize(w io.Writer) (int, int) {
+	f, ok := w.(*os.File)
+	if !ok || !isTTY(f) {
+		return 80, 24
+	}
+	width, height, err := termSize(f.Fd())
+	if err != nil || width < 1 || height < 1 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// TERMHEIGHT returns the height of the terminal, in lines.
+//
+// If our output is not a terminal we default to 24 lines.
+func TERMHEIGHT(env Interpreter, args []object.Object) object.Object {
+	_, height := outputSize(env.output)
+	return &object.NumberObject{Value: float64(height)}
+}
+
+// TERMWIDTH returns the width of the terminal, in columns.
+//
+// If our output is not a terminal we default to 80 columns.
+func TERMWIDTH(env Interpreter, args []object.Object) object.Object {
+	width, _ := outputSize(env.output)
+	return &object.NumberObject{Value: float64(width)}
+}
+
+// TIMER returns the number of seconds which have elapsed since the
+// interpreter was created.
+func TIMER(env Interpreter, args []object.Object) object.Object {
+	return &object.NumberObject{Value: env.clock().Sub(env.startTime).Seconds()}
+}
+
+// TIME returns the current time, as HH:MM:SS, unless a layout is given
+// in the form used by Go's time package, such as "15:04".
+func TIME(env Interpreter, args []object.Object) object.Object {
+	return formatClock(env, "TIME$", timeFormat, args)
+}
+
 // TL returns a string, minus the first character.
 func TL(env Interpreter, args []object.Object) object.Object {
 
@@ -375,6 +1349,25 @@ func EXP(env Interpreter, args []object.Object) object.Object {
 	return &object.NumberObject{Value: math.Exp(i)}
 }
 
+// LINE draws a line between two points, in the given colour, via
+// the handler registered with SetGraphicsMode.
+func LINE(env Interpreter, args []object.Object) object.Object {
+	if !env.graphicsMode {
+		return object.Error("LINE: not in graphics mode")
+	}
+
+	var n []int
+	for _, arg := range args {
+		if arg.Type() != object.NUMBER {
+			return object.Error("Wrong type")
+		}
+		n = append(n, int(arg.(*object.NumberObject).Value))
+	}
+
+	env.graphics.Line(n[0], n[1], n[2], n[3], n[4])
+	return &object.NumberObject{Value: 0}
+}
+
 // LN calculates logarithms to the base e - LN
 func LN(env Interpreter, args []object.Object) object.Object {
 
@@ -387,6 +1380,56 @@ func LN(env Interpreter, args []object.Object) object.Object {
 	return &object.NumberObject{Value: math.Log(i)}
 }
 
+// CLOG calculates logarithms to the base 10.
+func CLOG(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	if i <= 0 {
+		return object.Error("CLOG: %s is not positive", formatNumber(i))
+	}
+	return &object.NumberObject{Value: math.Log10(i)}
+}
+
+// LNUM returns the line-number which is currently executing.
+//
+// If the line-number isn't numeric then zero is returned.
+func LNUM(env Interpreter, args []object.Object) object.Object {
+	line, err := strconv.ParseFloat(env.lineno, 64)
+	if err != nil {
+		return &object.NumberObject{Value: 0}
+	}
+	return &object.NumberObject{Value: line}
+}
+
+// TRIM removes the leading and trailing whitespace from the given string.
+func TRIM(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	return &object.StringObject{Value: strings.TrimSpace(in)}
+}
+
+// UPPER converts the given string to upper-case.
+func UPPER(env Interpreter, args []object.Object) object.Object {
+
+	// Get the (string) argument.
+	if args[0].Type() != object.STRING {
+		return object.Error("Wrong type")
+	}
+	in := args[0].(*object.StringObject).Value
+
+	return &object.StringObject{Value: strings.ToUpper(in)}
+}
+
 // VAL converts a string to a number
 func VAL(env Interpreter, args []object.Object) object.Object {
 
@@ -402,6 +1445,14 @@ func VAL(env Interpreter, args []object.Object) object.Object {
 
 	// Get the value
 	s := args[0].(*object.StringObject).Value
+
+	// Large integers can be held exactly in big-integer mode.
+	if env.bigIntMode {
+		if b, ok := new(big.Int).SetString(s, 10); ok {
+			return bigIntResult(b)
+		}
+	}
+
 	b, err := strconv.ParseFloat(s, 64)
 	if err != nil {
 		return object.Error("VAL: %s", err.Error())
@@ -410,6 +1461,24 @@ func VAL(env Interpreter, args []object.Object) object.Object {
 	return &object.NumberObject{Value: float64(b)}
 }
 
+// VALSTR implements VAL$, the inverse of VAL, which converts a number
+// to a string - formatted exactly as PRINT would display it.
+func VALSTR(env Interpreter, args []object.Object) object.Object {
+
+	// Big integer?
+	if args[0].Type() == object.BIGINT {
+		return &object.StringObject{Value: args[0].(*object.BigIntObject).Value.String()}
+	}
+
+	// Get the (float) argument.
+	if args[0].Type() != object.NUMBER {
+		return object.Error("Wrong type")
+	}
+	i := args[0].(*object.NumberObject).Value
+
+	return &object.StringObject{Value: formatNumber(i)}
+}
+
 // STR converts a number to a string
 func STR(env Interpreter, args []object.Object) object.Object {
 
@@ -423,15 +1492,19 @@ func STR(env Interpreter, args []object.Object) object.Object {
 		return args[0]
 	}
 
-	// Get the value
-	var i float64
-	i = args[0].(*object.NumberObject).Value
-	s := ""
+	// Complex?
+	if args[0].Type() == object.COMPLEX {
+		c := args[0].(*object.ComplexObject).Value
+		return &object.StringObject{Value: formatComplex(c)}
+	}
 
-	if i == float64(int(i)) {
-		s = fmt.Sprintf("%d", int(i))
-	} else {
-		s = fmt.Sprintf("%f", i)
+	// Big integer?
+	if args[0].Type() == object.BIGINT {
+		return &object.StringObject{Value: args[0].(*object.BigIntObject).Value.String()}
 	}
-	return &object.StringObject{Value: s}
+
+	// Get the value
+	i := args[0].(*object.NumberObject).Value
+
+	return &object.StringObject{Value: formatNumber(i)}
 }
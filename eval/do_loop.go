@@ -0,0 +1,88 @@
+// do_loop.go - Handles the state required for do-loops
+//
+// A do-loop may be tested at the top, at the bottom, or neither:
+//
+//    DO WHILE condition     DO                    DO
+//      ..                     ..                    ..
+//    LOOP                   LOOP UNTIL condition  LOOP
+//
+// Open loops are held upon a stack, so they may be nested.
+//
+
+package eval
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/skx/gobasic/token"
+)
+
+// DoLoop is the structure used to record a do-loop
+type DoLoop struct {
+	// condType is the type of the condition following the DO,
+	// token.WHILE or token.UNTIL, or empty if there is none.
+	condType token.Type
+
+	// condOffset is the offset of the DO statement, which evaluates
+	// any condition.
+	condOffset int
+
+	// bodyOffset is the offset of the end of the DO statement,
+	// from which the body of the loop follows.
+	bodyOffset int
+}
+
+// DoLoops is the stack which holds open DoLoop entries
+type DoLoops struct {
+	// lock ensures we're thread-safe (ha!)
+	lock sync.Mutex
+
+	// data stores our data
+	data []DoLoop
+}
+
+// NewDoLoops creates a new do-loop holder
+func NewDoLoops() *DoLoops {
+	return &DoLoops{lock: sync.Mutex{}, data: make([]DoLoop, 0)}
+}
+
+// Push adds a new do-loop to our stack.
+func (d *DoLoops) Push(x DoLoop) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.data = append(d.data, x)
+}
+
+// Pop removes the innermost do-loop from our stack, and returns it.
+func (d *DoLoops) Pop() (DoLoop, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.data) == 0 {
+		return DoLoop{}, errors.New("Pop from an empty stack")
+	}
+	x := d.data[len(d.data)-1]
+	d.data = d.data[:len(d.data)-1]
+	return x, nil
+}
+
+// Peek returns the innermost do-loop, without removing it.
+func (d *DoLoops) Peek() (DoLoop, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.data) == 0 {
+		return DoLoop{}, errors.New("Peek at an empty stack")
+	}
+	return d.data[len(d.data)-1], nil
+}
+
+// Empty returns true if we have no open DO loops.
+func (d *DoLoops) Empty() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return (len(d.data) == 0)
+}
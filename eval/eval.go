@@ -12,10 +12,19 @@ package eval
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/skx/gobasic/object"
 	"github.com/skx/gobasic/token"
@@ -56,12 +65,104 @@ type Interpreter struct {
 	// loops holds references to open FOR-loops
 	loops *Loops
 
-	// STDIN is an input-reader used for the INPUT statement
+	// whiles holds references to open WHILE-loops
+	whiles *WhileLoops
+
+	// repeats holds the offsets of the REPEAT statements of open
+	// REPEAT-loops.
+	repeats *Stack
+
+	// doStack holds the open DO-loops.
+	doStack *DoLoops
+
+	// STDIN is an input-reader used for the INPUT statement,
+	// and the GETCH function.
 	STDIN *bufio.Reader
 
+	// stdinFile is the file STDIN reads from, if it is one, which
+	// INKEY$ polls for keypresses.
+	stdinFile *os.File
+
+	// output is the writer to which PRINT sends its output.
+	output io.Writer
+
+	// fileHandles holds the files opened by OPEN, keyed by their
+	// channel-number.
+	fileHandles map[int]*os.File
+
+	// fileReaders holds a buffered reader for each file which was
+	// opened for INPUT, keyed by channel-number.
+	fileReaders map[int]*bufio.Reader
+
+	// fieldDefs holds the layout of the records of each file which
+	// was opened for RANDOM access, set by FIELD, keyed by
+	// channel-number.
+	fieldDefs map[int][]FieldDef
+
+	// printColumn is the column the output cursor is in, which is
+	// used to align items separated by commas in PRINT.
+	printColumn int
+
+	// printBuffer collects the output of a PRINT statement, when
+	// set, so that it is only shown once the statement has been
+	// found to be valid.
+	printBuffer *strings.Builder
+
+	// graphics receives drawing-commands, and our output, while
+	// we're in graphics mode.
+	graphics GraphicsHandler
+
+	// graphicsMode is true if we're in graphics mode, which is
+	// set by the `GRAPHICS` statement and cleared by `TEXT`.
+	graphicsMode bool
+
+	// shared is true if our program is shared with other
+	// interpreters, and must be copied before it is modified.
+	shared bool
+
 	// Hack: Was the previous statement a GOTO/GOSUB?
 	jump bool
 
+	// errorHandlerLine is the line set by ON ERROR GOTO, to which
+	// we jump when a runtime error occurs.
+	errorHandlerLine string
+
+	// inErrorHandler is true once we've jumped to the error-handler,
+	// so that errors within it terminate the program rather than
+	// recursing.
+	inErrorHandler bool
+
+	// errorVarName is the variable set by ON ERROR SET, which receives
+	// the error-message instead of ERR$ and ERL.
+	errorVarName string
+
+	// errorOriginOffset is the offset of the statement which caused
+	// the error passed to the error-handler, for RESUME.
+	errorOriginOffset int
+
+	// data holds the values of all the DATA statements in the
+	// program, in order, which READ consumes.
+	data []object.Object
+
+	// dataOffset is the index of the next value READ will return.
+	dataOffset int
+
+	// dataLines is the index within data of the first value at, or
+	// after, each line, which allows RESTORE to move to a line.
+	dataLines map[string]int
+
+	// namedData is the index within data of the first value of each
+	// named DATA table, which allows RESTORE to move to a table.
+	namedData map[string]int
+
+	// allowSlice is set while LET evaluates its value, which may be
+	// a slice of an array, such as `A(2 TO 5)`.
+	allowSlice bool
+
+	// profile records the number of times each line has been
+	// executed, keyed by line-number.
+	profile map[string]int
+
 	// lines is a lookup table - the key is the line-number of
 	// the source program, and the value is the offset in our
 	// program-array that this is located at.
@@ -70,16 +171,197 @@ type Interpreter struct {
 	// functions holds builtin-functions
 	functions *Builtins
 
+	// rng is the source of the random numbers returned by RND, which
+	// may be seeded via RANDOMIZE.
+	rng *rand.Rand
+
+	// clock returns the current time, for DATE$ and TIME$.
+	clock func() time.Time
+
+	// startTime is the time we were created, from which TIMER
+	// counts.
+	startTime time.Time
+
 	// trace is true if the user is tracing execution
 	trace bool
+
+	// maxIterations is the number of statements Run may execute
+	// before giving up, or zero if there is no limit.
+	maxIterations int64
+
+	// sandbox is true if the program may not run external
+	// commands, or access files.
+	sandbox bool
+
+	// stopCallback is invoked by the STOP statement, if set.
+	stopCallback StopCallback
+
+	// stepCallback is invoked before each statement, if set.
+	stepCallback StepCallback
+
+	// callTable holds the golang functions which may be invoked
+	// via the CALL statement, keyed by name.
+	callTable map[string]CallSig
+
+	// userFunctions holds the functions defined by DEF FN, keyed
+	// by name.
+	userFunctions map[string]UserFunc
+
+	// fnDepth is the number of calls to user-defined functions which
+	// are in progress.
+	fnDepth int
+
+	// complexMode is true if SQR should return a complex number,
+	// rather than NaN, when given a negative value.
+	complexMode bool
+
+	// bigIntMode is true if integer arithmetic should be carried
+	// out with arbitrary precision.
+	bigIntMode bool
+}
+
+// printZone is the width of the print-zones which items separated
+// by commas in PRINT statements are aligned to.
+const printZone = 14
+
+// maxChannel is the highest channel-number which may be used with OPEN.
+const maxChannel = 9
+
+// maxSleep is the longest, in seconds, that SLEEP may pause for, and
+// maxSandboxSleep is the longest in sandbox mode, so that an untrusted
+// program can't hold on to its caller.
+const (
+	maxSleep        = 3600
+	maxSandboxSleep = 5
+)
+
+// maxFunctionDepth is the deepest that calls to user-defined functions
+// may be nested, which stops a function which calls itself from
+// exhausting the stack.
+const maxFunctionDepth = 100
+
+// RuntimeError is an error which occurred while running a program.
+type RuntimeError struct {
+
+	// Line is the line-number upon which the error occurred.
+	Line string
+
+	// Message describes the error.
+	Message string
+}
+
+// Error returns the description of the error, including the line
+// upon which it occurred.
+func (r *RuntimeError) Error() string {
+	return fmt.Sprintf("Line %s : %s", r.Line, r.Message)
+}
+
+// FieldDef is a single field of the records of a file opened for
+// RANDOM access, via `FIELD #1, 20 AS NAME$`.
+type FieldDef struct {
+
+	// width is the number of bytes the field occupies.
+	width int
+
+	// name is the name of the string variable which holds the
+	// field's contents.
+	name string
+}
+
+// UserFunc is a single-line function defined by the program, via
+// `DEF FN NAME(PARAM) = EXPR`.
+type UserFunc struct {
+
+	// param is the name of the function's parameter.
+	param string
+
+	// body holds the tokens of the expression which is the
+	// function's result.
+	body []token.Token
 }
 
+// CallSig is the signature of a function which may be invoked by
+// the CALL statement.
+//
+// The function receives the interpreter, along with the arguments
+// which followed the name of the function in the CALL statement.
+type CallSig func(env *Interpreter, args []object.Object) object.Object
+
+// StopCallback is the signature of a function which is invoked by the
+// STOP statement.
+//
+// The function receives the line-number upon which STOP was executed,
+// along with a copy of all the variables, and execution continues once
+// it returns.
+type StopCallback func(lineno string, vars map[string]object.Object)
+
+// StepCallback is the signature of a function which is invoked before
+// each statement is executed, for example to implement a debugger.
+//
+// The function receives the current line-number, and the token which
+// begins the statement.
+type StepCallback func(lineno string, tok token.Token)
+
 // New is our constructor.
 //
 // Given a lexer we store all the tokens it produced in our array, and
 // initialise some other state.
 func New(stream *tokenizer.Tokenizer) *Interpreter {
-	t := &Interpreter{offset: 0}
+
+	prog, dupes := newProgram(stream)
+	for _, line := range dupes {
+		fmt.Printf("WARN: Line %s is duplicated - GOTO/GOSUB behaviour is undefined\n", line)
+	}
+	return newInterpreter(prog, false)
+}
+
+// NewFromProgram creates an interpreter which will run the given
+// program, which has been parsed by CompileProgram.
+//
+// The program is shared, rather than copied, so many interpreters
+// may run the same program without the cost of parsing and storing
+// it for each.  The state of each interpreter, such as variables,
+// is independent.
+func NewFromProgram(prog *Program) *Interpreter {
+	return newInterpreter(prog, true)
+}
+
+// NewFromString is a convenience constructor, which tokenizes the
+// given source and creates an interpreter to run it.
+//
+// An error is returned if the source contains no statements, or if a
+// line-number is duplicated.
+func NewFromString(src string) (*Interpreter, error) {
+
+	prog, dupes := newProgram(tokenizer.New(src))
+	if len(dupes) > 0 {
+		return nil, fmt.Errorf("Line %s is duplicated", dupes[0])
+	}
+	for _, tok := range prog.tokens {
+		if tok.Type != token.NEWLINE {
+			return newInterpreter(prog, false), nil
+		}
+	}
+	return nil, fmt.Errorf("The program is empty")
+}
+
+// NewFromFile is a convenience constructor, which reads the BASIC
+// program in the given file and creates an interpreter to run it.
+func NewFromFile(path string) (*Interpreter, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromString(string(data))
+}
+
+// newInterpreter creates an interpreter which will run the given
+// program, and registers our builtins.
+//
+// If the program is shared it will be copied before it is modified.
+func newInterpreter(prog *Program, shared bool) *Interpreter {
+	t := &Interpreter{offset: 0, shared: shared}
 
 	// setup a stack for holding line-numbers for GOSUB/RETURN
 	t.gstack = NewStack()
@@ -89,53 +371,58 @@ func New(stream *tokenizer.Tokenizer) *Interpreter {
 
 	// setup storage for for-loops
 	t.loops = NewLoops()
+	t.whiles = NewWhileLoops()
+	t.repeats = NewStack()
+	t.doStack = NewDoLoops()
 
 	// Built-in functions are stored here.
 	t.functions = NewBuiltins()
 
+	// Random numbers differ upon each run, unless seeded.
+	t.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	t.clock = time.Now
+	t.startTime = time.Now()
+
+	// Predefined colours are available as read-only variables.
+	for i, name := range []string{"BLACK", "RED", "GREEN", "YELLOW",
+		"BLUE", "MAGENTA", "CYAN", "WHITE"} {
+		t.vars.SetConstant(name, &object.NumberObject{Value: float64(i)})
+	}
+
 	// allow reading from STDIN
 	t.STDIN = bufio.NewReader(os.Stdin)
+	t.stdinFile = os.Stdin
+
+	// send output to STDOUT
+	t.output = os.Stdout
 
 	//
-	// Setup a map to hold our jump-targets
+	// Setup maps to hold the files opened by the program.
 	//
-	t.lines = make(map[string]int)
+	t.fileHandles = make(map[int]*os.File)
+	t.fileReaders = make(map[int]*bufio.Reader)
+	t.fieldDefs = make(map[int][]FieldDef)
 
 	//
-	// Save the tokens that our program consists of, one by one,
-	// until we hit the end.
+	// Setup a map to hold the functions available to CALL.
 	//
-	// We also record the offset at which each line starts, which
-	// means that the GOTO & GOSUB statements don't need to scan
-	// the program from start to finish to find the destination
-	// to jump to.
-	//
-	offset := 0
-	for {
-		tok := stream.NextToken()
-		if tok.Type == token.EOF {
-			break
-		}
-
-		// Did we find a line-number?
-		if tok.Type == token.LINENO {
+	t.callTable = make(map[string]CallSig)
 
-			// Save the offset in the map
-			line := tok.Literal
-
-			// Already an offset?  That means we
-			// have duplicate line-numbers
-			if t.lines[line] != 0 {
-				fmt.Printf("WARN: Line %s is duplicated - GOTO/GOSUB behaviour is undefined\n", line)
-			}
-			t.lines[line] = offset
-		}
+	//
+	// Setup a map to hold the functions defined by the program.
+	//
+	t.userFunctions = make(map[string]UserFunc)
 
-		// Regardless append the token to our array
-		t.program = append(t.program, tok)
+	//
+	// Setup a map to hold our execution-counts.
+	//
+	t.profile = make(map[string]int)
 
-		offset++
-	}
+	//
+	// The program, and the offsets at which each line begins.
+	//
+	t.program = prog.tokens
+	t.lines = prog.lines
 
 	//
 	// Add in our builtins.
@@ -150,30 +437,101 @@ func New(stream *tokenizer.Tokenizer) *Interpreter {
 	t.RegisterBuiltin("ASN", 1, ASN)
 	t.RegisterBuiltin("ATN", 1, ATN)
 	t.RegisterBuiltin("BIN", 1, BIN)
+	t.RegisterBuiltin("BITCOUNT", 1, BITCOUNT)
+	t.RegisterBuiltin("BSEARCH", 2, BSEARCH)
+	t.RegisterBuiltin("CEIL", 1, CEIL)
+	t.RegisterBuiltin("CLOG", 1, CLOG)
 	t.RegisterBuiltin("COS", 1, COS)
 	t.RegisterBuiltin("EXP", 1, EXP)
+	t.RegisterBuiltin("FACTORIAL", 1, FACTORIAL)
+	t.RegisterBuiltin("FIX", 1, FIX)
+	t.RegisterBuiltin("GETCH", 0, GETCH)
 	t.RegisterBuiltin("INT", 1, INT)
 	t.RegisterBuiltin("LN", 1, LN)
+	t.RegisterBuiltin("LNUM", 0, LNUM)
+	t.RegisterBuiltin("LOG10", 1, CLOG)
+	t.RegisterBuiltin("MAX", 2, MAX)
+	t.RegisterBuiltin("MIN", 2, MIN)
 	t.RegisterBuiltin("PI", 0, PI)
+	t.RegisterBuiltin("PROFILE", 0, PROFILE)
+	t.RegisterBuiltin("PROFILECLEAR", 0, PROFILECLEAR)
 	t.RegisterBuiltin("RND", 1, RND)
+	t.RegisterBuiltin("ROUND", -1, ROUND)
 	t.RegisterBuiltin("SGN", 1, SGN)
 	t.RegisterBuiltin("SIN", 1, SIN)
 	t.RegisterBuiltin("SQR", 1, SQR)
+	t.RegisterBuiltin("STACKDEPTH", 0, STACKDEPTH)
+	t.RegisterBuiltin("SYS", 1, SYS)
 	t.RegisterBuiltin("TAN", 1, TAN)
+	t.RegisterBuiltin("TERMHEIGHT", 0, TERMHEIGHT)
+	t.RegisterBuiltin("TERMWIDTH", 0, TERMWIDTH)
+	t.RegisterBuiltin("TIMER", 0, TIMER)
 	t.RegisterBuiltin("VAL", 1, VAL)
 
 	// Primitives that operate upon strings
+	t.RegisterBuiltin("BSEARCHSTR$", 2, BSEARCHSTR)
 	t.RegisterBuiltin("CHR$", 1, CHR)
 	t.RegisterBuiltin("CODE", 1, CODE)
+	t.RegisterBuiltin("DATE$", -1, DATE)
+	t.RegisterBuiltin("ENVIRON$", 1, ENVIRON)
+	t.RegisterBuiltin("EXEC$", 1, EXEC)
+	t.RegisterBuiltin("HEX$", 1, HEX)
+	t.RegisterBuiltin("INKEY$", 0, INKEY)
+	t.RegisterBuiltin("INSTR", -1, INSTR)
+	t.RegisterBuiltin("INSTRALL", 2, INSTRALL)
 	t.RegisterBuiltin("LEFT$", 2, LEFT)
 	t.RegisterBuiltin("LEN", 1, LEN)
+	t.RegisterBuiltin("LOWER$", 1, LOWER)
+	t.RegisterBuiltin("LTRIM$", 1, LTRIM)
 	t.RegisterBuiltin("MID$", 3, MID)
+	t.RegisterBuiltin("OCT$", 1, OCT)
+	t.RegisterBuiltin("PRINT$", -1, PRINT)
+	t.RegisterBuiltin("PROGRAM$", -1, PROGRAM)
 	t.RegisterBuiltin("RIGHT$", 2, RIGHT)
+	t.RegisterBuiltin("RTRIM$", 1, RTRIM)
+	t.RegisterBuiltin("SPACE$", 1, SPACE)
+	t.RegisterBuiltin("SPLIT$", 2, SPLIT)
+	t.RegisterBuiltin("STACKFRAME$", 1, STACKFRAME)
+	t.RegisterBuiltin("TAB", 1, TAB)
+	t.RegisterBuiltin("TIME$", -1, TIME)
 	t.RegisterBuiltin("TL$", 1, TL)
 	t.RegisterBuiltin("STR$", 1, STR)
+	t.RegisterBuiltin("STRERR$", 1, STRERR)
+	t.RegisterBuiltin("STRING$", 2, STRING)
+	t.RegisterBuiltin("TRIM$", 1, TRIM)
+	t.RegisterBuiltin("UPPER$", 1, UPPER)
+	t.RegisterBuiltin("VAL$", 1, VALSTR)
+
+	// Primitives that operate upon complex numbers
+	t.RegisterBuiltin("COMPLEX", 2, COMPLEX)
+	t.RegisterBuiltin("IMAG", 1, IMAG)
+	t.RegisterBuiltin("REAL", 1, REAL)
+
+	// Primitives that operate upon dates
+	t.RegisterBuiltin("DATEADD$", 3, DATEADD)
+	t.RegisterBuiltin("DATEDIFF", 3, DATEDIFF)
+	t.RegisterBuiltin("DATEVALID", 1, DATEVALID)
+
+	// Text-attributes
+	t.RegisterBuiltin("BLINK$", 0, ansiAttribute("5"))
+	t.RegisterBuiltin("BOLD$", 0, ansiAttribute("1"))
+	t.RegisterBuiltin("DIM$", 0, ansiAttribute("2"))
+	t.RegisterBuiltin("ITALIC$", 0, ansiAttribute("3"))
+	t.RegisterBuiltin("RESET$", 0, ansiAttribute("0"))
+	t.RegisterBuiltin("REVERSE$", 0, ansiAttribute("7"))
+	t.RegisterBuiltin("UNDERLINE$", 0, ansiAttribute("4"))
+
+	// Primitives that draw in graphics mode
+	t.RegisterBuiltin("LINE", 5, LINE)
+	t.RegisterBuiltin("PLOT", 3, PLOT)
 
 	t.RegisterBuiltin("DUMP", 1, DUMP)
 
+	//
+	// Collect the values of the DATA statements.
+	//
+	t.loadData()
+
 	return t
 }
 
@@ -182,12 +540,365 @@ func (e *Interpreter) SetTrace(val bool) {
 	e.trace = val
 }
 
+// SetSandbox allows the user to enable/disable sandbox mode, in which
+// the program may not run external commands via EXEC$, read and write
+// files via OPEN, VARLOAD, and VARSAVE, or read the environment via
+// ENVIRON$, and may only SLEEP briefly.
+//
+// This should be enabled when running untrusted programs.
+func (e *Interpreter) SetSandbox(val bool) {
+	e.sandbox = val
+}
+
+// SetMaxIterations limits the number of steps Run may execute, so that
+// a program which loops forever is terminated with an error.  Zero, the
+// default, removes the limit.
+//
+// Each token which RunOnce is given counts as a step, including the
+// line-numbers and newlines of the program.
+func (e *Interpreter) SetMaxIterations(n int64) {
+	e.maxIterations = n
+}
+
+// SetBigIntMode allows the user to enable/disable big-integer mode,
+// in which integer arithmetic is carried out with arbitrary precision
+// rather than overflowing the precision of a float64.
+func (e *Interpreter) SetBigIntMode(val bool) {
+	e.bigIntMode = val
+}
+
+// SetComplexMode allows the user to enable/disable complex mode,
+// in which the square root of a negative number is a complex number.
+func (e *Interpreter) SetComplexMode(val bool) {
+	e.complexMode = val
+}
+
+// SetOutput allows the user to redirect the output of the program,
+// which defaults to STDOUT.
+//
+// If the writer has an `IsTTY() bool` method it is used to decide
+// whether the output is a terminal, and so whether text-attributes
+// such as BOLD$ are enabled.
+func (e *Interpreter) SetOutput(w io.Writer) {
+	e.output = w
+}
+
+// SetInput allows the user to change the source from which INPUT,
+// GETCH, and INKEY$ read, which defaults to STDIN.
+func (e *Interpreter) SetInput(r io.Reader) {
+	e.STDIN = bufio.NewReader(r)
+	e.stdinFile, _ = r.(*os.File)
+}
+
+// enterLine records that we've started executing the given line.
+func (e *Interpreter) enterLine(line string) {
+	e.lineno = line
+	e.profile[line]++
+}
+
+// LineProfile returns the number of times each line of the program
+// has been executed, keyed by line-number.
+func (e *Interpreter) LineProfile() map[string]int {
+	out := make(map[string]int)
+	for line, count := range e.profile {
+		out[line] = count
+	}
+	return out
+}
+
+// ResetProfile discards the execution-counts returned by LineProfile.
+func (e *Interpreter) ResetProfile() {
+
+	// Builtins receive a copy of the interpreter, so we must
+	// empty the map rather than replacing it.
+	for line := range e.profile {
+		delete(e.profile, line)
+	}
+}
+
+// print writes the given text to our output, keeping track of the
+// column the cursor will be left in.
+func (e *Interpreter) print(txt string) {
+	if e.printBuffer != nil {
+		e.printBuffer.WriteString(txt)
+	} else if e.graphicsMode {
+		e.graphics.Print(txt)
+	} else {
+		fmt.Fprint(e.output, txt)
+	}
+
+	if i := strings.LastIndex(txt, "\n"); i >= 0 {
+		e.printColumn = utf8.RuneCountInString(txt[i+1:])
+	} else {
+		e.printColumn += utf8.RuneCountInString(txt)
+	}
+}
+
+// printValue writes the given value to our output, as PRINT would
+// display it.
+func (e *Interpreter) printValue(val object.Object) {
+	switch v := val.(type) {
+	case *object.StringObject:
+		e.print(v.Value)
+	case *object.NumberObject:
+		e.print(formatNumber(v.Value))
+	case *object.ComplexObject:
+		e.print(formatComplex(v.Value))
+	case *object.BigIntObject:
+		e.print(v.Value.String())
+	}
+}
+
+// formatUsing formats a number according to the mask given to
+// `PRINT USING`, for example "###.##", in which:
+//
+//  #  is a digit.
+//  .  is the decimal point.
+//  +  forces a sign to be shown, even for positive numbers.
+//  $  shows a currency prefix.
+//  *  is a digit, and fills leading blanks with asterisks.
+//
+// Any other characters of the mask are output as they are, so
+// "Total: ###" is valid.  If the number doesn't fit the mask the field
+// is filled with "%" characters instead.
+func formatUsing(mask string, val float64) string {
+
+	// Find the field, which is the first run of mask characters.
+	start := strings.IndexAny(mask, "#*$+.")
+	if start < 0 {
+		return mask
+	}
+	end := start
+	for end < len(mask) && strings.IndexByte("#*$+.", mask[end]) >= 0 {
+		end++
+	}
+	field := mask[start:end]
+
+	fill := " "
+	if strings.Contains(field, "*") {
+		fill = "*"
+	}
+
+	decimals := 0
+	point := strings.IndexByte(field, '.')
+	if point >= 0 {
+		decimals = strings.Count(field[point:], "#")
+	}
+
+	num := strconv.FormatFloat(math.Abs(val), 'f', decimals, 64)
+	if point >= 0 && decimals == 0 {
+		num += "."
+	}
+	if strings.Contains(field, "$") {
+		num = "$" + num
+	}
+	if val < 0 && num != strconv.FormatFloat(0, 'f', decimals, 64) {
+		num = "-" + num
+	} else if strings.Contains(field, "+") {
+		num = "+" + num
+	}
+
+	if len(num) > len(field) {
+		num = strings.Repeat("%", len(field))
+	} else {
+		num = strings.Repeat(fill, len(field)-len(num)) + num
+	}
+	return mask[:start] + num + mask[end:]
+}
+
 ////
 //
 // Helpers for stuff
 //
 ////
 
+// errorWriter wraps a writer, recording the first error it returns,
+// because PRINT ignores the errors from its output.
+type errorWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write writes the given bytes, unless a previous write failed.
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// channel reads the `#1` channel-number given to OPEN, CLOSE, PRINT or
+// INPUT, leaving the offset at the token which follows it.
+func (e *Interpreter) channel(name string) (int, error) {
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.HASH {
+		return 0, fmt.Errorf("%s: expected a channel, such as #1", name)
+	}
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.INT {
+		return 0, fmt.Errorf("%s: the channel must be a number", name)
+	}
+	lit := e.program[e.offset].Literal
+	e.offset++
+
+	n, err := strconv.Atoi(lit)
+	if err != nil || n < 1 || n > maxChannel {
+		return 0, fmt.Errorf("%s: unknown channel #%s", name, lit)
+	}
+	return n, nil
+}
+
+// record finds the file, fields, and offset of the record given to GET
+// or PUT, such as `#1, 3`, whose fields must have been set by FIELD.
+//
+// The offset is expected to be at the channel.
+func (e *Interpreter) record(name string) (*os.File, []FieldDef, int64, error) {
+
+	n, err := e.channel(name)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	fields, ok := e.fieldDefs[n]
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s: channel #%d is not open for RANDOM access", name, n)
+	}
+	if len(fields) == 0 {
+		return nil, nil, 0, fmt.Errorf("%s: no FIELD has been set for channel #%d", name, n)
+	}
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+		return nil, nil, 0, fmt.Errorf("ERROR: %s should be : %s #channel, record", name, name)
+	}
+	e.offset++
+
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return nil, nil, 0, fmt.Errorf("%s: %s", name, res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.NUMBER {
+		return nil, nil, 0, fmt.Errorf("%s: the record must be a number", name)
+	}
+	rec := res.(*object.NumberObject).Value
+	if rec < 1 || rec > math.MaxInt32 || rec != math.Trunc(rec) {
+		return nil, nil, 0, fmt.Errorf("%s: invalid record %s", name, formatNumber(rec))
+	}
+
+	return e.fileHandles[n], fields, (int64(rec) - 1) * int64(recordLength(fields)), nil
+}
+
+// recordLength returns the length of a record with the given fields.
+func recordLength(fields []FieldDef) int {
+	size := 0
+	for _, field := range fields {
+		size += field.width
+	}
+	return size
+}
+
+// closeFiles closes all the files which the program left open.
+func (e *Interpreter) closeFiles() {
+	for n, f := range e.fileHandles {
+		f.Close()
+		delete(e.fileHandles, n)
+		delete(e.fileReaders, n)
+		delete(e.fieldDefs, n)
+	}
+}
+
+// runtimeError converts an error into a RuntimeError, recording the
+// line we're executing, unless it already is one.
+func (e *Interpreter) runtimeError(err error) error {
+	if _, ok := err.(*RuntimeError); ok {
+		return err
+	}
+	return &RuntimeError{Line: e.lineno, Message: err.Error()}
+}
+
+// lineAt returns the line-number of the line containing the given
+// offset in our program.
+func (e *Interpreter) lineAt(offset int) string {
+	for i := offset; i >= 0 && i < len(e.program); i-- {
+		if e.program[i].Type == token.LINENO {
+			return e.program[i].Literal
+		}
+	}
+	return ""
+}
+
+// isTTY returns true if the given writer is a terminal.
+//
+// Writers may tell us this via an `IsTTY() bool` method, otherwise we
+// test whether files are character-devices.
+func isTTY(w io.Writer) bool {
+	if t, ok := w.(interface{ IsTTY() bool }); ok {
+		return t.IsTTY()
+	}
+	if f, ok := w.(*os.File); ok {
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	return false
+}
+
+// formatNumber converts a number to a string, for display.
+//
+// Integer-like values are displayed without a decimal point, to avoid
+// 3 looking like 3.0000, and other values are displayed in the shortest
+// form which represents them exactly.
+func formatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < math.MaxInt64 {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// formatComplex converts a complex number to a string, for display,
+// in the form "(1+2i)".
+func formatComplex(c complex128) string {
+	im := formatNumber(imag(c))
+	if !strings.HasPrefix(im, "-") {
+		im = "+" + im
+	}
+	return "(" + formatNumber(real(c)) + im + "i)"
+}
+
+// negate implements the unary minus operator, as in `LET X = -Y`.
+//
+// Any numeric value may be negated, while strings may not, and errors
+// are returned as they are.
+func negate(val object.Object) object.Object {
+	switch v := val.(type) {
+	case *object.NumberObject:
+		return &object.NumberObject{Value: -v.Value}
+	case *object.BigIntObject:
+		return &object.BigIntObject{Value: new(big.Int).Neg(v.Value)}
+	case *object.ComplexObject:
+		return &object.ComplexObject{Value: -v.Value}
+	case *object.ErrorObject:
+		return val
+	}
+	return object.Error("factor() - cannot negate %v", val)
+}
+
+// toComplex returns the value of the given object as a complex number,
+// which allows plain numbers to be mixed with complex ones.
+//
+// The second return value is false if the object isn't numeric.
+func toComplex(obj object.Object) (complex128, bool) {
+	switch v := obj.(type) {
+	case *object.NumberObject:
+		return complex(v.Value, 0), true
+	case *object.ComplexObject:
+		return v.Value, true
+	}
+	return 0, false
+}
+
 // factor
 func (e *Interpreter) factor() object.Object {
 
@@ -195,6 +906,11 @@ func (e *Interpreter) factor() object.Object {
 		return object.Error("Hit end of program processing factor()")
 	}
 
+	// Only the first factor of the value given to LET may be a
+	// slice of an array.
+	allowSlice := e.allowSlice
+	e.allowSlice = false
+
 	tok := e.program[e.offset]
 	switch tok.Type {
 	case token.LBRACKET:
@@ -228,16 +944,46 @@ func (e *Interpreter) factor() object.Object {
 		e.offset++
 		return &object.StringObject{Value: tok.Literal}
 
+	case token.MINUS:
+		// skip past the minus
+		e.offset++
+
+		// negate the following value, so `--Y` is Y.
+		return negate(e.factor())
+
 	case token.BUILTIN:
 
+		//
+		// PRINT$ needs to see the separators between its
+		// arguments, so it's handled specially.
+		//
+		if tok.Literal == "PRINT$" {
+			return e.printString()
+		}
+
 		//
 		// Call the built-in and return the value.
 		//
 		val := e.callBuiltin(tok.Literal)
 		return val
 
+	case token.FN:
+
+		//
+		// Call the user-defined function and return the value.
+		//
+		return e.callUserFunction()
+
 	case token.IDENT:
 
+		//
+		// Is this an element of an array?
+		//
+		if e.offset+1 < len(e.program) && e.program[e.offset+1].Type == token.LBRACKET {
+			e.offset++
+			return e.arrayElement(tok.Literal, allowSlice)
+		}
+
 		//
 		// Get the contents of the variable.
 		//
@@ -277,13 +1023,59 @@ func (e *Interpreter) term() object.Object {
 		f2 := e.factor()
 
 		//
-		// We allow operations of the form:
+		// If either argument is a complex number then the
+		// other is promoted to one.
 		//
-		//  NUMBER OP NUMBER
+		if f1.Type() == object.COMPLEX || f2.Type() == object.COMPLEX {
+			c1, ok1 := toComplex(f1)
+			c2, ok2 := toComplex(f2)
+			if !ok1 || !ok2 {
+				return object.Error("term() only handles numbers")
+			}
+
+			switch tok.Type {
+			case token.ASTERISK:
+				f1 = &object.ComplexObject{Value: c1 * c2}
+			case token.SLASH:
+				if c2 == 0 {
+					return object.Error("Division by zero!")
+				}
+				f1 = &object.ComplexObject{Value: c1 / c2}
+			case token.MOD:
+				return object.Error("term() MOD is not supported for complex numbers")
+			}
+
+			// repeat?
+			tok = e.program[e.offset]
+			continue
+		}
+
 		//
-		// We can error on strings.
+		// Integers may need arbitrary precision.
 		//
-		if f1.Type() != object.NUMBER ||
+		if e.bigIntMode || f1.Type() == object.BIGINT || f2.Type() == object.BIGINT {
+			if out, ok := bigIntArith(tok.Type, f1, f2); ok {
+				if out.Type() == object.ERROR {
+					return out
+				}
+				f1 = out
+
+				// repeat?
+				tok = e.program[e.offset]
+				continue
+			}
+			f1 = demoteBigInt(f1)
+			f2 = demoteBigInt(f2)
+		}
+
+		//
+		// We allow operations of the form:
+		//
+		//  NUMBER OP NUMBER
+		//
+		// We can error on strings.
+		//
+		if f1.Type() != object.NUMBER ||
 			f2.Type() != object.NUMBER {
 			return object.Error("term() only handles integers")
 		}
@@ -367,6 +1159,49 @@ func (e *Interpreter) expr(allowBinOp bool) object.Object {
 			return t2
 		}
 
+		//
+		// If either operand is a complex number then the
+		// other is promoted to one.
+		//
+		if t1.Type() == object.COMPLEX || t2.Type() == object.COMPLEX {
+			c1, ok1 := toComplex(t1)
+			c2, ok2 := toComplex(t2)
+			if !ok1 || !ok2 {
+				return object.Error("expr() - type mismatch between '%v' + '%v'", t1, t2)
+			}
+
+			switch tok.Type {
+			case token.PLUS:
+				t1 = &object.ComplexObject{Value: c1 + c2}
+			case token.MINUS:
+				t1 = &object.ComplexObject{Value: c1 - c2}
+			default:
+				return object.Error("expr() operation '%s' not supported for complex numbers", tok.Literal)
+			}
+
+			// repeat?
+			tok = e.program[e.offset]
+			continue
+		}
+
+		//
+		// Integers may need arbitrary precision.
+		//
+		if e.bigIntMode || t1.Type() == object.BIGINT || t2.Type() == object.BIGINT {
+			if out, ok := bigIntArith(tok.Type, t1, t2); ok {
+				if out.Type() == object.ERROR {
+					return out
+				}
+				t1 = out
+
+				// repeat?
+				tok = e.program[e.offset]
+				continue
+			}
+			t1 = demoteBigInt(t1)
+			t2 = demoteBigInt(t2)
+		}
+
 		//
 		// We allow operations of the form:
 		//
@@ -452,6 +1287,30 @@ func (e *Interpreter) compare(allowBinOp bool) object.Object {
 		return t2
 	}
 
+	return compareObjects(op.Type, t1, t2)
+}
+
+// compareObjects compares two values with the given comparison-operator,
+// returning 1 if the comparison is true, and 0 if it is false.
+func compareObjects(op token.Type, t1 object.Object, t2 object.Object) object.Object {
+
+	//
+	// Big integers are compared exactly, unless they're being
+	// compared with a fraction.
+	//
+	if t1.Type() == object.BIGINT || t2.Type() == object.BIGINT {
+		x, ok1 := toBigInt(t1)
+		y, ok2 := toBigInt(t2)
+		if ok1 && ok2 {
+			if bigIntCompare(op, x, y) {
+				return &object.NumberObject{Value: 1}
+			}
+			return &object.NumberObject{Value: 0}
+		}
+		t1 = demoteBigInt(t1)
+		t2 = demoteBigInt(t2)
+	}
+
 	//
 	// String-tests here
 	//
@@ -460,7 +1319,7 @@ func (e *Interpreter) compare(allowBinOp bool) object.Object {
 		v1 := t1.(*object.StringObject).Value
 		v2 := t2.(*object.StringObject).Value
 
-		switch op.Type {
+		switch op {
 		case token.ASSIGN:
 			if v1 == v2 {
 				//true
@@ -504,7 +1363,7 @@ func (e *Interpreter) compare(allowBinOp bool) object.Object {
 		v1 := t1.(*object.NumberObject).Value
 		v2 := t2.(*object.NumberObject).Value
 
-		switch op.Type {
+		switch op {
 		case token.ASSIGN:
 			if v1 == v2 {
 				//true
@@ -545,11 +1404,37 @@ func (e *Interpreter) compare(allowBinOp bool) object.Object {
 	return object.Error("Unhandled comparison: %v[%s] %v %v[%s]\n", t1, t1.Type(), op, t2, t2.Type())
 }
 
+// arrayArgs lists the builtins whose first argument is the name of an
+// array, such as `BSEARCH(A, 3)`, which they receive as its elements.
+var arrayArgs = map[string]bool{
+	"BSEARCH":     true,
+	"BSEARCHSTR$": true,
+}
+
+// builtinArg evaluates the next argument to the named builtin, given
+// the number of arguments which precede it.
+func (e *Interpreter) builtinArg(name string, count int) object.Object {
+
+	if count > 0 || !arrayArgs[name] {
+		return e.expr(true)
+	}
+
+	tok := e.program[e.offset]
+	if tok.Type != token.IDENT || !e.vars.IsArray(tok.Literal) {
+		return object.Error("%s: expected the name of an array, got %v", name, tok)
+	}
+	if e.vars.Columns(tok.Literal) > 0 {
+		return object.Error("%s: the array '%s' has two dimensions", name, tok.Literal)
+	}
+	e.offset++
+	return &object.ArrayObject{Value: e.vars.Elements(tok.Literal)}
+}
+
 // Call the built-in with the given name if we can.
 func (e *Interpreter) callBuiltin(name string) object.Object {
 
 	if e.trace {
-		fmt.Printf("callBultin(%s)\n", name)
+		fmt.Fprintf(e.output, "callBultin(%s)\n", name)
 	}
 
 	//
@@ -564,12 +1449,82 @@ func (e *Interpreter) callBuiltin(name string) object.Object {
 	e.offset++
 
 	//
-	// Each built-in takes a specific number of arguments.
+	// Each built-in takes a specific number of arguments, unless
+	// it is variadic.
 	//
 	// We pass only `string` or `number` to it.
 	//
 	var args []object.Object
 
+	//
+	// The arguments might be wrapped in brackets, for example
+	// `LEFT$("Steve", 2)`, in which case we consume the brackets
+	// along with the arguments.
+	//
+	bracketed := e.bracketedArgs(n)
+	if bracketed {
+
+		// Skip the opening bracket
+		e.offset++
+
+		for e.offset < len(e.program) {
+
+			tok := e.program[e.offset]
+			if tok.Type == token.RBRACKET {
+				e.offset++
+				break
+			}
+			if len(args) > 0 {
+				if tok.Type != token.COMMA {
+					return object.Error("Expected ',' or ')' in arguments to %s, got %v", name, tok)
+				}
+				e.offset++
+			}
+
+			obj := e.builtinArg(name, len(args))
+			if obj.Type() == object.ERROR {
+				return obj
+			}
+			args = append(args, obj)
+
+			if e.trace {
+				fmt.Fprintf(e.output, "\tArgument %d -> %s\n", len(args), obj.String())
+			}
+		}
+	}
+
+	//
+	// A variadic function consumes comma-separated arguments until
+	// it runs out of them.
+	//
+	if n < 0 && !bracketed {
+
+		for e.offset < len(e.program) {
+
+			tok := e.program[e.offset]
+			if len(args) > 0 {
+				if tok.Type != token.COMMA {
+					break
+				}
+				e.offset++
+			} else if !startsExpression(tok.Type) {
+
+				// No arguments at all.
+				break
+			}
+
+			obj := e.builtinArg(name, len(args))
+			if obj.Type() == object.ERROR {
+				return obj
+			}
+			args = append(args, obj)
+
+			if e.trace {
+				fmt.Fprintf(e.output, "\tArgument %d -> %s\n", len(args), obj.String())
+			}
+		}
+	}
+
 	//
 	// Build up the args, converting and evaluating as we go.
 	//
@@ -600,7 +1555,7 @@ func (e *Interpreter) callBuiltin(name string) object.Object {
 		//
 		// Evaluate the next expression.
 		//
-		obj := e.expr(true)
+		obj := e.builtinArg(name, len(args))
 
 		//
 		// If we found an error then return it.
@@ -618,7 +1573,16 @@ func (e *Interpreter) callBuiltin(name string) object.Object {
 		// Show our current progress.
 		//
 		if e.trace {
-			fmt.Printf("\tArgument %d -> %s\n", len(args), obj.String())
+			fmt.Fprintf(e.output, "\tArgument %d -> %s\n", len(args), obj.String())
+		}
+	}
+
+	//
+	// Most builtins only understand plain numbers.
+	//
+	if !bigIntAware[name] {
+		for i, arg := range args {
+			args[i] = demoteBigInt(arg)
 		}
 	}
 
@@ -629,759 +1593,3072 @@ func (e *Interpreter) callBuiltin(name string) object.Object {
 	out := fun(*e, args)
 
 	if e.trace {
-		fmt.Printf("\tReturn value %s\n", out.String())
+		fmt.Fprintf(e.output, "\tReturn value %s\n", out.String())
 	}
 	return out
 }
 
+// startsExpression returns true if a token of the given type may begin
+// an expression, as handled by factor().
+func startsExpression(t token.Type) bool {
+	switch t {
+	case token.INT, token.STRING, token.IDENT, token.BUILTIN,
+		token.FN, token.LBRACKET, token.MINUS:
+		return true
+	}
+	return false
+}
+
+// bracketedArgs returns true if the arguments to the builtin we're
+// about to call, which expects n arguments, are wrapped in brackets.
+//
+// We can't just look for an opening bracket, because `LEFT$ (A$), 2`
+// is valid, so we find the matching closing bracket and count the
+// commas which separate the arguments.
+func (e *Interpreter) bracketedArgs(n int) bool {
+
+	if e.offset >= len(e.program) ||
+		e.program[e.offset].Type != token.LBRACKET {
+		return false
+	}
+
+	depth := 0
+	commas := 0
+
+	for i := e.offset; i < len(e.program); i++ {
+
+		switch e.program[i].Type {
+		case token.NEWLINE, token.EOF:
+			return false
+		case token.COMMA:
+			if depth == 1 {
+				commas++
+			}
+		case token.LBRACKET:
+			depth++
+		case token.RBRACKET:
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			// Variadic functions accept any number.
+			if n < 0 {
+				return true
+			}
+
+			// Empty brackets?
+			if i == e.offset+1 {
+				return n == 0
+			}
+			return commas+1 == n
+		}
+	}
+	return false
+}
+
 ////
 //
 // Statement-handlers
 //
 ////
 
-// runForLoop handles a FOR loop
-func (e *Interpreter) runForLoop() error {
-	// we expect "ID = NUM to NUM [STEP NUM]"
+// runAPPEND appends a string to the end of a string variable.
+//
+// The general form is:
+//
+//  APPEND A$, "text"
+//
+// This is equivalent to `LET A$ = A$ + "text"`, but is much cheaper
+// when building up a string in a loop.
+func (e *Interpreter) runAPPEND() error {
 
-	// Bump past the FOR token
+	// Bump past the APPEND token
 	e.offset++
 
-	// We now expect a variable name.
+	// We now expect an ID
 	target := e.program[e.offset]
 	e.offset++
 	if target.Type != token.IDENT {
-		return fmt.Errorf("Expected IDENT after FOR, got %v", target)
+		return fmt.Errorf("Expected IDENT after APPEND, got %v", target)
+	}
+	if e.vars.IsConstant(target.Literal) {
+		return fmt.Errorf("APPEND: %s is a constant", target.Literal)
 	}
 
-	// Now an EQUALS
-	eq := e.program[e.offset]
-	e.offset++
-	if eq.Type != token.ASSIGN {
-		return fmt.Errorf("Expected = after 'FOR %s' , got %v", target.Literal, eq)
+	// The variable must be a string, if it exists.
+	cur := e.vars.Get(target.Literal)
+	if cur != nil && cur.Type() != object.STRING {
+		return fmt.Errorf("APPEND: %s is not a string", target.Literal)
 	}
 
-	// Now an integer/variable
-	startI := e.program[e.offset]
+	// Now a comma
+	comma := e.program[e.offset]
+	if comma.Type != token.COMMA {
+		return fmt.Errorf("Expected comma after APPEND %s, got %v", target.Literal, comma)
+	}
 	e.offset++
 
-	var start float64
-	if startI.Type == token.INT {
-		v, err := strconv.ParseFloat(startI.Literal, 64)
-		if err != nil {
-			return fmt.Errorf("Failed to convert %s to an int %s", startI.Literal, err.Error())
-		}
-		start = v
-	} else if startI.Type == token.IDENT {
+	// now we're at the expression/value/whatever
+	res := e.expr(true)
 
-		x := e.GetVariable(startI.Literal)
-		if x.Type() != object.NUMBER {
-			return fmt.Errorf("FOR: start-variable must be an integer!")
-		}
-		start = x.(*object.NumberObject).Value
-	} else {
-		return fmt.Errorf("Expected INT/VARIABLE after 'FOR %s=', got %v", target.Literal, startI)
+	// Did we get an error in the expression?
+	if res.Type() == object.ERROR {
+		return fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.STRING {
+		return fmt.Errorf("APPEND: expected a string, got %v", res)
 	}
 
-	// Now TO
-	to := e.program[e.offset]
+	e.vars.Append(target.Literal, res.(*object.StringObject).Value)
+	return nil
+}
+
+// runCALL invokes a golang function, registered via RegisterCall.
+//
+// The general form is:
+//
+//  CALL "name", arg1, arg2, .. argN
+//
+// The return value of the function is stored in the variable CALL_RESULT.
+func (e *Interpreter) runCALL() error {
+
+	// Skip the CALL-instruction itself
 	e.offset++
-	if to.Type != token.TO {
-		return fmt.Errorf("Expected TO after 'FOR %s=%s', got %v", target.Literal, startI, to)
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing CALL")
 	}
 
-	// Now an integer/variable
-	endI := e.program[e.offset]
+	// Get the name of the function to invoke.
+	name := e.program[e.offset]
 	e.offset++
+	if name.Type != token.STRING {
+		return fmt.Errorf("ERROR: CALL should be followed by a string, got %v", name)
+	}
 
-	var end int
+	fun, ok := e.callTable[name.Literal]
+	if !ok {
+		return fmt.Errorf("CALL to unknown function %s", name.Literal)
+	}
 
-	if endI.Type == token.INT {
-		v, err := strconv.ParseFloat(endI.Literal, 64)
-		if err != nil {
-			return fmt.Errorf("Failed to convert %s to an int %s", endI.Literal, err.Error())
-		}
+	//
+	// Now collect the arguments, which are comma-separated
+	// expressions, until we hit the end of the statement.
+	//
+	var args []object.Object
 
-		end = int(v)
-	} else if endI.Type == token.IDENT {
+	for e.offset < len(e.program) {
 
-		x := e.GetVariable(endI.Literal)
-		if x.Type() != object.NUMBER {
-			return fmt.Errorf("FOR: end-variable must be an integer!")
+		tok := e.program[e.offset]
+		if tok.Type != token.COMMA {
+			break
 		}
-		end = int(x.(*object.NumberObject).Value)
-	} else {
-		return fmt.Errorf("Expected INT/VARIABLE after 'FOR %s=%s TO', got %v", target.Literal, startI, endI)
-	}
-
-	// Default step is 1.
-	stepI := "1"
-
-	// Is the next token a step?
-	if e.program[e.offset].Type == token.STEP {
 		e.offset++
 
-		s := e.program[e.offset]
-		e.offset++
-		if s.Type != token.INT {
-			return fmt.Errorf("Expected INT after 'FOR %s=%s TO %s STEP', got %v", target.Literal, startI, endI, s)
+		obj := e.expr(true)
+		if obj.Type() == object.ERROR {
+			return fmt.Errorf("%s", obj.(*object.ErrorObject).Value)
 		}
-		stepI = s.Literal
-	}
-
-	step, err := strconv.ParseFloat(stepI, 64)
-	if err != nil {
-		return fmt.Errorf("Failed to convert %s to an int %s", stepI, err.Error())
+		args = append(args, obj)
 	}
 
 	//
-	// Now we can record the important details of the for-loop
-	// in a hash.
-	//
-	// The key observersions here are that all the magic
-	// really involved in the FOR-loop happens at the point
-	// you interpret the "NEXT X" section.
-	//
-	// Handling the NEXT statement involves:
-	//
-	//  Incrementing the step-variable
-	//  Looking for termination
-	//  If not over then "jumping back".
-	//
-	// So for a for-loop we just record the start/end conditions
-	// and the address of the body of the loop - ie. the next
-	// token - so that the next-handler can GOTO there.
-	//
-	// It is almost beautifully elegent.
-	//
-	f := ForLoop{id: target.Literal,
-		offset: e.offset,
-		start:  int(start),
-		end:    int(end),
-		step:   int(step)}
-
-	//
-	// Set the variable to the starting-value
+	// Invoke the function.
 	//
-	e.SetVariable(target.Literal, &object.NumberObject{Value: start})
+	out := fun(e, args)
+	if out == nil {
+		return nil
+	}
+	if out.Type() == object.ERROR {
+		return fmt.Errorf("%s", out.(*object.ErrorObject).Value)
+	}
 
 	//
-	// And record our loop - keyed on the name of the variable
-	// which is used as the index.  This allows easy and natural
-	// nested-loops.
-	//
-	// Did I say this is elegent?
+	// The statement discards the return value, so we store it
+	// where the program can find it, if it cares.
 	//
-	e.loops.Add(f)
+	e.SetVariable("CALL_RESULT", out)
 	return nil
 }
 
-// runGOSUB handles a control-flow change
-func (e *Interpreter) runGOSUB() error {
-
-	// Skip the GOSUB-instruction itself
-	e.offset++
+// runCASE is invoked when we reach a CASE after executing the statements
+// of the matching CASE of a SELECT, which means we're done, so we jump
+// to the END SELECT.
+func (e *Interpreter) runCASE() error {
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing GOSUB")
+	_, end := e.matchSelect(e.offset + 1)
+	if end < 0 {
+		return fmt.Errorf("CASE without END SELECT")
 	}
 
-	// Get the target
-	target := e.program[e.offset]
+	e.offset = end
+	e.lineno = e.lineAt(end)
+	return nil
+}
 
-	// We expect the target to be an int
-	if target.Type != token.INT {
-		return (fmt.Errorf("ERROR: GOSUB should be followed by an integer"))
-	}
+// runCLEAR resets the state of the program, removing all variables,
+// open FOR loops, and pending GOSUB returns.
+//
+// Execution continues with the next statement, so this allows a program
+// to start a computation afresh without being reloaded.
+//
+// A modifier may be given to limit what is cleared:
+//
+//  CLEAR SCREEN     - Clears the screen, if our output is a terminal.
+//  CLEAR VARIABLES  - Removes all variables.
+//  CLEAR GOSUB      - Discards pending GOSUB returns.
+//  CLEAR ARRAYS     - Removes all arrays.
+//  CLEAR ALL        - Clears the screen, as well as everything else.
+//
+// For compatibility a number may follow CLEAR, as in `CLEAR 1000`,
+// which reserved space for strings in classic BASICs.  It is ignored.
+func (e *Interpreter) runCLEAR() error {
 
 	//
-	// We want to store the return address on our GOSUB-stack,
-	// so that the next RETURN will continue execution at the
-	// next instruction.
-	//
-	// Because we only support one statement per-line we can
-	// handle that by bumping forward.  That should put us on the
-	// LINENO of the following-line.
+	// The modifiers are plain identifiers, except for GOSUB which
+	// is a keyword.
 	//
-	e.offset++
-	e.gstack.Push(e.offset)
+	modifier := ""
+	if e.offset+1 < len(e.program) {
+		next := e.program[e.offset+1]
+		if next.Type == token.IDENT || next.Type == token.GOSUB {
+			e.offset++
+			modifier = strings.ToUpper(next.Literal)
+		}
+		if next.Type == token.INT {
+			e.offset++
+		}
+	}
 
-	//
-	// Lookup the offset of the given line-number in our program/
-	//
-	offset := e.lines[target.Literal]
-
-	//
-	// If we found it then use it.
-	//
-	if offset > 0 {
-		e.offset = offset
-		return nil
+	switch modifier {
+	case "":
+		e.clearState()
+	case "ALL":
+		e.clearScreen()
+		e.clearState()
+	case "ARRAYS":
+		e.vars.ClearArrays()
+	case "GOSUB":
+		e.gstack = NewStack()
+	case "SCREEN":
+		e.clearScreen()
+	case "VARIABLES":
+		e.vars.Clear()
+	default:
+		return fmt.Errorf("CLEAR: unknown modifier %s", e.program[e.offset].Literal)
 	}
+	return nil
+}
 
-	return fmt.Errorf("Failed to GOSUB %s", target.Literal)
+// clearState removes all variables and arrays, open FOR loops, and
+// pending GOSUB returns.
+func (e *Interpreter) clearState() {
+	e.vars.Clear()
+	e.vars.ClearArrays()
+	e.loops = NewLoops()
+	e.whiles = NewWhileLoops()
+	e.repeats = NewStack()
+	e.doStack = NewDoLoops()
+	e.gstack = NewStack()
 }
 
-// runGOTO handles a control-flow change
-func (e *Interpreter) runGOTO() error {
+// clearScreen clears the screen, and homes the cursor, if our output
+// is a terminal.
+func (e *Interpreter) clearScreen() {
+	if isTTY(e.output) {
+		e.print("\033[2J\033[H")
+	}
+	e.printColumn = 0
+}
 
-	// Skip the GOTO-instruction
+// runCLOSE closes a file which was opened by OPEN.
+//
+// The general form is:
+//
+//  CLOSE #1
+func (e *Interpreter) runCLOSE() error {
+
+	// Bump past the CLOSE token
 	e.offset++
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing GOTO")
+	n, err := e.channel("CLOSE")
+	if err != nil {
+		return err
 	}
 
-	// Get the GOTO-target
-	target := e.program[e.offset]
+	f, ok := e.fileHandles[n]
+	if !ok {
+		return fmt.Errorf("CLOSE: channel #%d is not open", n)
+	}
+	delete(e.fileHandles, n)
+	delete(e.fileReaders, n)
+	delete(e.fieldDefs, n)
 
-	// We expect the target to be an int
-	if target.Type != token.INT {
-		return fmt.Errorf("ERROR: GOTO should be followed by an integer")
+	err = f.Close()
+	if err != nil {
+		e.setErrno(err)
+		return fmt.Errorf("CLOSE: %s", err.Error())
 	}
+	return nil
+}
 
-	//
-	// Lookup the offset of the given line-number in our program/
-	//
-	offset := e.lines[target.Literal]
+// setErrno stores the operating-system error-code of a failed file
+// operation in ERRNO, which STRERR$ may describe, or zero if the error
+// has no such code, as at the end of a file.
+func (e *Interpreter) setErrno(err error) {
 
-	//
-	// If we found it then use it.
-	//
-	if offset > 0 {
-		e.offset = offset
-		return nil
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		errno = 0
 	}
+	e.vars.Set("ERRNO", &object.NumberObject{Value: float64(errno)})
+}
+
+// loadData collects the values of all the DATA statements in our
+// program, so that they may be consumed by READ.
+//
+// The values may be numbers or strings, and unquoted words are
+// regarded as strings.  Invalid values are recorded as errors, which
+// are reported if they're read.
+func (e *Interpreter) loadData() {
+
+	e.data = nil
+	e.dataOffset = 0
+	e.dataLines = make(map[string]int)
+	e.namedData = make(map[string]int)
+
+	for i := 0; i < len(e.program); i++ {
+
+		tok := e.program[i]
+
+		// Values after this line-number will be appended.
+		if tok.Type == token.LINENO {
+			e.dataLines[tok.Literal] = len(e.data)
+			continue
+		}
+
+		// A comment runs to the end of its line, as in runREM,
+		// and might mention DATA.
+		if tok.Type == token.REM {
+			for i+1 < len(e.program) && e.program[i+1].Type != token.NEWLINE {
+				i++
+			}
+			continue
+		}
+		if name, ok := dataName(tok); ok {
+			e.namedData[name] = len(e.data)
+		} else if tok.Type != token.DATA {
+			continue
+		}
 
-	return fmt.Errorf("Failed to GOTO %s", target.Literal)
+		for i++; i < len(e.program); i++ {
+			tok = e.program[i]
+
+			if tok.Type == token.NEWLINE || tok.Type == token.COLON {
+				break
+			}
+
+			negate := false
+			if tok.Type == token.MINUS && i+1 < len(e.program) {
+				negate = true
+				i++
+				tok = e.program[i]
+			}
+
+			switch tok.Type {
+			case token.COMMA:
+				continue
+			case token.INT:
+				n, err := strconv.ParseFloat(tok.Literal, 64)
+				if err != nil {
+					e.data = append(e.data, object.Error("DATA: failed to convert %s to a number", tok.Literal))
+					continue
+				}
+				if negate {
+					n = -n
+				}
+				e.data = append(e.data, &object.NumberObject{Value: n})
+			case token.STRING, token.IDENT, token.BUILTIN:
+				if negate {
+					e.data = append(e.data, object.Error("DATA: cannot negate %s", tok.Literal))
+					continue
+				}
+				e.data = append(e.data, &object.StringObject{Value: tok.Literal})
+			default:
+				e.data = append(e.data, object.Error("DATA: unexpected value %v", tok))
+			}
+		}
+	}
 }
 
-// runINPUT handles input of numbers from the user.
+// runDATA handles a DATA statement.
 //
-// NOTE:
-//   INPUT "Foo", a   -> Reads an integer
-//   INPUT "Foo", a$  -> Reads a string
-func (e *Interpreter) runINPUT() error {
+// The values were collected when the program was loaded, so at
+// runtime the statement is skipped.
+func (e *Interpreter) runDATA() error {
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing INPUT")
+	for e.offset < len(e.program) {
+		tok := e.program[e.offset]
+		if tok.Type == token.NEWLINE || tok.Type == token.COLON {
+			return nil
+		}
+		e.offset++
 	}
 
-	// Skip the INPUT-instruction
-	e.offset++
+	return nil
+}
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing INPUT")
+// arrayIndexes evaluates the bracketed indexes which follow the name of
+// an array, such as `A(I + 1)` or `M(R, C)`, leaving the offset after
+// the closing bracket.
+func (e *Interpreter) arrayIndexes() ([]int, error) {
+
+	var indexes []int
+	for {
+		// skip past the lbracket, or the comma
+		e.offset++
+
+		n, err := e.arrayNumber()
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, n)
+
+		if len(indexes) == 2 || e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			break
+		}
 	}
 
-	// Get the prompt
-	prompt := e.program[e.offset]
+	// skip past the rbracket
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.RBRACKET {
+		return nil, fmt.Errorf("Unclosed bracket around array index")
+	}
 	e.offset++
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing INPUT")
-	}
+	return indexes, nil
+}
 
-	// We expect a comma
-	comma := e.program[e.offset]
+// arrayElement returns the element of the named array given by the
+// bracketed indexes which follow, or, if slices are allowed, the
+// elements given by a range such as `A(2 TO 5)`.
+func (e *Interpreter) arrayElement(name string, allowSlice bool) object.Object {
+
+	// skip past the lbracket
 	e.offset++
-	if comma.Type != token.COMMA {
-		return fmt.Errorf("ERROR: INPUT should be : INPUT \"prompt\",var")
+
+	lo, err := e.arrayNumber()
+	if err != nil {
+		return object.Error("%s", err.Error())
 	}
 
-	if e.offset >= len(e.program) {
-		return fmt.Errorf("Hit end of program processing INPUT")
+	hi := lo
+	indexes := []int{lo}
+	slice := e.offset < len(e.program) && e.program[e.offset].Type == token.TO
+	if slice {
+		if !allowSlice {
+			return object.Error("A slice of the array '%s' may only be assigned with LET", name)
+		}
+
+		// skip past the TO
+		e.offset++
+
+		hi, err = e.arrayNumber()
+		if err != nil {
+			return object.Error("%s", err.Error())
+		}
+	} else if e.offset < len(e.program) && e.program[e.offset].Type == token.COMMA {
+
+		// skip past the comma, to the column
+		e.offset++
+
+		col, err := e.arrayNumber()
+		if err != nil {
+			return object.Error("%s", err.Error())
+		}
+		indexes = append(indexes, col)
 	}
 
-	// Now the ID
-	ident := e.program[e.offset]
+	// skip past the rbracket
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.RBRACKET {
+		return object.Error("Unclosed bracket around array index")
+	}
 	e.offset++
-	if ident.Type != token.IDENT {
-		return fmt.Errorf("ERROR: INPUT should be : INPUT \"prompt\",var")
+
+	if slice {
+		return e.vars.Slice(name, lo, hi)
 	}
+	index, err := e.vars.Offset(name, indexes)
+	if err != nil {
+		return object.Error("%s", err.Error())
+	}
+	return e.vars.GetIndex(name, index)
+}
 
-	//
-	// Print the prompt
-	//
-	fmt.Printf(prompt.Literal)
+// arrayNumber evaluates an array index, which must be an integer.
+func (e *Interpreter) arrayNumber() (int, error) {
 
-	//
-	// Read the input from the user.
-	//
-	input, _ := e.STDIN.ReadString('\n')
-	input = strings.TrimRight(input, "\n")
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return 0, fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.NUMBER {
+		return 0, fmt.Errorf("array index must be a number")
+	}
+	n := res.(*object.NumberObject).Value
+	if n != math.Trunc(n) {
+		return 0, fmt.Errorf("array index %s is not an integer", formatNumber(n))
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("array index %s is out of range", formatNumber(n))
+	}
 
-	//
-	// Now we handle the type-conversion.
-	//
-	if strings.HasSuffix(ident.Literal, "$") {
-		// We set a string
-		e.SetVariable(ident.Literal, &object.StringObject{Value: input})
-		return nil
+	return int(n), nil
+}
+
+// runDEF handles the definition of a single-line function:
+//
+//  DEF FN AREA(W) = W * W
+//
+// The function may then be called in any expression, as `FN AREA(3)`.
+// The definition is recorded when the statement is executed.
+func (e *Interpreter) runDEF() error {
+
+	// Bump past the DEF token
+	e.offset++
+
+	// Now the FN, name, and bracketed parameter.
+	expect := []token.Type{token.FN, token.IDENT, token.LBRACKET,
+		token.IDENT, token.RBRACKET, token.ASSIGN}
+
+	var parts []token.Token
+	for _, t := range expect {
+		if e.offset >= len(e.program) {
+			return fmt.Errorf("Hit end of program processing DEF")
+		}
+		tok := e.program[e.offset]
+		if tok.Type == token.BUILTIN && t == token.IDENT && len(parts) == 1 {
+			return fmt.Errorf("DEF FN: %s is a built-in function", tok.Literal)
+		}
+		if tok.Type != t {
+			return fmt.Errorf("DEF should be : DEF FN NAME(PARAM) = EXPR, got %v", tok)
+		}
+		parts = append(parts, tok)
+		e.offset++
 	}
 
-	// We set an int
-	i, err := strconv.ParseFloat(input, 64)
-	if err != nil {
-		return err
+	// The body runs until the end of the statement.
+	var body []token.Token
+	for e.offset < len(e.program) {
+		tok := e.program[e.offset]
+		if tok.Type == token.NEWLINE || tok.Type == token.COLON {
+			break
+		}
+		body = append(body, tok)
+		e.offset++
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("DEF FN %s has no body", parts[1].Literal)
+	}
+	if e.vars.IsConstant(parts[3].Literal) {
+		return fmt.Errorf("DEF FN: %s is a constant", parts[3].Literal)
 	}
 
-	//
-	// Set the value
-	//
-	e.SetVariable(ident.Literal, &object.NumberObject{Value: i})
+	// Terminate the body, so that it may be evaluated alone.
+	body = append(body, token.Token{Type: token.NEWLINE, Literal: "\n"})
+
+	e.userFunctions[parts[1].Literal] = UserFunc{param: parts[3].Literal, body: body}
 	return nil
 }
 
-// runIF handles conditional testing.
+// callUserFunction calls a function defined by DEF FN, returning its
+// result.
 //
-// There are a lot of choices to be made when it comes to IF, such as
-// whether to support an ELSE section or not.  And what to allow
-// inside the matching section generally:
-//
-// A single statement?
-// A block?
-//
-// Here we _only_ allow:
-//
-//  IF $EXPR THEN $STATEMENT ELSE $STATEMENT NEWLINE
-//
-// $STATEMENT will only be a single expression
-//
-func (e *Interpreter) runIF() error {
+// The parameter is a global variable, as all our variables are, so
+// we set it for the duration of the call and then restore it.
+func (e *Interpreter) callUserFunction() object.Object {
 
-	// Bump past the IF token
+	// Bump past the FN token
 	e.offset++
 
-	// Get the result of the comparison-function
-	// against the two arguments.
-	res := e.compare(false)
+	if e.offset >= len(e.program) {
+		return object.Error("Hit end of program processing FN")
+	}
+	name := e.program[e.offset]
+	if name.Type != token.IDENT {
+		return object.Error("Expected a function name after FN, got %v", name)
+	}
+	fn, ok := e.userFunctions[name.Literal]
+	if !ok {
+		return object.Error("FN: %s has not been defined", name.Literal)
+	}
+	e.offset++
 
-	// Error?
-	if res.Type() == object.ERROR {
-		return fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+	// Get the argument
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.LBRACKET {
+		return object.Error("FN %s should be followed by a bracketed argument", name.Literal)
+	}
+	e.offset++
+	arg := e.expr(true)
+	if arg.Type() == object.ERROR {
+		return arg
+	}
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.RBRACKET {
+		return object.Error("Unclosed bracket around argument to FN %s", name.Literal)
 	}
+	e.offset++
 
-	//
-	// We need a boolean result, so we convert here.
-	//
-	result := false
-	if res.Type() == object.NUMBER {
-		result = (res.(*object.NumberObject).Value == 1)
+	if e.fnDepth >= maxFunctionDepth {
+		return object.Error("FN %s: calls nested more than %d deep", name.Literal, maxFunctionDepth)
 	}
+	e.fnDepth++
+	defer func() { e.fnDepth-- }()
 
 	//
-	// The general form of an IF statement is
-	//  IF $COMPARE THEN .. ELSE .. NEWLINE
-	//
-	// However we also want to allow people to write:
-	//
-	//  IF A=3 OR A=4 THEN ..
-	//
-	// So we'll special case things here.
+	// Set the parameter, and evaluate the body in place of our
+	// program.
 	//
+	old := e.vars.Get(fn.param)
+	e.SetVariable(fn.param, arg)
+
+	program, offset := e.program, e.offset
+	e.program, e.offset = fn.body, 0
+	out := e.expr(true)
+	if out.Type() != object.ERROR && e.offset != len(fn.body)-1 {
+		out = object.Error("FN %s: unexpected token %v", name.Literal, fn.body[e.offset])
+	}
+	e.program, e.offset = program, offset
 
-	// We now expect THEN most of the time
-	target := e.program[e.offset]
-	e.offset++
+	if old == nil {
+		e.vars.Delete(fn.param)
+	} else {
+		e.SetVariable(fn.param, old)
+	}
 
-	for target.Type == token.AND ||
-		target.Type == token.OR {
+	return out
+}
 
-		//
-		// See what the next comparison looks like.
-		//
-		extra := e.compare(false)
+// runDIM creates arrays, whose elements may be indexed from zero to
+// the given size inclusive:
+//
+//  DIM A(10), B$(5)
+//
+// The elements of string arrays are empty strings, and those of
+// numeric arrays are zero.
+func (e *Interpreter) runDIM() error {
 
-		if extra.Type() == object.ERROR {
-			return fmt.Errorf("%s", extra.(*object.ErrorObject).Value)
+	for {
+		// Bump past the DIM token, or the comma.
+		e.offset++
+
+		if e.offset >= len(e.program) {
+			return fmt.Errorf("Hit end of program processing DIM")
 		}
 
-		//
-		// We need a boolean answer.
-		//
-		extraResult := false
-		if extra.Type() == object.NUMBER {
-			extraResult = (extra.(*object.NumberObject).Value == 1)
+		target := e.program[e.offset]
+		e.offset++
+		if target.Type != token.IDENT {
+			return fmt.Errorf("Expected IDENT after DIM, got %v", target)
+		}
+		if e.vars.IsArray(target.Literal) {
+			return fmt.Errorf("DIM: %s has already been dimensioned", target.Literal)
+		}
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.LBRACKET {
+			return fmt.Errorf("DIM should be : DIM %s(size)", target.Literal)
 		}
 
-		//
-		// Update our result appropriately.
-		//
-		if target.Type == token.AND {
-			result = result && extraResult
+		sizes, err := e.arrayIndexes()
+		if err != nil {
+			return fmt.Errorf("DIM: %s", err.Error())
 		}
-		if target.Type == token.OR {
-			result = result || extraResult
+		for _, size := range sizes {
+			if size < 0 {
+				return fmt.Errorf("DIM: %s cannot have a negative size", target.Literal)
+			}
 		}
 
-		// Repeat?
-		target = e.program[e.offset]
-		e.offset++
+		var val object.Object = &object.NumberObject{Value: 0}
+		if strings.HasSuffix(target.Literal, "$") {
+			val = &object.StringObject{Value: ""}
+		}
+		if len(sizes) == 2 {
+			err = e.vars.DimMatrix(target.Literal, sizes[0], sizes[1], val)
+		} else {
+			err = e.vars.Dim(target.Literal, sizes[0], val)
+		}
+		if err != nil {
+			return fmt.Errorf("DIM: %s", err.Error())
+		}
+
+		// Another array?
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			return nil
+		}
 	}
+}
+
+// runDO handles the start of a DO loop, which may have a condition
+// at the top, or at the bottom, or neither:
+//
+//  DO WHILE A < 10       DO UNTIL A >= 10      DO
+//    ..                    ..                    ..
+//  LOOP                  LOOP                  LOOP WHILE A < 10
+//
+// If the condition at the top fails we skip past the matching LOOP.
+func (e *Interpreter) runDO() error {
+
+	start := e.offset
+
+	// Bump past the DO token
+	e.offset++
+
+	var kind token.Type
+	if e.offset < len(e.program) {
+		kind = e.program[e.offset].Type
+	}
+
+	result, err := e.loopCondition("DO")
+	if err != nil {
+		return err
+	}
+
+	// The loop might already be open, if LOOP jumped back to us.
+	top, err := e.doStack.Peek()
+	open := err == nil && top.condOffset == start
+
+	if result {
+		if !open {
+			loop := DoLoop{condOffset: start, bodyOffset: e.offset}
+			if kind == token.WHILE || kind == token.UNTIL {
+				loop.condType = kind
+			}
+			e.doStack.Push(loop)
+		}
+		return nil
+	}
+
+	if open {
+		e.doStack.Pop()
+	}
+	return e.skipLoop(start)
+}
+
+// runEXIT handles `EXIT DO`, which leaves the innermost DO loop,
+// continuing after its LOOP statement.
+func (e *Interpreter) runEXIT() error {
+
+	// Bump past the EXIT token
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.DO {
+		return fmt.Errorf("ERROR: EXIT should be : EXIT DO")
+	}
+
+	loop, err := e.doStack.Pop()
+	if err != nil {
+		return fmt.Errorf("EXIT DO outside of a DO loop")
+	}
+	return e.skipLoop(loop.condOffset)
+}
+
+// runFIELD sets the layout of the records of a file which was opened
+// for RANDOM access, each field of which is held in a string variable:
+//
+//  FIELD #1, 20 AS NAME$, 5 AS AGE$
+//
+// The length of each record is the total width of its fields.
+func (e *Interpreter) runFIELD() error {
+
+	// Bump past the FIELD token
+	e.offset++
+
+	n, err := e.channel("FIELD")
+	if err != nil {
+		return err
+	}
+	if _, ok := e.fieldDefs[n]; !ok {
+		return fmt.Errorf("FIELD: channel #%d is not open for RANDOM access", n)
+	}
+
+	var fields []FieldDef
+	for e.offset < len(e.program) && e.program[e.offset].Type == token.COMMA {
+		e.offset++
+
+		res := e.expr(true)
+		if res.Type() == object.ERROR {
+			return fmt.Errorf("FIELD: %s", res.(*object.ErrorObject).Value)
+		}
+		if res.Type() != object.NUMBER {
+			return fmt.Errorf("FIELD: the width must be a number")
+		}
+		width := res.(*object.NumberObject).Value
+		if width < 1 || width > maxRepeat || width != math.Trunc(width) {
+			return fmt.Errorf("FIELD: the width %s must be an integer between 1 and %d", formatNumber(width), maxRepeat)
+		}
+
+		if e.offset+1 >= len(e.program) || e.program[e.offset].Type != token.AS {
+			return fmt.Errorf("ERROR: FIELD should be : FIELD #channel, width AS var$")
+		}
+		name := e.program[e.offset+1]
+		if name.Type != token.IDENT || !strings.HasSuffix(name.Literal, "$") {
+			return fmt.Errorf("FIELD: expected a string variable, got %v", name)
+		}
+		if e.vars.IsConstant(name.Literal) {
+			return fmt.Errorf("FIELD: %s is a constant", name.Literal)
+		}
+		e.offset += 2
+
+		fields = append(fields, FieldDef{width: int(width), name: name.Literal})
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("ERROR: FIELD should be : FIELD #channel, width AS var$")
+	}
+
+	e.fieldDefs[n] = fields
+	return nil
+}
+
+// runForLoop handles a FOR loop
+func (e *Interpreter) runForLoop() error {
+	// we expect "ID = NUM to NUM [STEP NUM]"
+
+	// Bump past the FOR token
+	e.offset++
+
+	// We now expect a variable name.
+	target := e.program[e.offset]
+	e.offset++
+	if target.Type != token.IDENT {
+		return fmt.Errorf("Expected IDENT after FOR, got %v", target)
+	}
+	if e.vars.IsConstant(target.Literal) {
+		return fmt.Errorf("FOR: %s is a constant", target.Literal)
+	}
+
+	// Now an EQUALS
+	eq := e.program[e.offset]
+	e.offset++
+	if eq.Type != token.ASSIGN {
+		return fmt.Errorf("Expected = after 'FOR %s' , got %v", target.Literal, eq)
+	}
+
+	// Now an integer/variable
+	startI := e.program[e.offset]
+	e.offset++
+
+	var start float64
+	if startI.Type == token.INT {
+		v, err := strconv.ParseFloat(startI.Literal, 64)
+		if err != nil {
+			return fmt.Errorf("Failed to convert %s to an int %s", startI.Literal, err.Error())
+		}
+		start = v
+	} else if startI.Type == token.IDENT {
+
+		x := e.GetVariable(startI.Literal)
+		if x.Type() != object.NUMBER {
+			return fmt.Errorf("FOR: start-variable must be an integer!")
+		}
+		start = x.(*object.NumberObject).Value
+	} else {
+		return fmt.Errorf("Expected INT/VARIABLE after 'FOR %s=', got %v", target.Literal, startI)
+	}
+
+	// Now TO
+	to := e.program[e.offset]
+	e.offset++
+	if to.Type != token.TO {
+		return fmt.Errorf("Expected TO after 'FOR %s=%s', got %v", target.Literal, startI, to)
+	}
+
+	// Now an integer/variable
+	endI := e.program[e.offset]
+	e.offset++
+
+	var end float64
+
+	if endI.Type == token.INT {
+		v, err := strconv.ParseFloat(endI.Literal, 64)
+		if err != nil {
+			return fmt.Errorf("Failed to convert %s to an int %s", endI.Literal, err.Error())
+		}
+
+		end = v
+	} else if endI.Type == token.IDENT {
+
+		x := e.GetVariable(endI.Literal)
+		if x.Type() != object.NUMBER {
+			return fmt.Errorf("FOR: end-variable must be an integer!")
+		}
+		end = x.(*object.NumberObject).Value
+	} else {
+		return fmt.Errorf("Expected INT/VARIABLE after 'FOR %s=%s TO', got %v", target.Literal, startI, endI)
+	}
+
+	// Default step is 1.
+	step := 1.0
+
+	// Is the next token a step?
+	if e.program[e.offset].Type == token.STEP {
+		e.offset++
+
+		//
+		// The step may be any expression, such as a variable.
+		//
+		s := e.expr(true)
+		if s.Type() == object.ERROR {
+			return fmt.Errorf("FOR: STEP %s", s.(*object.ErrorObject).Value)
+		}
+		if s.Type() != object.NUMBER {
+			return fmt.Errorf("FOR: step must be a number")
+		}
+		step = s.(*object.NumberObject).Value
+		if step == 0 {
+			return fmt.Errorf("FOR: step must not be zero")
+		}
+	}
+
+	//
+	// Now we can record the important details of the for-loop
+	// in a hash.
+	//
+	// The key observersions here are that all the magic
+	// really involved in the FOR-loop happens at the point
+	// you interpret the "NEXT X" section.
+	//
+	// Handling the NEXT statement involves:
+	//
+	//  Incrementing the step-variable
+	//  Looking for termination
+	//  If not over then "jumping back".
+	//
+	// So for a for-loop we just record the start/end conditions
+	// and the address of the body of the loop - ie. the next
+	// token - so that the next-handler can GOTO there.
+	//
+	// It is almost beautifully elegent.
+	//
+	f := ForLoop{id: target.Literal,
+		offset: e.offset,
+		start:  start,
+		end:    end,
+		step:   step}
+
+	//
+	// Set the variable to the starting-value
+	//
+	e.SetVariable(target.Literal, &object.NumberObject{Value: start})
+
+	//
+	// And record our loop - keyed on the name of the variable
+	// which is used as the index.  This allows easy and natural
+	// nested-loops.
+	//
+	// Did I say this is elegent?
+	//
+	e.loops.Add(f)
+	return nil
+}
+
+// runGET reads a record from a file which was opened for RANDOM
+// access, storing its fields in the variables given to FIELD:
+//
+//  GET #1, 3
+//
+// Records are numbered from one, and a record beyond the end of the
+// file is read as spaces.
+func (e *Interpreter) runGET() error {
+
+	// Bump past the GET token
+	e.offset++
+
+	f, fields, offset, err := e.record("GET")
+	if err != nil {
+		return err
+	}
+
+	size := recordLength(fields)
+	buf := make([]byte, size)
+
+	read, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		e.setErrno(err)
+		return fmt.Errorf("GET: %s", err.Error())
+	}
+	for i := read; i < size; i++ {
+		buf[i] = ' '
+	}
+
+	for _, field := range fields {
+		e.SetVariable(field.name, &object.StringObject{Value: string(buf[:field.width])})
+		buf = buf[field.width:]
+	}
+	return nil
+}
+
+// runGOSUB handles a control-flow change
+func (e *Interpreter) runGOSUB() error {
+
+	// Skip the GOSUB-instruction itself
+	e.offset++
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing GOSUB")
+	}
+
+	// Get the target, which may be computed.
+	target, err := e.jumpTarget("GOSUB")
+	if err != nil {
+		return err
+	}
+
+	//
+	// We want to store the return address on our GOSUB-stack,
+	// so that the next RETURN will continue execution at the
+	// next instruction.
+	//
+	// Having evaluated the target we're at the end of the
+	// statement, so that will put us on the LINENO of the
+	// following-line.
+	//
+	e.gstack.Push(e.offset)
+
+	//
+	// Lookup the offset of the given line-number in our program/
+	//
+	offset, ok := e.lines[target]
+
+	//
+	// If we found it then use it.
+	//
+	// The LINENO token is skipped when we jump to it, so we
+	// record the line-number here.
+	//
+	if ok {
+		e.offset = offset
+		e.enterLine(e.lineAt(offset))
+		return nil
+	}
+
+	return fmt.Errorf("Failed to GOSUB %s", target)
+}
+
+// runGOTO handles a control-flow change
+func (e *Interpreter) runGOTO() error {
+
+	// Skip the GOTO-instruction
+	e.offset++
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing GOTO")
+	}
+
+	// Get the GOTO-target, which may be computed.
+	target, err := e.jumpTarget("GOTO")
+	if err != nil {
+		return err
+	}
+
+	//
+	// Lookup the offset of the given line-number in our program/
+	//
+	offset, ok := e.lines[target]
+
+	//
+	// If we found it then use it.
+	//
+	// The LINENO token is skipped when we jump to it, so we
+	// record the line-number here.
+	//
+	if ok {
+		e.offset = offset
+		e.enterLine(e.lineAt(offset))
+		return nil
+	}
+
+	return fmt.Errorf("Failed to GOTO %s", target)
+}
+
+// lineShorthand handles the shorthand form of IF statements, in which
+// a bare line-number after THEN or ELSE is equivalent to a GOTO, for
+// example:
+//
+//  IF A > 5 THEN 100 ELSE 200
+//
+// It returns true if we found a line-number, and jumped to it.
+func (e *Interpreter) lineShorthand() (bool, error) {
+
+	if e.offset >= len(e.program) {
+		return false, nil
+	}
+
+	target := e.program[e.offset]
+	if target.Type != token.INT {
+		return false, nil
+	}
+
+	// The line-number must be the whole statement.
+	if e.offset+1 < len(e.program) {
+		next := e.program[e.offset+1].Type
+		if next != token.NEWLINE && next != token.ELSE && next != token.COLON {
+			return false, nil
+		}
+	}
+
+	offset, ok := e.lines[target.Literal]
+	if ok {
+		e.offset = offset
+		e.enterLine(target.Literal)
+		e.jump = true
+		return true, nil
+	}
+
+	return true, fmt.Errorf("Failed to GOTO %s", target.Literal)
+}
+
+// runGRAPHICS switches to graphics mode, in which our output is sent
+// to the handler registered via SetGraphicsMode.
+func (e *Interpreter) runGRAPHICS() error {
+	if e.graphics == nil {
+		return fmt.Errorf("GRAPHICS: no graphics handler has been registered")
+	}
+	e.graphicsMode = true
+	return nil
+}
+
+// jumpTarget evaluates the expression following a GOTO or GOSUB
+// statement, returning the line-number, or label, to jump to.
+//
+// This allows computed jumps such as `GOTO X * 100`, as well as the
+// more usual `GOTO 100`, and `GOTO "start"`.
+func (e *Interpreter) jumpTarget(name string) (string, error) {
+
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return "", fmt.Errorf("%s: %s", name, res.(*object.ErrorObject).Value)
+	}
+
+	// A string is the name of a label
+	if res.Type() == object.STRING {
+		return res.(*object.StringObject).Value, nil
+	}
+
+	// We expect the target to be an int
+	if res.Type() != object.NUMBER {
+		return "", fmt.Errorf("ERROR: %s should be followed by an integer", name)
+	}
+	n := res.(*object.NumberObject).Value
+	if n != math.Trunc(n) {
+		return "", fmt.Errorf("ERROR: %s target %s is not an integer", name, formatNumber(n))
+	}
+
+	return formatNumber(n), nil
+}
+
+// runINPUT handles input of numbers from the user.
+//
+// NOTE:
+//   INPUT "Foo", a   -> Reads an integer
+//   INPUT "Foo", a$  -> Reads a string
+func (e *Interpreter) runINPUT() error {
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing INPUT")
+	}
+
+	// Skip the INPUT-instruction
+	e.offset++
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing INPUT")
+	}
+
+	// Are we reading from a file?
+	if e.program[e.offset].Type == token.HASH {
+		return e.inputFile()
+	}
+
+	// Get the prompt
+	prompt := e.program[e.offset]
+	e.offset++
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing INPUT")
+	}
+
+	// We expect a comma
+	comma := e.program[e.offset]
+	e.offset++
+	if comma.Type != token.COMMA {
+		return fmt.Errorf("ERROR: INPUT should be : INPUT \"prompt\",var")
+	}
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing INPUT")
+	}
+
+	// Now the ID
+	ident := e.program[e.offset]
+	e.offset++
+	if ident.Type != token.IDENT {
+		return fmt.Errorf("ERROR: INPUT should be : INPUT \"prompt\",var")
+	}
+	if e.vars.IsConstant(ident.Literal) {
+		return fmt.Errorf("INPUT: %s is a constant", ident.Literal)
+	}
+
+	//
+	// A numeric variable may be followed by the minimum and
+	// maximum values which are acceptable.
+	//
+	var min, max float64
+	ranged := false
+	if e.offset < len(e.program) && e.program[e.offset].Type == token.COMMA {
+		e.offset++
+
+		if strings.HasSuffix(ident.Literal, "$") {
+			return fmt.Errorf("INPUT: a range may only be given for a number")
+		}
+
+		lo := e.expr(true)
+		if lo.Type() != object.NUMBER {
+			return fmt.Errorf("INPUT: the minimum value must be a number")
+		}
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			return fmt.Errorf("ERROR: INPUT should be : INPUT \"prompt\",var,min,max")
+		}
+		e.offset++
+		hi := e.expr(true)
+		if hi.Type() != object.NUMBER {
+			return fmt.Errorf("INPUT: the maximum value must be a number")
+		}
+
+		min = lo.(*object.NumberObject).Value
+		max = hi.(*object.NumberObject).Value
+		ranged = true
+	}
+
+	//
+	// A variable with a `%` suffix must hold an integer.
+	//
+	integer := strings.HasSuffix(ident.Literal, "%")
+
+	for {
+
+		//
+		// Print the prompt
+		//
+		e.print(prompt.Literal)
+
+		//
+		// Read the input from the user.
+		//
+		input, readErr := e.STDIN.ReadString('\n')
+		input = strings.TrimRight(input, "\n")
+
+		//
+		// The user will have pressed return, so we're now at the
+		// start of a line.
+		//
+		e.printColumn = 0
+
+		//
+		// Now we handle the type-conversion.
+		//
+		if strings.HasSuffix(ident.Literal, "$") {
+			// We set a string
+			e.SetVariable(ident.Literal, &object.StringObject{Value: input})
+			return nil
+		}
+
+		// We set an int
+		i, err := strconv.ParseFloat(input, 64)
+
+		// Without validation a bogus number is an error.
+		if err != nil && !integer && !ranged {
+			return err
+		}
+
+		if err == nil &&
+			(!integer || i == math.Trunc(i)) &&
+			(!ranged || (i >= min && i <= max)) {
+
+			//
+			// Set the value
+			//
+			e.SetVariable(ident.Literal, &object.NumberObject{Value: i})
+			return nil
+		}
+
+		//
+		// The input was invalid, so we try again, unless
+		// there is nothing more to read.
+		//
+		if readErr != nil {
+			return fmt.Errorf("INPUT: %s", readErr.Error())
+		}
+		e.print("?REDO FROM START\n")
+	}
+}
+
+// inputFile reads a line from a file opened by OPEN, storing it in the
+// given variable:
+//
+//  INPUT #1, A$
+//
+// The offset is expected to be at the channel.
+func (e *Interpreter) inputFile() error {
+
+	n, err := e.channel("INPUT")
+	if err != nil {
+		return err
+	}
+
+	reader, ok := e.fileReaders[n]
+	if !ok {
+		return fmt.Errorf("INPUT: channel #%d is not open for input", n)
+	}
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+		return fmt.Errorf("ERROR: INPUT should be : INPUT #channel,var")
+	}
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.IDENT {
+		return fmt.Errorf("ERROR: INPUT should be : INPUT #channel,var")
+	}
+	ident := e.program[e.offset]
+	e.offset++
+
+	if e.vars.IsConstant(ident.Literal) {
+		return fmt.Errorf("INPUT: %s is a constant", ident.Literal)
+	}
+
+	input, err := reader.ReadString('\n')
+	if err != nil && input == "" {
+		e.setErrno(err)
+		if err == io.EOF {
+			return fmt.Errorf("INPUT: end of file reading channel #%d", n)
+		}
+		return fmt.Errorf("INPUT: %s", err.Error())
+	}
+	input = strings.TrimRight(input, "\r\n")
+
+	if strings.HasSuffix(ident.Literal, "$") {
+		e.SetVariable(ident.Literal, &object.StringObject{Value: input})
+		return nil
+	}
+
+	i, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		return fmt.Errorf("INPUT: invalid number '%s' read from channel #%d", input, n)
+	}
+	e.SetVariable(ident.Literal, &object.NumberObject{Value: i})
+	return nil
+}
+
+// condition evaluates the condition of an IF or WHILE statement,
+// leaving the offset at the token which follows it.
+//
+// The general form of a condition is a comparison, however we also
+// want to allow people to write:
+//
+//  IF A=3 OR A=4 THEN ..
+//
+// So we'll special case things here.
+func (e *Interpreter) condition() (bool, error) {
+
+	// Get the result of the comparison-function
+	// against the two arguments.
+	res := e.compare(false)
+
+	// Error?
+	if res.Type() == object.ERROR {
+		return false, fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+	}
+
+	//
+	// We need a boolean result, so we convert here.
+	//
+	result := false
+	if res.Type() == object.NUMBER {
+		result = (res.(*object.NumberObject).Value == 1)
+	}
+
+	for e.offset < len(e.program) &&
+		(e.program[e.offset].Type == token.AND ||
+			e.program[e.offset].Type == token.OR) {
+
+		op := e.program[e.offset]
+		e.offset++
+
+		//
+		// See what the next comparison looks like.
+		//
+		extra := e.compare(false)
+
+		if extra.Type() == object.ERROR {
+			return false, fmt.Errorf("%s", extra.(*object.ErrorObject).Value)
+		}
+
+		//
+		// We need a boolean answer.
+		//
+		extraResult := false
+		if extra.Type() == object.NUMBER {
+			extraResult = (extra.(*object.NumberObject).Value == 1)
+		}
+
+		//
+		// Update our result appropriately.
+		//
+		if op.Type == token.AND {
+			result = result && extraResult
+		}
+		if op.Type == token.OR {
+			result = result || extraResult
+		}
+	}
+
+	return result, nil
+}
+
+// runIF handles conditional testing.
+//
+// There are a lot of choices to be made when it comes to IF, such as
+// whether to support an ELSE section or not.  And what to allow
+// inside the matching section generally:
+//
+// A single statement?
+// A block?
+//
+// Here we allow:
+//
+//  IF $EXPR THEN $STATEMENTS ELSE $STATEMENTS NEWLINE
+//
+// $STATEMENTS may be several statements separated by ":".
+//
+func (e *Interpreter) runIF() error {
+
+	// Bump past the IF token
+	e.offset++
+
+	// Evaluate the condition
+	result, err := e.condition()
+	if err != nil {
+		return err
+	}
+
+	// We now expect THEN
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing IF")
+	}
+	target := e.program[e.offset]
+	e.offset++
+
+	//
+	// Now we're in the THEN section.
+	//
+	if target.Type != token.THEN {
+		return fmt.Errorf("Expected THEN after IF EXPR, got %v", target)
+	}
+
+	//
+	// OK so if our comparison succeeded we can execute the single
+	// statement between THEN + ELSE
+	//
+	// Otherwise between ELSE + Newline
+	//
+	if result {
+
+		//
+		// `IF .. THEN 100` is shorthand for `IF .. THEN GOTO 100`.
+		//
+		if jumped, err := e.lineShorthand(); jumped || err != nil {
+			return err
+		}
+
+		//
+		// Execute the statements
+		//
+		err := e.runStatements()
+		if err != nil {
+			return err
+		}
+
+		//
+		// If the user made a jump then we'll
+		// abort here, because if the single-statement modified our
+		// flow control we're screwed.
+		//
+		// (Because we'll start searching from the NEW location.)
+		//
+		//
+		if e.jump {
+			return nil
+		}
+
+		//
+		// We get the next token, it should either be ELSE + expr
+		// or newline.
+		//
+		// Skip until we hit the end of line.
+		//
+		if e.offset >= len(e.program) {
+			return fmt.Errorf("Hit end of program processing IF")
+		}
+
+		tmp := e.program[e.offset]
+		e.offset++
+		for tmp.Type != token.NEWLINE {
+
+			if e.offset >= len(e.program) {
+				return fmt.Errorf("Hit end of program processing IF")
+			}
+			tmp = e.program[e.offset]
+			e.offset++
+		}
+
+		// Leave the offset at the newline, so that the next
+		// line-number isn't skipped.
+		e.offset--
+	} else {
+
+		//
+		// Here the test failed.
+		//
+		// Skip over the truthy-condition until we either
+		// hit ELSE, or the newline that will terminate our
+		// IF-statement.
+		//
+		//
+		for {
+
+			if e.offset >= len(e.program) {
+				return fmt.Errorf("Hit end of program processing IF")
+			}
+
+			tmp := e.program[e.offset]
+			e.offset++
+
+			// If we hit the newline then we're done
+			if tmp.Type == token.NEWLINE {
+				e.offset--
+				return nil
+			}
+
+			// Otherwise did we hit the else?
+			if tmp.Type == token.ELSE {
+
+				// `ELSE 100` is shorthand for `ELSE GOTO 100`.
+				if jumped, err := e.lineShorthand(); jumped || err != nil {
+					return err
+				}
+
+				// Execute the statements, then return.
+				return e.runStatements()
+			}
+		}
+	}
+
+	return nil
+}
+
+// runStatements executes the statements of one branch of an IF, which
+// are separated by ":", stopping at the end of the line, at an ELSE,
+// or if one of them jumped.
+//
+// The offset is left at the token which terminated the last statement,
+// as our caller will bump it.
+func (e *Interpreter) runStatements() error {
+
+	for {
+		err := e.RunOnce()
+		if err != nil {
+			return err
+		}
+
+		//
+		// Help me, I'm in Hell.
+		//
+		e.offset -= 1
+
+		if e.jump {
+			return nil
+		}
+
+		//
+		// Continue only if there's another statement following a
+		// ":" - we allow "PRINT 1 : ELSE", and a trailing ":".
+		//
+		if e.offset+1 >= len(e.program) ||
+			e.program[e.offset].Type != token.COLON {
+			return nil
+		}
+		next := e.program[e.offset+1].Type
+		if next == token.ELSE || next == token.NEWLINE {
+			return nil
+		}
+		e.offset++
+	}
+}
+
+// runLABEL handles a LABEL statement, which names a position in the
+// program so that it may be the target of GOTO or GOSUB:
+//
+//  10 LABEL "start"
+//  20 GOTO "start"
+//
+// The labels are found when the program is loaded, so at runtime
+// this does nothing, except to reject names which are numbers, as they
+// would be confused with line-numbers.
+func (e *Interpreter) runLABEL() error {
+
+	// Bump past the LABEL token
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.STRING {
+		return fmt.Errorf("LABEL should be followed by a string")
+	}
+	name := e.program[e.offset].Literal
+	if _, err := strconv.ParseFloat(name, 64); err == nil {
+		return fmt.Errorf("LABEL \"%s\" may not be a number", name)
+	}
+	return nil
+}
+
+// runLET handles variable creation/updating.
+func (e *Interpreter) runLET() error {
+
+	// Bump past the LET token
+	e.offset++
+
+	// We now expect an ID
+	target := e.program[e.offset]
+	e.offset++
+	if target.Type != token.IDENT {
+		return fmt.Errorf("Expected IDENT after LET, got %v", target)
+	}
+	if e.vars.IsConstant(target.Literal) {
+		return fmt.Errorf("LET: %s is a constant", target.Literal)
+	}
+
+	// Are we setting an element of an array?
+	isArray := false
+	index := 0
+	if e.program[e.offset].Type == token.LBRACKET {
+		isArray = true
+		indexes, err := e.arrayIndexes()
+		if err != nil {
+			return fmt.Errorf("LET: %s", err.Error())
+		}
+		index, err = e.vars.Offset(target.Literal, indexes)
+		if err != nil {
+			return fmt.Errorf("LET: %s", err.Error())
+		}
+	}
+
+	// Now "="
+	assign := e.program[e.offset]
+	if assign.Type != token.ASSIGN {
+		return fmt.Errorf("Expected assignment after LET x, got %v", assign)
+	}
+	e.offset++
+
+	// now we're at the expression/value/whatever, which might be
+	// a slice of an array if we're not setting an element.
+	e.allowSlice = !isArray
+	res := e.expr(true)
+	e.allowSlice = false
+
+	// Did we get an error in the expression?
+	if res.Type() == object.ERROR {
+		return fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+	}
+
+	// Store the result
+	if res.Type() == object.ARRAY {
+		elements := res.(*object.ArrayObject).Value
+		for _, val := range elements {
+			if strings.HasSuffix(target.Literal, "$") != (val.Type() == object.STRING) {
+				return fmt.Errorf("LET: type mismatch storing %v in %s", val, target.Literal)
+			}
+		}
+		e.vars.SetArray(target.Literal, elements)
+		return nil
+	}
+	if isArray {
+		if strings.HasSuffix(target.Literal, "$") != (res.Type() == object.STRING) {
+			return fmt.Errorf("LET: type mismatch storing %v in %s", res, target.Literal)
+		}
+		return e.vars.SetIndex(target.Literal, index, res)
+	}
+	e.SetVariable(target.Literal, res)
+	return nil
+}
+
+// runLOOP handles the end of a DO loop, which jumps back to the DO
+// statement, unless its condition fails.
+func (e *Interpreter) runLOOP() error {
+
+	loop, err := e.doStack.Peek()
+	if err != nil {
+		return fmt.Errorf("LOOP without DO")
+	}
+
+	// Bump past the LOOP token
+	e.offset++
+
+	result, err := e.loopCondition("LOOP")
+	if err != nil {
+		return err
+	}
+
+	if !result {
+		e.doStack.Pop()
+		return nil
+	}
+
+	//
+	// If the loop has no condition at the top we continue with its
+	// body, otherwise we'll be bumped to the DO statement to test
+	// the condition again.  Either might not be on the same line
+	// as we are.
+	//
+	if loop.condType == "" {
+		e.offset = loop.bodyOffset
+		e.lineno = e.lineAt(loop.bodyOffset)
+		return nil
+	}
+	e.offset = loop.condOffset - 1
+	e.lineno = e.lineAt(loop.condOffset)
+	return nil
+}
+
+// loopCondition evaluates the optional WHILE or UNTIL condition which
+// follows DO or LOOP, returning true if the loop should continue.
+func (e *Interpreter) loopCondition(name string) (bool, error) {
+
+	if e.offset >= len(e.program) {
+		return true, nil
+	}
+
+	kind := e.program[e.offset].Type
+	if kind != token.WHILE && kind != token.UNTIL {
+		return true, nil
+	}
+	e.offset++
+
+	result, err := e.condition()
+	if err != nil {
+		return false, fmt.Errorf("%s %s: %s", name, kind, err.Error())
+	}
+
+	if kind == token.UNTIL {
+		return !result, nil
+	}
+	return result, nil
+}
+
+// skipLoop moves to the end of the LOOP statement which matches the DO
+// at the given offset.
+func (e *Interpreter) skipLoop(start int) error {
+
+	end := e.matchDo(start)
+	if end < 0 {
+		return fmt.Errorf("DO without LOOP")
+	}
+
+	// Skip any condition, and we'll be bumped past the end of the
+	// statement.
+	for end < len(e.program) &&
+		e.program[end].Type != token.NEWLINE &&
+		e.program[end].Type != token.COLON {
+		end++
+	}
+	e.offset = end
+	e.lineno = e.lineAt(end)
+	return nil
+}
+
+// runNEXT handles the NEXT statement
+func (e *Interpreter) runNEXT() error {
+	// Bump past the NEXT token
+	e.offset++
+
+	// Get the identifier
+	target := e.program[e.offset]
+	e.offset++
+	if target.Type != token.IDENT {
+		return fmt.Errorf("Expected IDENT after NEXT in FOR loop, got %v", target)
+	}
+
+	// OK we've found the tail of a loop
+	//
+	// We need to bump the value of the given variable by the offset
+	// and compare it against the max.
+	//
+	// If the max hasn't finished we loop around again.
+	//
+	// If it has we remove the for-loop
+	//
+	data := e.loops.Get(target.Literal)
+	if data.id == "" {
+		return fmt.Errorf("NEXT %s found - without opening FOR", target.Literal)
+	}
+
+	//
+	// Get the variable value, and increase it.
+	//
+	cur := e.GetVariable(target.Literal)
+	if cur.Type() != object.NUMBER {
+		return fmt.Errorf("NEXT variable %s is not a number!", target.Literal)
+	}
+	iVal := cur.(*object.NumberObject).Value
+
+	//
+	// Increment the number.
+	//
+	iVal += data.step
+
+	//
+	// Set it
+	//
+	e.SetVariable(target.Literal, &object.NumberObject{Value: iVal})
+
+	//
+	// Have we finished?  The end-number is inclusive, so we're
+	// only done once we've moved beyond it.
+	//
+	if (data.step > 0 && iVal > data.end) ||
+		(data.step < 0 && iVal < data.end) {
+		e.loops.Remove(target.Literal)
+		return nil
+	}
+
+	//
+	// Otherwise loop again
+	//
+	// The body of the loop might begin upon the same line as
+	// the FOR statement, so we record the line we're now in.
+	//
+	e.offset = data.offset
+	e.lineno = e.lineAt(data.offset)
+	return nil
+}
+
+// runON handles computed multi-way branching:
+//
+//  ON X GOTO 100, 200, 300
+//  ON X GOSUB 100, 200, 300
+//
+// Which jump to the first line if X is 1, the second if X is 2, etc.
+// If X is zero, or larger than the number of lines, execution continues
+// with the next statement.
+func (e *Interpreter) runON() error {
+
+	// Bump past the ON token
+	e.offset++
+
+	// ON ERROR GOTO is handled separately.
+	if e.offset < len(e.program) && e.program[e.offset].Type == token.ERROR {
+		return e.runONERROR()
+	}
+
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return fmt.Errorf("ON: %s", res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.NUMBER {
+		return fmt.Errorf("ON: the index must be a number")
+	}
+	n := res.(*object.NumberObject).Value
+	if n < 0 || n != math.Trunc(n) {
+		return fmt.Errorf("ON: the index must be a positive integer, got %s", formatNumber(n))
+	}
+
+	// Now GOTO, or GOSUB
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing ON")
+	}
+	kind := e.program[e.offset]
+	if kind.Type != token.GOTO && kind.Type != token.GOSUB {
+		return fmt.Errorf("Expected GOTO or GOSUB after ON, got %v", kind)
+	}
+
+	// Now the comma-separated line-numbers
+	var targets []string
+	for {
+		e.offset++
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.INT {
+			return fmt.Errorf("ON: expected a line-number after %s", kind.Literal)
+		}
+		targets = append(targets, e.program[e.offset].Literal)
+
+		e.offset++
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			break
+		}
+	}
+
+	// Nothing to do?
+	if n == 0 || n > float64(len(targets)) {
+		return nil
+	}
+	target := targets[int(n)-1]
+
+	offset, ok := e.lines[target]
+	if !ok {
+		return fmt.Errorf("Failed to %s %s", kind.Literal, target)
+	}
+
+	// We're at the end of the statement, which is where RETURN
+	// should continue.
+	if kind.Type == token.GOSUB {
+		e.gstack.Push(e.offset)
+	}
+
+	e.offset = offset
+	e.enterLine(e.lineAt(offset))
+	e.jump = true
+	return nil
+}
+
+// runONERROR sets the line to which we jump when a runtime error
+// occurs, rather than terminating the program:
+//
+//  ON ERROR GOTO 900
+//
+// The handler may find the error-message in ERR$, and the line upon
+// which it occurred in ERL.  Errors within the handler are not caught,
+// until it executes RESUME, or ON ERROR GOTO again.
+//
+// `ON ERROR GOTO 0` removes the handler.
+//
+// The error-message may instead be stored in a variable of the
+// program's choosing, in which case ERR$ and ERL are left alone:
+//
+//  ON ERROR SET E$ GOTO 900
+func (e *Interpreter) runONERROR() error {
+
+	// Bump past the ERROR token
+	e.offset++
+
+	// SET isn't a keyword, so that existing programs may continue
+	// to use it as a variable.
+	name := ""
+	if e.offset+1 < len(e.program) && e.program[e.offset].Type == token.IDENT &&
+		strings.ToUpper(e.program[e.offset].Literal) == "SET" {
+		e.offset++
+
+		tok := e.program[e.offset]
+		if tok.Type != token.IDENT || !strings.HasSuffix(tok.Literal, "$") {
+			return fmt.Errorf("ON ERROR SET: expected a string variable, got %v", tok)
+		}
+		if e.vars.IsConstant(tok.Literal) {
+			return fmt.Errorf("ON ERROR SET: %s is a constant", tok.Literal)
+		}
+		name = tok.Literal
+		e.offset++
+	}
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.GOTO {
+		return fmt.Errorf("ERROR: ON ERROR should be : ON ERROR [SET var$] GOTO line")
+	}
+	e.offset++
+
+	target, err := e.jumpTarget("ON ERROR GOTO")
+	if err != nil {
+		return err
+	}
+
+	if target == "0" {
+		e.errorHandlerLine = ""
+		e.errorVarName = ""
+		e.inErrorHandler = false
+		return nil
+	}
+
+	if _, ok := e.lines[target]; !ok {
+		return fmt.Errorf("Failed to ON ERROR GOTO %s", target)
+	}
+	e.errorHandlerLine = target
+	e.errorVarName = name
+	e.inErrorHandler = false
+	return nil
+}
+
+// handleError passes a runtime error to the handler set by ON ERROR
+// GOTO, returning false if there is none, or we're already within it.
+//
+// The offset of the statement which caused the error is recorded, so
+// that RESUME may return to it.
+func (e *Interpreter) handleError(err error, origin int) bool {
+
+	if e.errorHandlerLine == "" || e.inErrorHandler {
+		return false
+	}
+
+	offset, ok := e.lines[e.errorHandlerLine]
+	if !ok {
+		return false
+	}
+
+	msg := err.Error()
+	if r, ok := err.(*RuntimeError); ok {
+		msg = r.Message
+	}
+	line, _ := strconv.ParseFloat(e.lineno, 64)
+
+	if e.errorVarName != "" {
+		e.SetVariable(e.errorVarName, &object.StringObject{Value: msg})
+	} else {
+		e.vars.Set("ERR$", &object.StringObject{Value: msg})
+		e.vars.Set("ERL", &object.NumberObject{Value: line})
+	}
+	e.inErrorHandler = true
+	e.errorOriginOffset = origin
+
+	// As with GOTO we skip the line-number, having recorded it.
+	e.offset = offset + 1
+	e.enterLine(e.lineAt(offset))
+	return true
+}
+
+// runOPEN opens a file, so that it may be written to with PRINT, or
+// read from with INPUT, or have records read and written by GET and
+// PUT.
+//
+// The general form is:
+//
+//  OPEN "name" FOR OUTPUT AS #1
+//  OPEN "name" FOR INPUT AS #2
+//  OPEN "name" FOR RANDOM AS #3
+//
+// Opening a file for OUTPUT replaces any existing contents, while
+// opening one for RANDOM access creates it if it doesn't exist.
+func (e *Interpreter) runOPEN() error {
+
+	if e.sandbox {
+		return fmt.Errorf("OPEN: files may not be accessed in sandbox mode")
+	}
+
+	// Bump past the OPEN token
+	e.offset++
+
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return fmt.Errorf("OPEN: %s", res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.STRING {
+		return fmt.Errorf("OPEN: the filename must be a string")
+	}
+	path := res.(*object.StringObject).Value
+
+	if e.offset+2 >= len(e.program) ||
+		e.program[e.offset].Type != token.FOR ||
+		e.program[e.offset+2].Type != token.AS {
+		return fmt.Errorf("ERROR: OPEN should be : OPEN \"name\" FOR OUTPUT|INPUT|RANDOM AS #channel")
+	}
+	mode := e.program[e.offset+1].Type
+	if mode != token.OUTPUT && mode != token.INPUT && mode != token.RANDOM {
+		return fmt.Errorf("OPEN: unknown mode %s", e.program[e.offset+1].Literal)
+	}
+	e.offset += 3
+
+	n, err := e.channel("OPEN")
+	if err != nil {
+		return err
+	}
+	if _, ok := e.fileHandles[n]; ok {
+		return fmt.Errorf("OPEN: channel #%d is already open", n)
+	}
+
+	var f *os.File
+	switch mode {
+	case token.OUTPUT:
+		f, err = os.Create(path)
+	case token.RANDOM:
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	default:
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		e.setErrno(err)
+		return fmt.Errorf("OPEN: %s", err.Error())
+	}
+
+	e.fileHandles[n] = f
+	if mode == token.INPUT {
+		e.fileReaders[n] = bufio.NewReader(f)
+	}
+	if mode == token.RANDOM {
+		e.fieldDefs[n] = nil
+	}
+	return nil
+}
+
+// runPRINT handles a print!
+// NOTE:
+//  Print basically swallows input up to the next newline.
+//  However it also stops at ":", or ELSE, to cope with the case
+//  of printing in an IF
+//
+//  Each item printed may be an expression, such as `PRINT A * 2`,
+//  anything else is reported as an error.
+//
+//  Items separated by ";" are printed adjacently, whereas a ","
+//  advances the output to the next print-zone, which are 14 columns
+//  wide.
+//
+//  Once everything has been printed a newline is output - unless the
+//  statement ended with one of those separators.  So a bare PRINT
+//  outputs a blank line, and `PRINT "Name? ";` leaves the cursor at
+//  the end of the prompt.
+//
+//  `PRINT USING "###.##"; A; B` formats each of the numbers which
+//  follow with the given mask, via formatUsing, and doesn't use the
+//  print-zones.
+func (e *Interpreter) runPRINT() error {
+
+	// Bump past the PRINT token
+	e.offset++
 
 	//
-	// Now we're in the THEN section.
+	// If we're printing to a file we temporarily replace our output
+	// with it.
 	//
-	if target.Type != token.THEN {
-		return fmt.Errorf("Expected THEN after IF EXPR, got %v", target)
+	var file *errorWriter
+	if e.offset < len(e.program) && e.program[e.offset].Type == token.HASH {
+
+		n, err := e.channel("PRINT")
+		if err != nil {
+			return err
+		}
+
+		f, ok := e.fileHandles[n]
+		_, random := e.fieldDefs[n]
+		if !ok || e.fileReaders[n] != nil || random {
+			return fmt.Errorf("PRINT: channel #%d is not open for output", n)
+		}
+
+		if e.offset < len(e.program) && e.program[e.offset].Type == token.COMMA {
+			e.offset++
+		}
+
+		file = &errorWriter{w: f}
+		output, column, graphics := e.output, e.printColumn, e.graphicsMode
+		e.output, e.printColumn, e.graphicsMode = file, 0, false
+		defer func() {
+			e.output, e.printColumn, e.graphicsMode = output, column, graphics
+		}()
+	}
+
+	// The mask given to USING, if any.
+	using := false
+	mask := ""
+	if e.offset < len(e.program) && e.program[e.offset].Type == token.USING {
+
+		// Bump past the USING token
+		e.offset++
+
+		val := e.expr(true)
+		if val.Type() == object.ERROR {
+			return fmt.Errorf("PRINT USING: %s", val.(*object.ErrorObject).Value)
+		}
+		if val.Type() != object.STRING {
+			return fmt.Errorf("PRINT USING: the mask must be a string")
+		}
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.SEMICOLON {
+			return fmt.Errorf("ERROR: PRINT USING should be : PRINT USING \"###.##\"; value")
+		}
+		e.offset++
+
+		using = true
+		mask = val.(*object.StringObject).Value
+	}
+
+	//
+	// Now print the items, until we hit the end of the statement.
+	//
+	// The output is collected first, so that nothing is shown if
+	// the statement turns out to be bogus.
+	//
+	var buf strings.Builder
+	column := e.printColumn
+	e.printBuffer = &buf
+	newline, err := e.printItems(using, mask)
+	e.printBuffer, e.printColumn = nil, column
+
+	if err != nil {
+		return err
+	}
+	if e.offset < len(e.program) {
+		switch tok := e.program[e.offset]; tok.Type {
+		case token.NEWLINE, token.COLON, token.ELSE:
+		default:
+			return fmt.Errorf("Unexpected token in PRINT: %v", tok)
+		}
+	}
+
+	e.print(buf.String())
+	if newline {
+		e.print("\n")
+	}
+
+	if file != nil && file.err != nil {
+		e.setErrno(file.err)
+		return fmt.Errorf("PRINT: %s", file.err.Error())
+	}
+	return nil
+}
+
+// runPUT writes a record to a file which was opened for RANDOM
+// access, from the variables given to FIELD:
+//
+//  PUT #1, 3
+//
+// Records are numbered from one.  Each variable is truncated, or padded
+// with spaces, to the width of its field.
+func (e *Interpreter) runPUT() error {
+
+	// Bump past the PUT token
+	e.offset++
+
+	f, fields, offset, err := e.record("PUT")
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, field := range fields {
+		val := ""
+		if str, ok := e.vars.Get(field.name).(*object.StringObject); ok {
+			val = str.Value
+		}
+		if len(val) > field.width {
+			val = val[:field.width]
+		}
+		buf = append(buf, val...)
+		buf = append(buf, strings.Repeat(" ", field.width-len(val))...)
+	}
+
+	_, err = f.WriteAt(buf, offset)
+	if err != nil {
+		e.setErrno(err)
+		return fmt.Errorf("PUT: %s", err.Error())
+	}
+	return nil
+}
+
+// printItems prints the items of a PRINT statement, or of PRINT$, each
+// of which is an expression, stopping at the first token which is
+// neither an item nor a separator.
+//
+// Items separated by ";" are printed adjacently, whereas a "," advances
+// the output to the next print-zone, unless a mask was given to USING.
+//
+// It returns false if the last item was followed by a separator, in
+// which case PRINT doesn't end with a newline.
+func (e *Interpreter) printItems(using bool, mask string) (bool, error) {
+
+	newline := true
+
+	for e.offset < len(e.program) {
+
+		tok := e.program[e.offset]
+
+		switch tok.Type {
+		case token.SEMICOLON:
+			newline = false
+		case token.COMMA:
+			if !using {
+				e.print(strings.Repeat(" ", printZone-e.printColumn%printZone))
+			}
+			newline = false
+		case token.STRING, token.INT, token.IDENT, token.BUILTIN,
+			token.FN, token.LBRACKET, token.MINUS:
+
+			//
+			// Print the value of the expression which begins
+			// here, which might be a single literal/variable,
+			// and which will advance us past its end.
+			//
+			val := e.expr(true)
+			if val.Type() == object.ERROR {
+				return false, fmt.Errorf("%s", val.(*object.ErrorObject).Value)
+			}
+			if using {
+				if val.Type() != object.NUMBER {
+					return false, fmt.Errorf("PRINT USING: expected a number, got %s", val.Type())
+				}
+				e.print(formatUsing(mask, val.(*object.NumberObject).Value))
+			} else {
+				e.printValue(val)
+			}
+			newline = true
+			continue
+		default:
+			return newline, nil
+		}
+		e.offset++
+	}
+
+	return newline, nil
+}
+
+// printString handles PRINT$, which formats its arguments as the PRINT
+// statement would, returning the result as a string rather than
+// displaying it:
+//
+//  LET A$ = PRINT$(N; " items", "Total")
+//
+// The arguments may be bracketed, and otherwise continue for as long as
+// PRINT would accept them.
+func (e *Interpreter) printString() object.Object {
+
+	// Bump past the PRINT$ token
+	e.offset++
+
+	var buf strings.Builder
+	output, column, graphics, pending := e.output, e.printColumn, e.graphicsMode, e.printBuffer
+	e.output, e.printColumn, e.graphicsMode, e.printBuffer = &buf, 0, false, nil
+	defer func() {
+		e.output, e.printColumn, e.graphicsMode, e.printBuffer = output, column, graphics, pending
+	}()
+
+	bracketed := e.bracketedArgs(-1)
+	if bracketed {
+		e.offset++
+	}
+
+	_, err := e.printItems(false, "")
+	if err != nil {
+		return object.Error("%s", err.Error())
+	}
+
+	if bracketed {
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.RBRACKET {
+			return object.Error("Expected ',' or ')' in arguments to PRINT$, got %v", e.program[e.offset])
+		}
+		e.offset++
+	}
+
+	return &object.StringObject{Value: buf.String()}
+}
+
+// runRANDOMIZE seeds the random numbers returned by RND.
+//
+// The general form is:
+//
+//  RANDOMIZE
+//  RANDOMIZE 1234
+//
+// Without an argument the seed is taken from the current time, while
+// a given seed results in the same sequence of numbers upon each run.
+func (e *Interpreter) runRANDOMIZE() error {
+
+	seed := time.Now().UnixNano()
+
+	if e.offset+1 < len(e.program) {
+		switch e.program[e.offset+1].Type {
+		case token.NEWLINE, token.COLON, token.ELSE:
+		default:
+
+			// Bump past the RANDOMIZE token
+			e.offset++
+
+			res := e.expr(true)
+			if res.Type() == object.ERROR {
+				return fmt.Errorf("RANDOMIZE: %s", res.(*object.ErrorObject).Value)
+			}
+			if res.Type() != object.NUMBER {
+				return fmt.Errorf("RANDOMIZE: the seed must be a number")
+			}
+			n := res.(*object.NumberObject).Value
+			if n != math.Trunc(n) {
+				return fmt.Errorf("RANDOMIZE: the seed must be an integer, got %s", formatNumber(n))
+			}
+			seed = int64(n)
+		}
+	}
+
+	e.rng = rand.New(rand.NewSource(seed))
+	return nil
+}
+
+// runREAD reads the next values from our DATA statements, storing
+// them in the given variables:
+//
+//  READ A, B$
+func (e *Interpreter) runREAD() error {
+
+	for {
+		// Bump past the READ token, or the comma.
+		e.offset++
+
+		if e.offset >= len(e.program) {
+			return fmt.Errorf("Hit end of program processing READ")
+		}
+
+		target := e.program[e.offset]
+		if target.Type != token.IDENT {
+			return fmt.Errorf("Expected IDENT after READ, got %v", target)
+		}
+		if e.vars.IsConstant(target.Literal) {
+			return fmt.Errorf("READ: %s is a constant", target.Literal)
+		}
+
+		val, err := e.readData("READ", target.Literal)
+		if err != nil {
+			return err
+		}
+		e.SetVariable(target.Literal, val)
+
+		// Another variable to read?
+		e.offset++
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			return nil
+		}
 	}
+}
 
-	//
-	// OK so if our comparison succeeded we can execute the single
-	// statement between THEN + ELSE
-	//
-	// Otherwise between ELSE + Newline
-	//
-	if result {
+// readData returns the next value recorded by DATA, which is to be
+// stored in the named variable, so must be of the matching type.
+func (e *Interpreter) readData(stmt string, name string) (object.Object, error) {
 
-		//
-		// Execute single statement
-		//
-		e.RunOnce()
+	if e.dataOffset >= len(e.data) {
+		return nil, fmt.Errorf("%s: out of DATA reading %s", stmt, name)
+	}
+	val := e.data[e.dataOffset]
+	e.dataOffset++
 
-		//
-		// Help me, I'm in Hell.
-		//
-		e.offset -= 1
+	if val.Type() == object.ERROR {
+		return nil, fmt.Errorf("%s", val.(*object.ErrorObject).Value)
+	}
 
-		//
-		// If the user made a jump then we'll
-		// abort here, because if the single-statement modified our
-		// flow control we're screwed.
-		//
-		// (Because we'll start searching from the NEW location.)
-		//
-		//
-		if e.jump {
+	if strings.HasSuffix(name, "$") != (val.Type() == object.STRING) {
+		return nil, fmt.Errorf("%s: type mismatch reading %v into %s", stmt, val, name)
+	}
+	return val, nil
+}
+
+// REM handles a REM statement
+//
+// This merely swallows input until the following newline / EOF.
+func (e *Interpreter) runREM() error {
+
+	for e.offset < len(e.program) {
+		tok := e.program[e.offset]
+		if tok.Type == token.NEWLINE {
 			return nil
 		}
+		e.offset++
+	}
 
-		//
-		// We get the next token, it should either be ELSE + expr
-		// or newline.
-		//
-		// Skip until we hit the end of line.
-		//
-		if e.offset >= len(e.program) {
-			return fmt.Errorf("Hit end of program processing IF")
+	return nil
+}
+
+// dataName returns the name of the table declared by a named DATA
+// statement, such as "DATA.TABLE1 1,2,3", which is tokenized as a
+// single identifier.
+func dataName(tok token.Token) (string, bool) {
+	if tok.Type != token.IDENT || len(tok.Literal) <= len("DATA.") {
+		return "", false
+	}
+	if strings.ToUpper(tok.Literal[:len("DATA.")]) != "DATA." {
+		return "", false
+	}
+	return tok.Literal[len("DATA."):], true
+}
+
+// runRESTORE handles a RESTORE statement, which makes READ start
+// again from the first DATA value in the program, the first value
+// at, or after, the given line, or the first value of a named table:
+//
+//  RESTORE
+//  RESTORE 100
+//  RESTORE TABLE1
+func (e *Interpreter) runRESTORE() error {
+
+	// Is there a table-name?
+	if e.offset+1 < len(e.program) && e.program[e.offset+1].Type == token.IDENT {
+		e.offset++
+
+		name := e.program[e.offset].Literal
+		offset, ok := e.namedData[name]
+		if !ok {
+			return fmt.Errorf("RESTORE: DATA table %s does not exist", name)
 		}
+		e.dataOffset = offset
+		return nil
+	}
 
-		tmp := e.program[e.offset]
+	// Is there a line-number?
+	if e.offset+1 < len(e.program) && e.program[e.offset+1].Type == token.INT {
 		e.offset++
-		for tmp.Type != token.NEWLINE {
 
-			if e.offset >= len(e.program) {
-				return fmt.Errorf("Hit end of program processing IF")
-			}
-			tmp = e.program[e.offset]
-			e.offset++
+		line := e.program[e.offset].Literal
+		offset, ok := e.dataLines[line]
+		if !ok {
+			return fmt.Errorf("RESTORE: line %s does not exist", line)
 		}
-	} else {
+		e.dataOffset = offset
+		return nil
+	}
 
-		//
-		// Here the test failed.
-		//
-		// Skip over the truthy-condition until we either
-		// hit ELSE, or the newline that will terminate our
-		// IF-statement.
-		//
-		//
-		for {
+	e.dataOffset = 0
+	return nil
+}
 
-			if e.offset >= len(e.program) {
-				return fmt.Errorf("Hit end of program processing IF")
-			}
+// runRESUME continues execution after an error has been passed to the
+// handler set by ON ERROR GOTO.
+//
+// The general form is one of:
+//
+//  RESUME       - Execute the statement which caused the error again.
+//  RESUME NEXT  - Continue with the statement after it.
+//  RESUME 200   - Continue at line 200.
+func (e *Interpreter) runRESUME() error {
 
-			tmp := e.program[e.offset]
-			e.offset++
+	if !e.inErrorHandler {
+		return fmt.Errorf("RESUME without an error")
+	}
 
-			// If we hit the newline then we're done
-			if tmp.Type == token.NEWLINE {
-				return nil
-			}
+	// Bump past the RESUME token
+	e.offset++
 
-			// Otherwise did we hit the else?
-			if tmp.Type == token.ELSE {
+	tok := token.Token{Type: token.NEWLINE}
+	if e.offset < len(e.program) {
+		tok = e.program[e.offset]
+	}
 
-				// Execute the single statement
-				e.RunOnce()
+	// The offset we'll continue from, once it is bumped, and the
+	// line that is within.
+	offset := e.errorOriginOffset
+	line := e.lineAt(offset)
 
-				// Then return.
-				return nil
+	switch tok.Type {
+	case token.NEWLINE, token.COLON, token.ELSE:
+
+		// Step back, so that the statement is run again.
+		offset--
+	case token.NEXT:
+
+		// Skip to the end of the statement.
+		for offset < len(e.program) &&
+			e.program[offset].Type != token.NEWLINE &&
+			e.program[offset].Type != token.COLON {
+			offset++
+		}
+	default:
+		target, err := e.jumpTarget("RESUME")
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		offset, ok = e.lines[target]
+		if !ok {
+			return fmt.Errorf("Failed to RESUME %s", target)
+		}
+		line = e.lineAt(offset)
+	}
+
+	e.vars.Delete("ERR$")
+	e.vars.Delete("ERL")
+	e.inErrorHandler = false
+
+	e.offset = offset
+	e.enterLine(line)
+	return nil
+}
+
+// RETURN handles a control-flow operation
+//
+// RETURN may optionally be followed by an expression, in which case
+// the result is stored in the variable GOSUB_RESULT, allowing a value
+// to be passed back to the caller.
+//
+// NOTE: There is only a single GOSUB_RESULT variable, which is
+// overwritten by each RETURN which specifies a value.
+func (e *Interpreter) runRETURN() error {
+
+	// Stack can't be empty
+	if e.gstack.Empty() {
+		return fmt.Errorf("RETURN without GOSUB")
+	}
+
+	// Is there a value to return?
+	if e.offset+1 < len(e.program) {
+		next := e.program[e.offset+1]
+
+		if next.Type != token.NEWLINE &&
+			next.Type != token.COLON &&
+			next.Type != token.ELSE {
+
+			// Skip the RETURN-instruction
+			e.offset++
+
+			val := e.expr(true)
+			if val.Type() == object.ERROR {
+				return fmt.Errorf("%s", val.(*object.ErrorObject).Value)
 			}
+			e.SetVariable("GOSUB_RESULT", val)
 		}
 	}
 
+	// Get the return address
+	ret, err := e.gstack.Pop()
+	if err != nil {
+		return fmt.Errorf("Error handling RETURN: %s", err.Error())
+	}
+
+	// Return execution where we left off.
+	e.offset = ret
 	return nil
 }
 
-// runLET handles variable creation/updating.
-func (e *Interpreter) runLET() error {
+// runSELECT handles a SELECT CASE statement, which executes the
+// statements following the first CASE which matches a value:
+//
+//  SELECT CASE X
+//  CASE 1
+//    PRINT "One"
+//  CASE 2, 3 : PRINT "Two or three"
+//  CASE IS > 10, -1
+//    PRINT "Big, or minus one"
+//  CASE 4 TO 6
+//    PRINT "Four to six"
+//  CASE ELSE
+//    PRINT "Something else"
+//  END SELECT
+//
+// If no CASE matches, and there is no CASE ELSE, we continue after the
+// END SELECT.
+func (e *Interpreter) runSELECT() error {
 
-	// Bump past the LET token
+	// Bump past the SELECT token
 	e.offset++
 
-	// We now expect an ID
-	target := e.program[e.offset]
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.CASE {
+		return fmt.Errorf("ERROR: SELECT should be : SELECT CASE expr")
+	}
 	e.offset++
-	if target.Type != token.IDENT {
-		return fmt.Errorf("Expected IDENT after LET, got %v", target)
+
+	sel := demoteBigInt(e.expr(true))
+	if sel.Type() == object.ERROR {
+		return fmt.Errorf("SELECT: %s", sel.(*object.ErrorObject).Value)
+	}
+	if sel.Type() != object.NUMBER && sel.Type() != object.STRING {
+		return fmt.Errorf("SELECT: the value must be a number or a string")
 	}
 
-	// Now "="
-	assign := e.program[e.offset]
-	if assign.Type != token.ASSIGN {
-		return fmt.Errorf("Expected assignment after LET x, got %v", assign)
+	cases, end := e.matchSelect(e.offset)
+	if end < 0 {
+		return fmt.Errorf("SELECT without END SELECT")
+	}
+
+	for _, offset := range cases {
+
+		e.offset = offset + 1
+		matched, err := e.caseMatches(sel)
+		if err != nil {
+			return err
+		}
+
+		// We'll be bumped to the first statement of the case.
+		if matched {
+			e.lineno = e.lineAt(offset)
+			return nil
+		}
+	}
+
+	e.offset = end
+	e.lineno = e.lineAt(end)
+	return nil
+}
+
+// caseMatches returns true if the given value matches the values of a
+// CASE, which begin at our offset, and which may be:
+//
+//  CASE 1, 2      - Any of the given values.
+//  CASE 1 TO 5    - A range of values, inclusive.
+//  CASE IS > 10   - Values which satisfy the given comparison.
+//  CASE ELSE      - Any value at all.
+//
+// The offset is left at the end of the CASE statement.
+func (e *Interpreter) caseMatches(sel object.Object) (bool, error) {
+
+	if e.offset < len(e.program) && e.program[e.offset].Type == token.ELSE {
+		e.offset++
+		return true, nil
+	}
+
+	// test compares our value with the one which follows
+	test := func(op token.Type) (bool, error) {
+		val := demoteBigInt(e.expr(true))
+		if val.Type() == object.ERROR {
+			return false, fmt.Errorf("CASE: %s", val.(*object.ErrorObject).Value)
+		}
+		if val.Type() != sel.Type() {
+			return false, fmt.Errorf("CASE: type mismatch between %s and %s", sel.String(), val.String())
+		}
+		res := compareObjects(op, sel, val)
+		return res.Type() == object.NUMBER && res.(*object.NumberObject).Value == 1, nil
+	}
+
+	matched := false
+	for {
+		var ok bool
+		var err error
+
+		if e.offset < len(e.program) && e.program[e.offset].Type == token.IS {
+			e.offset++
+			if e.offset >= len(e.program) {
+				return false, fmt.Errorf("Hit end of program processing CASE")
+			}
+			op := e.program[e.offset].Type
+			switch op {
+			case token.ASSIGN, token.NOT_EQUALS, token.GT, token.GT_EQUALS, token.LT, token.LT_EQUALS:
+			default:
+				return false, fmt.Errorf("CASE IS: expected a comparison, got %v", e.program[e.offset])
+			}
+			e.offset++
+			ok, err = test(op)
+		} else {
+			start := e.offset
+			ok, err = test(token.ASSIGN)
+
+			// Is this actually a range?
+			if err == nil && e.offset < len(e.program) && e.program[e.offset].Type == token.TO {
+				e.offset = start
+				ok, err = test(token.GT_EQUALS)
+				if err == nil {
+					e.offset++
+					var below bool
+					below, err = test(token.LT_EQUALS)
+					ok = ok && below
+				}
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		matched = matched || ok
+
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			break
+		}
+		e.offset++
+	}
+
+	if e.offset < len(e.program) &&
+		e.program[e.offset].Type != token.NEWLINE &&
+		e.program[e.offset].Type != token.COLON {
+		return false, fmt.Errorf("CASE: unexpected token %v", e.program[e.offset])
 	}
+	return matched, nil
+}
+
+// runSLEEP pauses execution for the given number of seconds, which
+// may be fractional:
+//
+//  SLEEP 0.5
+//
+// A negative duration is treated as zero, and one longer than maxSleep
+// seconds, or maxSandboxSleep in sandbox mode, is an error.
+func (e *Interpreter) runSLEEP() error {
+
+	// Bump past the SLEEP token
 	e.offset++
 
-	// now we're at the expression/value/whatever
 	res := e.expr(true)
-
-	// Did we get an error in the expression?
 	if res.Type() == object.ERROR {
-		return fmt.Errorf("%s", res.(*object.ErrorObject).Value)
+		return fmt.Errorf("SLEEP: %s", res.(*object.ErrorObject).Value)
 	}
+	if res.Type() != object.NUMBER {
+		return fmt.Errorf("SLEEP: the duration must be a number")
+	}
+	n := res.(*object.NumberObject).Value
 
-	// Store the result
-	e.SetVariable(target.Literal, res)
+	max := float64(maxSleep)
+	if e.sandbox {
+		max = maxSandboxSleep
+	}
+	if n > max {
+		return fmt.Errorf("SLEEP: the duration %s is longer than the maximum of %s seconds", formatNumber(n), formatNumber(max))
+	}
+
+	if n > 0 {
+		time.Sleep(time.Duration(n * float64(time.Second)))
+	}
 	return nil
 }
 
-// runNEXT handles the NEXT statement
-func (e *Interpreter) runNEXT() error {
-	// Bump past the NEXT token
-	e.offset++
+// runSTOP invokes the callback registered via SetStopCallback, which
+// allows an embedding application to examine the program's state.
+//
+// If there is no callback STOP terminates the program, as END does.
+func (e *Interpreter) runSTOP() {
 
-	// Get the identifier
-	target := e.program[e.offset]
+	if e.stopCallback == nil {
+		e.finished = true
+		return
+	}
+	e.stopCallback(e.lineno, e.GetAllVariables())
+}
+
+// runSWAP exchanges the values of two variables, which must both be
+// numbers, or both be strings:
+//
+//  SWAP A, B
+func (e *Interpreter) runSWAP() error {
+
+	// Bump past the SWAP token
 	e.offset++
-	if target.Type != token.IDENT {
-		return fmt.Errorf("Expected IDENT after NEXT in FOR loop, got %v", target)
+
+	var names []string
+	for len(names) < 2 {
+
+		if len(names) > 0 {
+			if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+				return fmt.Errorf("ERROR: SWAP should be : SWAP var, var")
+			}
+			e.offset++
+		}
+
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.IDENT {
+			return fmt.Errorf("ERROR: SWAP should be : SWAP var, var")
+		}
+		name := e.program[e.offset].Literal
+		e.offset++
+
+		if e.vars.IsConstant(name) {
+			return fmt.Errorf("SWAP: %s is a constant", name)
+		}
+		names = append(names, name)
 	}
 
-	// OK we've found the tail of a loop
-	//
-	// We need to bump the value of the given variable by the offset
-	// and compare it against the max.
-	//
-	// If the max hasn't finished we loop around again.
-	//
-	// If it has we remove the for-loop
-	//
-	data := e.loops.Get(target.Literal)
-	if data.id == "" {
-		return fmt.Errorf("NEXT %s found - without opening FOR", target.Literal)
+	a := e.vars.Get(names[0])
+	b := e.vars.Get(names[1])
+	for i, val := range []object.Object{a, b} {
+		if val == nil {
+			return fmt.Errorf("SWAP: the variable '%s' doesn't exist", names[i])
+		}
+	}
+	if a.Type() != b.Type() {
+		return fmt.Errorf("SWAP: type mismatch between %s and %s", names[0], names[1])
 	}
 
-	//
-	// Get the variable value, and increase it.
-	//
-	cur := e.GetVariable(target.Literal)
-	if cur.Type() != object.NUMBER {
-		return fmt.Errorf("NEXT variable %s is not a number!", target.Literal)
-	}
-	iVal := cur.(*object.NumberObject).Value
+	e.SetVariable(names[0], b)
+	e.SetVariable(names[1], a)
+	return nil
+}
 
-	//
-	// If the start/end offsets are the same then
-	// we terminate immediately.
-	//
-	if data.start == data.end {
-		data.finished = true
+// runWEND handles the end of a WHILE loop, jumping back to the WHILE
+// statement so that the condition is tested again.
+func (e *Interpreter) runWEND() error {
 
-		// updates-in-place.  bad name
-		e.loops.Add(data)
+	start := e.matchWhile(e.offset)
+	if start < 0 {
+		return fmt.Errorf("WEND without WHILE")
+	}
+	data, ok := e.whiles.Get(start)
+	if !ok {
+		return fmt.Errorf("WEND without WHILE")
 	}
 
 	//
-	// Increment the number.
+	// We'll be bumped past the token before the WHILE, and the
+	// WHILE might not be on the same line as we are.
 	//
-	iVal += float64(data.step)
+	e.offset = data.condOffset - 1
+	e.lineno = e.lineAt(data.condOffset)
+	return nil
+}
 
-	//
-	// Set it
-	//
-	e.SetVariable(target.Literal, &object.NumberObject{Value: iVal})
+// runWHILE handles a WHILE loop:
+//
+//  WHILE A < 10
+//    ..
+//  WEND
+//
+// If the condition is true we execute the body of the loop, otherwise
+// we skip to the statement following the matching WEND.
+func (e *Interpreter) runWHILE() error {
 
-	//
-	// Have we finnished?
-	//
-	if data.finished {
-		e.loops.Remove(target.Literal)
-		return nil
-	}
+	start := e.offset
 
-	//
-	// If we've reached our limit we mark this as complete,
-	// but note that we dont' terminate to allow the actual
-	// end-number to be inclusive.
-	//
-	if iVal == float64(data.end) {
-		data.finished = true
+	// Bump past the WHILE token
+	e.offset++
+
+	result, err := e.condition()
+	if err != nil {
+		return fmt.Errorf("WHILE: %s", err.Error())
+	}
 
-		// updates-in-place.  bad name
-		e.loops.Add(data)
+	if result {
+		e.whiles.Add(WhileLoop{condOffset: start})
+		return nil
 	}
 
 	//
-	// Otherwise loop again
+	// The loop is over, so skip to the matching WEND, which we'll
+	// be bumped past.
 	//
-	e.offset = data.offset
+	e.whiles.Remove(start)
+	end := e.matchWhile(start)
+	if end < 0 {
+		return fmt.Errorf("WHILE without WEND")
+	}
+	e.offset = end
+	e.lineno = e.lineAt(end)
 	return nil
 }
 
-// runPRINT handles a print!
-// NOTE:
-//  Print basically swallows input up to the next newline.
-//  However it also stops at ":" to cope with the case of printing in an IF
-func (e *Interpreter) runPRINT() error {
+// runUNTIL handles the end of a REPEAT loop:
+//
+//  REPEAT
+//    ..
+//  UNTIL A >= 10
+//
+// If the condition is false we jump back to the start of the loop,
+// so the body of the loop is always executed at least once.
+func (e *Interpreter) runUNTIL() error {
 
-	// Bump past the PRINT token
+	if e.repeats.Empty() {
+		return fmt.Errorf("UNTIL without REPEAT")
+	}
+
+	// Bump past the UNTIL token
 	e.offset++
 
-	// Now keep lookin for things to print until we hit a newline.
-	for e.offset < len(e.program) {
+	result, err := e.condition()
+	if err != nil {
+		return fmt.Errorf("UNTIL: %s", err.Error())
+	}
 
-		// Get the token
-		tok := e.program[e.offset]
+	if result {
+		e.repeats.Pop()
+		return nil
+	}
 
-		// End of the line, or statement?
-		if tok.Type == token.NEWLINE || tok.Type == token.COLON {
-			return nil
-		}
+	//
+	// We'll be bumped past the REPEAT, which might not be on the
+	// same line as we are.
+	//
+	start, _ := e.repeats.Peek(1)
+	e.offset = start
+	e.lineno = e.lineAt(start)
+	return nil
+}
 
-		// Printing a literal?
-		if tok.Type == token.INT || tok.Type == token.STRING {
-			fmt.Printf("%s", tok.Literal)
-		} else if tok.Type == token.COMMA {
-			fmt.Printf(" ")
-		} else if tok.Type == token.BUILTIN {
+// varFile evaluates the filename given to VARSAVE or VARLOAD.
+func (e *Interpreter) varFile(name string) (string, error) {
 
-			// Call the function.
-			val := e.callBuiltin(tok.Literal)
+	if e.sandbox {
+		return "", fmt.Errorf("%s: files may not be accessed in sandbox mode", name)
+	}
 
-			// Did it error?
-			if val.Type() == object.ERROR {
-				return fmt.Errorf("%s", val.(*object.ErrorObject).Value)
-			}
+	// Bump past the statement token
+	e.offset++
 
-			// Otherwise handle the output
-			// 1.  String
-			if val.Type() == object.STRING {
-				fmt.Printf("%s", val.(*object.StringObject).Value)
-			}
-			// 2.  Number
-			if val.Type() == object.NUMBER {
-				n := val.(*object.NumberObject).Value
+	res := e.expr(true)
+	if res.Type() == object.ERROR {
+		return "", fmt.Errorf("%s: %s", name, res.(*object.ErrorObject).Value)
+	}
+	if res.Type() != object.STRING {
+		return "", fmt.Errorf("%s: the filename must be a string", name)
+	}
 
-				// If the value is basically an
-				// int then cast it to avoid
-				// 3 looking like 3.0000
-				if n == float64(int(n)) {
-					fmt.Printf("%d", int(n))
-				} else {
-					fmt.Printf("%f", n)
-				}
-			}
+	return res.(*object.StringObject).Value, nil
+}
 
-			//
-			// We're going to bump back one,
-			// because callBuiltin will advance
-			// to the end of the arguments.
-			//
-			e.offset--
-		} else if tok.Type == token.IDENT {
+// runVARLOAD restores the variables previously saved by VARSAVE.
+//
+// The general form is:
+//
+//  VARLOAD "file.json"
+//
+// Variables which aren't used by the current program are ignored.
+func (e *Interpreter) runVARLOAD() error {
 
-			//
-			// Get the variable.
-			//
-			val := e.GetVariable(tok.Literal)
-			if val.Type() == object.ERROR {
-				return fmt.Errorf("%s", val.(*object.ErrorObject).Value)
-			}
-			if val.Type() == object.STRING {
-				fmt.Printf("%s", val.(*object.StringObject).Value)
-			}
-			if val.Type() == object.NUMBER {
-				n := val.(*object.NumberObject).Value
+	path, err := e.varFile("VARLOAD")
+	if err != nil {
+		return err
+	}
 
-				// If the value is basically an
-				// int then cast it to avoid
-				// 3 looking like 3.0000
-				if n == float64(int(n)) {
-					fmt.Printf("%d", int(n))
-				} else {
-					fmt.Printf("%f", n)
-				}
-			}
-		} else {
-			// OK we're not printing:
-			//
-			//  an int
-			//  a string
-			//  a variable
-			//
-			// As a fall-back we'll assume we've been given
-			// an expression, and print the result.
-			//
-			out := e.expr(true)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("VARLOAD: %s", err.Error())
+	}
 
-			if out.Type() == object.STRING {
-				fmt.Printf("%s", out.(*object.StringObject).Value)
-			}
-			if out.Type() == object.NUMBER {
-				n := out.(*object.NumberObject).Value
+	saved := make(map[string]interface{})
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return fmt.Errorf("VARLOAD: %s", err.Error())
+	}
 
-				// If the value is basically an
-				// int then cast it to avoid
-				// 3 looking like 3.0000
-				if n == float64(int(n)) {
-					fmt.Printf("%d", int(n))
-				} else {
-					fmt.Printf("%f", n)
-				}
-			}
+	//
+	// Find the variables our program refers to.
+	//
+	used := make(map[string]bool)
+	for _, tok := range e.program {
+		if tok.Type == token.IDENT {
+			used[tok.Literal] = true
 		}
-		e.offset++
 	}
 
-	return nil
-}
-
-// REM handles a REM statement
-//
-// This merely swallows input until the following newline / EOF.
-func (e *Interpreter) runREM() error {
+	for name, val := range saved {
+		if !used[name] || e.vars.IsConstant(name) {
+			continue
+		}
 
-	for e.offset < len(e.program) {
-		tok := e.program[e.offset]
-		if tok.Type == token.NEWLINE {
-			return nil
+		switch v := val.(type) {
+		case float64:
+			e.SetVariable(name, &object.NumberObject{Value: v})
+		case string:
+			e.SetVariable(name, &object.StringObject{Value: v})
+		default:
+			return fmt.Errorf("VARLOAD: %s has an unsupported value %v", name, val)
 		}
-		e.offset++
 	}
-
 	return nil
 }
 
-// RETURN handles a control-flow operation
-func (e *Interpreter) runRETURN() error {
+// runVARSAVE saves the current numeric and string variables to the
+// given file, as JSON, so that they may be restored via VARLOAD.
+//
+// The general form is:
+//
+//  VARSAVE "file.json"
+func (e *Interpreter) runVARSAVE() error {
 
-	// Stack can't be empty
-	if e.gstack.Empty() {
-		return fmt.Errorf("RETURN without GOSUB")
+	path, err := e.varFile("VARSAVE")
+	if err != nil {
+		return err
 	}
 
-	// Get the return address
-	ret, err := e.gstack.Pop()
+	saved := make(map[string]interface{})
+	for _, name := range e.vars.Names() {
+		switch v := e.vars.Get(name).(type) {
+		case *object.NumberObject:
+			saved[name] = v.Value
+		case *object.StringObject:
+			saved[name] = v.Value
+		}
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
 	if err != nil {
-		return fmt.Errorf("Error handling RETURN: %s", err.Error())
+		return fmt.Errorf("VARSAVE: %s", err.Error())
 	}
 
-	// Return execution where we left off.
-	e.offset = ret
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("VARSAVE: %s", err.Error())
+	}
 	return nil
 }
 
@@ -1401,44 +4678,137 @@ func (e *Interpreter) RunOnce() error {
 	var err error
 
 	if e.trace {
-		fmt.Printf("RunOnce( %s )\n", tok.String())
+		fmt.Fprintf(e.output, "RunOnce( %s )\n", tok.String())
 	}
 
 	e.jump = false
 
+	if e.stepCallback != nil {
+		switch tok.Type {
+		case token.NEWLINE, token.COLON, token.LINENO:
+		default:
+			e.stepCallback(e.lineno, tok)
+		}
+	}
+
 	//
 	// Handle this token
 	//
 	switch tok.Type {
-	case token.NEWLINE:
+	case token.NEWLINE, token.COLON:
 		// NOP
 	case token.LINENO:
-		e.lineno = tok.Literal
+		e.enterLine(tok.Literal)
+	case token.APPEND:
+		err = e.runAPPEND()
+	case token.CALL:
+		err = e.runCALL()
+	case token.CASE:
+		err = e.runCASE()
+	case token.CLEAR:
+		err = e.runCLEAR()
+	case token.CLOSE:
+		err = e.runCLOSE()
+	case token.DATA:
+		err = e.runDATA()
+	case token.DEF:
+		err = e.runDEF()
+	case token.DIM:
+		err = e.runDIM()
+	case token.DO:
+		err = e.runDO()
 	case token.END:
+
+		// END SELECT closes a SELECT CASE, rather than ending
+		// the program.
+		if e.offset+1 < len(e.program) && e.program[e.offset+1].Type == token.SELECT {
+			e.offset++
+			break
+		}
+
+		// END WHILE is a synonym for WEND.
+		if e.offset+1 < len(e.program) && e.program[e.offset+1].Type == token.WHILE {
+			e.offset++
+			err = e.runWEND()
+			break
+		}
 		e.finished = true
 		return nil
+	case token.EXIT:
+		err = e.runEXIT()
+	case token.FIELD:
+		err = e.runFIELD()
 	case token.FOR:
 		err = e.runForLoop()
+	case token.GET:
+		err = e.runGET()
 	case token.GOSUB:
 		err = e.runGOSUB()
 		e.jump = true
 	case token.GOTO:
 		err = e.runGOTO()
 		e.jump = true
+	case token.GRAPHICS:
+		err = e.runGRAPHICS()
 	case token.INPUT:
 		err = e.runINPUT()
 	case token.IF:
 		err = e.runIF()
+	case token.LABEL:
+		err = e.runLABEL()
 	case token.LET:
 		err = e.runLET()
+	case token.LOOP:
+		err = e.runLOOP()
+	case token.MAT:
+		err = e.runMAT()
 	case token.NEXT:
 		err = e.runNEXT()
+	case token.ON:
+		err = e.runON()
+	case token.OPEN:
+		err = e.runOPEN()
 	case token.PRINT:
 		err = e.runPRINT()
+	case token.PUT:
+		err = e.runPUT()
+	case token.RANDOMIZE:
+		err = e.runRANDOMIZE()
+	case token.READ:
+		err = e.runREAD()
 	case token.REM:
 		err = e.runREM()
+	case token.REPEAT:
+		e.repeats.Push(e.offset)
+	case token.RESTORE:
+		err = e.runRESTORE()
+	case token.RESUME:
+		err = e.runRESUME()
+		e.jump = true
 	case token.RETURN:
 		err = e.runRETURN()
+	case token.SELECT:
+		err = e.runSELECT()
+	case token.SLEEP:
+		err = e.runSLEEP()
+	case token.SWAP:
+		err = e.runSWAP()
+	case token.TEXT:
+		e.graphicsMode = false
+	case token.TRACEOFF:
+		e.trace = false
+	case token.TRACEON:
+		e.trace = true
+	case token.UNTIL:
+		err = e.runUNTIL()
+	case token.VARLOAD:
+		err = e.runVARLOAD()
+	case token.VARSAVE:
+		err = e.runVARSAVE()
+	case token.WEND:
+		err = e.runWEND()
+	case token.WHILE:
+		err = e.runWHILE()
 	case token.BUILTIN:
 
 		obj := e.callBuiltin(tok.Literal)
@@ -1448,6 +4818,17 @@ func (e *Interpreter) RunOnce() error {
 		}
 
 		e.offset--
+	case token.IDENT:
+
+		// STOP isn't a keyword, so that existing programs may
+		// continue to use it as a variable.
+		if strings.ToUpper(tok.Literal) == "STOP" {
+			e.runSTOP()
+		} else if _, ok := dataName(tok); ok {
+			err = e.runDATA()
+		} else {
+			err = fmt.Errorf("Token not handled: %v", tok)
+		}
 	default:
 		err = fmt.Errorf("Token not handled: %v", tok)
 	}
@@ -1472,17 +4853,30 @@ func (e *Interpreter) RunOnce() error {
 // final-line, or when the "END" token is encountered.
 func (e *Interpreter) Run() error {
 
+	// Any files the program didn't close are closed when it ends.
+	defer e.closeFiles()
+
+	// The number of statements we've executed.
+	var iterations int64
+
 	//
 	// We walk our series of tokens.
 	//
 	for e.offset < len(e.program) && !e.finished {
 
+		iterations++
+		if e.maxIterations > 0 && iterations > e.maxIterations {
+			return e.runtimeError(fmt.Errorf("Exceeded the limit of %d iterations", e.maxIterations))
+		}
+
+		start := e.offset
 		err := e.RunOnce()
 
 		if err != nil {
-
-			return fmt.Errorf("Line %s : %s", e.lineno, err.Error())
-			return err
+			if e.handleError(err, start) {
+				continue
+			}
+			return e.runtimeError(err)
 		}
 	}
 
@@ -1493,6 +4887,15 @@ func (e *Interpreter) Run() error {
 	if !e.loops.Empty() {
 		return fmt.Errorf("Unclosed FOR loop")
 	}
+	if !e.whiles.Empty() {
+		return fmt.Errorf("Unclosed WHILE loop")
+	}
+	if !e.repeats.Empty() {
+		return fmt.Errorf("Unclosed REPEAT loop")
+	}
+	if !e.doStack.Empty() {
+		return fmt.Errorf("Unclosed DO loop")
+	}
 
 	return nil
 }
@@ -1518,6 +4921,28 @@ func (e *Interpreter) GetVariable(id string) object.Object {
 	return object.Error("The variable '%s' doesn't exist", id)
 }
 
+// GetAllVariables returns a copy of all the variables which have been
+// set, keyed by name.  Constants, such as RED, are not included.
+func (e *Interpreter) GetAllVariables() map[string]object.Object {
+	out := make(map[string]object.Object)
+	for _, name := range e.vars.Names() {
+		out[name] = e.vars.Get(name)
+	}
+	return out
+}
+
+// SetStopCallback registers a function to be invoked by the STOP
+// statement, rather than it terminating the program.
+func (e *Interpreter) SetStopCallback(fn StopCallback) {
+	e.stopCallback = fn
+}
+
+// SetStepCallback registers a function to be invoked before each
+// statement is executed, or removes it if given nil.
+func (e *Interpreter) SetStepCallback(fn StepCallback) {
+	e.stepCallback = fn
+}
+
 // RegisterBuiltin registers a function as a built-in, so that it can
 // be called from the users' BASIC program.
 //
@@ -1537,8 +4962,233 @@ func (e *Interpreter) RegisterBuiltin(name string, nArgs int, ft BuiltinSig) {
 		if e.program[i].Type == token.IDENT &&
 			e.program[i].Literal == name {
 
+			// Don't modify a program other interpreters
+			// are running.
+			if e.shared {
+				e.program = append([]token.Token(nil), e.program...)
+				e.shared = false
+			}
+
 			// Change the type.  (Hack!)
 			e.program[i].Type = token.BUILTIN
 		}
 	}
 }
+
+// RegisterCall registers a golang function which can be invoked, by
+// name, via the CALL statement.
+//
+// Useful for embedding.
+//
+func (e *Interpreter) RegisterCall(name string, fn CallSig) {
+	e.callTable[name] = fn
+}
+
+// FunctionList returns the sorted names of all the registered built-in
+// functions.
+func (e *Interpreter) FunctionList() []string {
+	return e.functions.Names()
+}
+
+// FunctionArity returns the number of arguments the named built-in
+// function requires, which is negative if it is variadic.  The second
+// return value is false if there is no such built-in.
+func (e *Interpreter) FunctionArity(name string) (int, bool) {
+	return e.functions.Arity(name)
+}
+
+// ReplaceLine replaces the line with the given line-number by the
+// given source, which must be a single line beginning with that same
+// line-number.
+//
+// This allows a program to be edited in-memory, without reloading it.
+// It should not be called while the program is running, as open
+// GOSUB and FOR state is not updated.
+func (e *Interpreter) ReplaceLine(n string, src string) error {
+
+	start, ok := e.lines[n]
+	if !ok {
+		return fmt.Errorf("ReplaceLine: line %s does not exist", n)
+	}
+
+	//
+	// Tokenize the replacement, skipping the newline the tokenizer
+	// always begins with.
+	//
+	var line []token.Token
+	stream := tokenizer.New(src)
+	for {
+		tok := stream.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		if tok.Type == token.NEWLINE &&
+			(len(line) == 0 || line[len(line)-1].Type == token.NEWLINE) {
+			continue
+		}
+
+		if tok.Type == token.LINENO {
+			if len(line) > 0 {
+				return fmt.Errorf("ReplaceLine: source contains more than one line")
+			}
+			if tok.Literal != n {
+				return fmt.Errorf("ReplaceLine: expected line %s, got line %s", n, tok.Literal)
+			}
+		}
+		if len(line) == 0 && tok.Type != token.LINENO {
+			return fmt.Errorf("ReplaceLine: source must begin with line-number %s", n)
+		}
+
+		// Builtins must be recognised as such.
+		if tok.Type == token.IDENT {
+			if _, fn := e.functions.Get(tok.Literal); fn != nil {
+				tok.Type = token.BUILTIN
+			}
+		}
+		line = append(line, tok)
+	}
+	if len(line) == 0 {
+		return fmt.Errorf("ReplaceLine: empty source")
+	}
+
+	//
+	// Find the end of the existing line, which is the start of
+	// the next one.
+	//
+	end := start + 1
+	for end < len(e.program) && e.program[end].Type != token.LINENO {
+		end++
+	}
+
+	//
+	// Splice the new line into place.
+	//
+	var program []token.Token
+	program = append(program, e.program[:start]...)
+	program = append(program, line...)
+	program = append(program, e.program[end:]...)
+
+	if e.offset >= end {
+		e.offset += len(line) - (end - start)
+	}
+	e.program = program
+
+	//
+	// Rebuild our jump-targets, since the offsets of every
+	// subsequent line will have changed.
+	//
+	e.lines = make(map[string]int)
+	for i, tok := range e.program {
+		if tok.Type == token.LINENO {
+			e.lines[tok.Literal] = i
+		}
+		if tok.Type == token.STRING && isLabel(e.program[:i], tok.Literal) {
+			e.lines[tok.Literal] = i
+		}
+	}
+
+	// The DATA statements might have changed too.
+	e.loadData()
+	return nil
+}
+
+// matchDo finds the LOOP which matches the DO at the given offset,
+// allowing for nested loops.
+//
+// It returns -1 if there is no match.
+func (e *Interpreter) matchDo(offset int) int {
+
+	depth := 0
+	for i := offset; i < len(e.program); i++ {
+		switch e.program[i].Type {
+		case token.DO:
+			// EXIT DO doesn't begin a loop.
+			if i == 0 || e.program[i-1].Type != token.EXIT {
+				depth++
+			}
+		case token.LOOP:
+			depth--
+		}
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// isEndWhile returns true if the WHILE token at the given offset is
+// part of END WHILE, rather than the start of a loop.
+func (e *Interpreter) isEndWhile(offset int) bool {
+	return e.program[offset].Type == token.WHILE && offset > 0 &&
+		e.program[offset-1].Type == token.END
+}
+
+// matchSelect finds the CASE statements of a SELECT, and its END SELECT,
+// searching from the given offset and allowing for nested SELECTs.
+//
+// It returns the offsets of the CASE tokens, and of the SELECT token of
+// the END SELECT, which is -1 if there is no match.
+func (e *Interpreter) matchSelect(offset int) ([]int, int) {
+
+	var cases []int
+
+	depth := 0
+	for i := offset; i >= 0 && i < len(e.program); i++ {
+		switch e.program[i].Type {
+		case token.SELECT:
+			if i == 0 || e.program[i-1].Type != token.END {
+				depth++
+				continue
+			}
+			if depth == 0 {
+				return cases, i
+			}
+			depth--
+		case token.CASE:
+			if depth == 0 {
+				cases = append(cases, i)
+			}
+		}
+	}
+	return cases, -1
+}
+
+// matchWhile finds the WEND which matches the WHILE at the given offset,
+// or the WHILE which matches the WEND at the given offset, allowing
+// for nested loops.
+//
+// END WHILE is a synonym for WEND, and is found at the offset of its
+// WHILE token.
+//
+// It returns -1 if there is no match.
+func (e *Interpreter) matchWhile(offset int) int {
+
+	// Which way are we searching?
+	dir := 1
+	if e.program[offset].Type == token.WEND || e.isEndWhile(offset) {
+		dir = -1
+	}
+
+	depth := 0
+	for i := offset; i >= 0 && i < len(e.program); i += dir {
+		switch e.program[i].Type {
+		case token.WHILE:
+			// The conditions of DO loops aren't WHILE loops.
+			if i > 0 && (e.program[i-1].Type == token.DO ||
+				e.program[i-1].Type == token.LOOP) {
+				continue
+			}
+			if e.isEndWhile(i) {
+				depth -= dir
+			} else {
+				depth += dir
+			}
+		case token.WEND:
+			depth -= dir
+		}
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,11 +3,18 @@
 package eval
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	"math"
+	"os"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/skx/gobasic/object"
+	"github.com/skx/gobasic/token"
 	"github.com/skx/gobasic/tokenizer"
 )
 
@@ -171,6 +178,139 @@ func TestPI(t *testing.T) {
 	}
 }
 
+// TestFix contrasts FIX, which truncates towards zero, with INT which
+// rounds down.
+func TestFix(t *testing.T) {
+	input := `10 LET a = INT(-2.7)
+20 LET b = FIX(-2.7)
+30 LET c = INT(2.7)
+40 LET d = FIX(2.7)
+50 LET e = FIX -3
+`
+
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running FIX: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": -3, "b": -2, "c": 2, "d": 2, "e": -3}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+}
+
+// TestCeil contrasts CEIL, which rounds up, with INT which rounds down.
+func TestCeil(t *testing.T) {
+
+	tests := []struct {
+		Input float64
+		Int   float64
+		Ceil  float64
+	}{
+		{Input: 2.1, Int: 2, Ceil: 3},
+		{Input: -2.1, Int: -3, Ceil: -2},
+		{Input: 4, Int: 4, Ceil: 4},
+		{Input: -4, Int: -4, Ceil: -4},
+	}
+
+	for _, test := range tests {
+		obj := Compile(`10 LET i = INT(x)
+20 LET c = CEIL(x)
+`)
+		obj.SetVariable("x", &object.NumberObject{Value: test.Input})
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running CEIL %f: %s", test.Input, err.Error())
+			continue
+		}
+		if getFloat(t, obj, "i") != test.Int {
+			t.Errorf("INT %f: expected %f, got %f", test.Input, test.Int, getFloat(t, obj, "i"))
+		}
+		if getFloat(t, obj, "c") != test.Ceil {
+			t.Errorf("CEIL %f: expected %f, got %f", test.Input, test.Ceil, getFloat(t, obj, "c"))
+		}
+	}
+
+	obj := Compile(`10 LET c = CEIL("Steve")`)
+	err := obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error running CEIL of a string")
+	}
+}
+
+// TestRound tests rounding, to an optional number of decimal places.
+func TestRound(t *testing.T) {
+	input := `10 LET a = ROUND(2.5)
+20 LET b = ROUND(2.45, 1)
+30 LET c = ROUND(-2.5)
+40 LET d = ROUND(1234.5678, 2)
+50 LET e = ROUND(1250, -2)
+60 LET f = ROUND 2.4
+70 LET g = ROUND(7, 0)
+`
+
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running ROUND: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 3, "b": 2.5, "c": -3, "d": 1234.57, "e": 1300, "f": 2, "g": 7}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a = ROUND()`,
+		`10 LET a = ROUND(1, 2, 3)`,
+		`10 LET a = ROUND("Steve")`,
+		`10 LET a = ROUND(1, "Steve")`,
+		`10 LET a = ROUND(1, 1.5)`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestCLOG tests logarithms to the base 10.
+func TestCLOG(t *testing.T) {
+	input := `10 LET a = CLOG(100)
+20 LET b = CLOG(1)
+30 LET c = LOG10 1000
+`
+
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running CLOG: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 2, "b": 0, "c": 3}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a = CLOG(0)`,
+		`10 LET a = CLOG(-1)`,
+		`10 LET a = CLOG("Steve")`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
 // TestSGN ensures that the sign-extend function works
 func TestSGN(t *testing.T) {
 	input := `10 REM
@@ -401,6 +541,353 @@ func TestMaths(t *testing.T) {
 	}
 }
 
+// TestNegate tests the unary minus operator.
+func TestNegate(t *testing.T) {
+	input := `
+10 LET Y = 4
+20 LET A = 1
+30 LET B = 2
+40 LET N1 = -Y
+50 LET N2 = --Y
+60 LET N3 = -(A + B)
+70 LET N4 = 2 * -Y
+80 LET N5 = -Y * -A
+90 LET N6 = 10 - -Y
+100 LET N7 = - 3
+`
+
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error negating: %s", err.Error())
+	}
+
+	vals := map[string]float64{"N1": -4, "N2": 4, "N3": -3, "N4": -8, "N5": 4, "N6": 14, "N7": -3}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	obj = Compile(`10 LET S = "Steve"
+20 LET N = -S
+`)
+	err = obj.Run()
+	if err == nil || !strings.Contains(err.Error(), "cannot negate") {
+		t.Errorf("Expected an error negating a string, got %v", err)
+	}
+}
+
+// TestMaxMin tests our MAX and MIN functions.
+func TestMaxMin(t *testing.T) {
+
+	tests := []struct {
+		Input string
+		Max   float64
+		Min   float64
+	}{
+		{Input: "3, 3", Max: 3, Min: 3},
+		{Input: "1, 2", Max: 2, Min: 1},
+		{Input: "-5, -2", Max: -2, Min: -5},
+		{Input: "1.5, 1.25", Max: 1.5, Min: 1.25},
+		{Input: "-7, 4", Max: 4, Min: -7},
+		{Input: "0.5, -0.5", Max: 0.5, Min: -0.5},
+	}
+
+	for _, test := range tests {
+		obj := Compile("10 LET a = MAX(" + test.Input + ")\n20 LET b = MIN(" + test.Input + ")\n")
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running MAX/MIN of %s: %s", test.Input, err.Error())
+			continue
+		}
+		if getFloat(t, obj, "a") != test.Max {
+			t.Errorf("MAX(%s): expected %f, got %f", test.Input, test.Max, getFloat(t, obj, "a"))
+		}
+		if getFloat(t, obj, "b") != test.Min {
+			t.Errorf("MIN(%s): expected %f, got %f", test.Input, test.Min, getFloat(t, obj, "b"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a = MAX("Steve", 3)`,
+		`10 LET a = MIN(3, "Steve")`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestStop tests the STOP statement, with and without a callback.
+func TestStop(t *testing.T) {
+
+	input := `10 LET a = 3
+20 LET b$ = "Steve"
+30 STOP
+40 LET a = 4
+50 IF a = 4 THEN STOP
+60 LET STOP = 1
+`
+	var lines []string
+	var values []float64
+
+	obj := Compile(input)
+	obj.SetStopCallback(func(lineno string, vars map[string]object.Object) {
+		lines = append(lines, lineno)
+		values = append(values, vars["a"].(*object.NumberObject).Value)
+
+		if vars["b$"].(*object.StringObject).Value != "Steve" {
+			t.Errorf("STOP received the wrong value for b$: %v", vars["b$"])
+		}
+		if _, ok := vars["RED"]; ok {
+			t.Errorf("STOP received a constant")
+		}
+	})
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running STOP: %s", err.Error())
+	}
+	if strings.Join(lines, ",") != "30,50" {
+		t.Errorf("STOP received the wrong lines: %v", lines)
+	}
+	if len(values) != 2 || values[0] != 3 || values[1] != 4 {
+		t.Errorf("STOP received the wrong values: %v", values)
+	}
+	if getFloat(t, obj, "STOP") != 1 {
+		t.Errorf("Execution didn't continue after STOP")
+	}
+
+	//
+	// Without a callback STOP ends the program.
+	//
+	obj = Compile(input)
+	err = obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running STOP: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 3 {
+		t.Errorf("STOP didn't end the program")
+	}
+}
+
+// TestStepCallback tests the callback invoked before each statement.
+func TestStepCallback(t *testing.T) {
+
+	input := `10 LET a = 1 : LET b = 2
+20 REM Comment
+
+30 IF a = 1 THEN PRINT "X";
+40 END
+`
+	var steps []string
+
+	obj := Compile(input)
+	obj.SetOutput(&bytes.Buffer{})
+	obj.SetStepCallback(func(lineno string, tok token.Token) {
+		steps = append(steps, lineno+":"+tok.Literal)
+	})
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running program: %s", err.Error())
+	}
+
+	expected := "10:LET 10:LET 20:REM 30:IF 30:PRINT 40:END"
+	if strings.Join(steps, " ") != expected {
+		t.Errorf("Wrong steps, expected '%s', got '%s'", expected, strings.Join(steps, " "))
+	}
+}
+
+// TestMaxIterations tests limiting the number of steps a program may
+// execute.
+func TestMaxIterations(t *testing.T) {
+
+	obj := Compile(`10 LET a = 1
+20 GOTO 20
+`)
+	obj.SetMaxIterations(1000)
+	err := obj.Run()
+	if err == nil {
+		t.Fatalf("Expected an error from an infinite loop")
+	}
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected a RuntimeError, got %T", err)
+	}
+	if rerr.Line != "20" || !strings.Contains(rerr.Message, "1000 iterations") {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	//
+	// The limit applies to each run.
+	//
+	input := `10 FOR I = 1 TO 100
+20 LET a = I
+30 NEXT I
+`
+	obj = Compile(input)
+	obj.SetMaxIterations(1000)
+	for i := 0; i < 2; i++ {
+		obj.offset = 0
+		err = obj.Run()
+		if err != nil {
+			t.Errorf("Found error running program %d: %s", i, err.Error())
+		}
+	}
+
+	//
+	// Without a limit we run until the end.
+	//
+	obj = Compile(input + "40 FOR J = 1 TO 10000 : LET b = J : NEXT J\n")
+	obj.SetMaxIterations(0)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running without a limit: %s", err.Error())
+	}
+	if getFloat(t, obj, "b") != 10000 {
+		t.Errorf("The program didn't run to the end")
+	}
+}
+
+// TestSwap tests exchanging variables via SWAP.
+func TestSwap(t *testing.T) {
+
+	obj := Compile(`10 LET a = 1 : LET b = 2
+20 SWAP a, b
+30 LET a$ = "Steve" : LET b$ = "Kemp"
+40 SWAP a$, b$
+50 LET c = 3
+60 SWAP c, c
+`)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running SWAP: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 2 || getFloat(t, obj, "b") != 1 {
+		t.Errorf("Numbers weren't swapped: %f %f", getFloat(t, obj, "a"), getFloat(t, obj, "b"))
+	}
+	if getString(t, obj, "a$") != "Kemp" || getString(t, obj, "b$") != "Steve" {
+		t.Errorf("Strings weren't swapped: %s %s", getString(t, obj, "a$"), getString(t, obj, "b$"))
+	}
+	if getFloat(t, obj, "c") != 3 {
+		t.Errorf("Swapping a variable with itself changed it: %f", getFloat(t, obj, "c"))
+	}
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `10 LET a = 1 : LET b$ = "Steve" : SWAP a, b$`, Error: "type mismatch"},
+		{Input: `10 LET a = 1 : SWAP a, b`, Error: "doesn't exist"},
+		{Input: `10 LET a = 1 : SWAP a, RED`, Error: "constant"},
+		{Input: `10 LET a = 1 : LET b = 2 : SWAP a b`, Error: "SWAP should be"},
+		{Input: `10 SWAP 1, 2`, Error: "SWAP should be"},
+	}
+
+	for _, test := range tests {
+		obj = Compile(test.Input)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("Expected error '%s' running '%s', got %v", test.Error, test.Input, err)
+		}
+	}
+}
+
+// TestSleep tests pausing via SLEEP.
+func TestSleep(t *testing.T) {
+
+	start := time.Now()
+	obj := Compile(`10 SLEEP 0.05 : LET a = 1
+20 SLEEP -3
+30 SLEEP 0
+`)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running SLEEP: %s", err.Error())
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("SLEEP didn't pause")
+	}
+	if getFloat(t, obj, "a") != 1 {
+		t.Errorf("SLEEP didn't continue with the next statement")
+	}
+
+	for _, prg := range []string{`10 SLEEP "Steve"`,
+		`10 SLEEP`,
+		`10 SLEEP 1E6`,
+		`10 SLEEP 1E300`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+
+	// Long pauses are refused in sandbox mode.
+	obj = Compile(`10 SLEEP 60`)
+	obj.SetSandbox(true)
+	err = obj.Run()
+	if err == nil || !strings.Contains(err.Error(), "maximum of 5 seconds") {
+		t.Errorf("Expected an error sleeping in sandbox mode, got %v", err)
+	}
+}
+
+// TestRandomize tests seeding RND via RANDOMIZE.
+func TestRandomize(t *testing.T) {
+
+	// run returns the output of the given program.
+	run := func(prg string) string {
+		var out bytes.Buffer
+		obj := Compile(prg)
+		obj.SetOutput(&out)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", prg, err.Error())
+		}
+		return out.String()
+	}
+
+	seeded := `10 RANDOMIZE 1234 : PRINT "X"
+20 FOR I = 1 TO 10
+30 PRINT RND 1000000; " ";
+40 NEXT I
+`
+	a := run(seeded)
+	b := run(seeded)
+	if a != b {
+		t.Errorf("Seeded runs differ: '%s' != '%s'", a, b)
+	}
+	if !strings.HasPrefix(a, "X\n") {
+		t.Errorf("RANDOMIZE didn't continue with the statement after it: '%s'", a)
+	}
+	if a == run(strings.Replace(seeded, "1234", "4321", 1)) {
+		t.Errorf("Different seeds produced the same output")
+	}
+
+	unseeded := `10 FOR I = 1 TO 10
+20 PRINT RND 1000000; " ";
+30 NEXT I
+`
+	if run(unseeded) == run(unseeded) {
+		t.Errorf("Unseeded runs produced the same output")
+	}
+	if run("10 RANDOMIZE\n"+unseeded) == run("10 RANDOMIZE\n"+unseeded) {
+		t.Errorf("Runs seeded by the time produced the same output")
+	}
+
+	for _, prg := range []string{`10 RANDOMIZE "Steve"`,
+		`10 RANDOMIZE 1.5`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
 // TestFor runs a single simple FOR loop
 func TestFor(t *testing.T) {
 	input := `
@@ -419,6 +906,79 @@ func TestFor(t *testing.T) {
 	}
 }
 
+// TestForStepExpression ensures the STEP of a FOR loop may be an expression.
+func TestForStepExpression(t *testing.T) {
+	input := `
+10 LET SUM = 0
+20 LET S = 2
+30 FOR I = 10 TO 0 STEP S * -1
+40 LET SUM = SUM + I
+50 NEXT I
+`
+
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "SUM") != 30 {
+		t.Errorf("Value not expected!")
+	}
+
+	// A fractional step isn't mistaken for a step of zero.
+	input = `
+10 LET SUM = 0
+20 LET S = 2
+30 FOR I = 0 TO 1 STEP S / 4
+40 LET SUM = SUM + I
+50 NEXT I
+`
+
+	obj = Compile(input)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Unexpected error with STEP 0.5: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "SUM") != 1.5 {
+		t.Errorf("Value not expected with STEP 0.5: %v", getFloat(t, obj, "SUM"))
+	}
+}
+
+// TestForFloat ensures FOR loops handle non-integer values, and steps
+// which move beyond the end-value.
+func TestForFloat(t *testing.T) {
+
+	tests := []struct {
+		Loop string
+		Sum  float64
+	}{
+		{Loop: "FOR I = 1 TO 2.5 STEP 0.5", Sum: 7},
+		{Loop: "FOR I = 0 TO 1 STEP 0.1", Sum: 5.5},
+		{Loop: "FOR I = 1 TO 10 STEP 2", Sum: 25},
+		{Loop: "FOR I = 10 TO 1 STEP -3", Sum: 22},
+	}
+
+	for _, test := range tests {
+		input := fmt.Sprintf(`10 LET SUM = 0
+20 %s
+30 LET SUM = SUM + I
+40 NEXT I
+`, test.Loop)
+
+		obj := Compile(input)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Unexpected error running '%s': %s", test.Loop, err.Error())
+		}
+
+		if math.Abs(getFloat(t, obj, "SUM")-test.Sum) > 1e-9 {
+			t.Errorf("'%s' gave %v, expected %v", test.Loop, getFloat(t, obj, "SUM"), test.Sum)
+		}
+	}
+}
+
 // TestForTerm ensures that a for-loop with start/end the same runs only once.
 func TestForTerm(t *testing.T) {
 	input := `
@@ -446,6 +1006,8 @@ func TestBogusFor(t *testing.T) {
 		"10 FOR I=1\n",
 		"10 FOR I=1 TO\n",
 		"10 FOR I=1 TO 10 STEP STEP\n",
+		"10 FOR I=1 TO 10 STEP 0\n",
+		"10 FOR I=1 TO 10 STEP \"steve\"\n",
 		"10 FOR I=1 TO 20\n20NEXT 3\n",
 		`10 LET TERM="steve"
 20 FOR I = 1 TO TERM`,
@@ -493,6 +1055,50 @@ func TestPrint(t *testing.T) {
 	}
 }
 
+// TestPrintExpressions tests that PRINT evaluates expressions, and
+// reports bogus input.
+func TestPrintExpressions(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: `10 PRINT 3 + 5`, Output: "8\n"},
+		{Input: `10 LET a = 5 : PRINT a - 2; -a`, Output: "3-5\n"},
+		{Input: `10 PRINT ( 3 * ( 3 + 4 ) ) "X" "Y"`, Output: "21XY\n"},
+		{Input: `10 PRINT "a" + "b", LEN "Steve"`, Output: "ab            5\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		obj := Compile(test.Input)
+		obj.SetOutput(&out)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Unexpected error running '%s': %s", test.Input, err.Error())
+		}
+		if out.String() != test.Output {
+			t.Errorf("'%s' printed '%s', expected '%s'", test.Input, out.String(), test.Output)
+		}
+	}
+
+	for _, prg := range []string{`10 PRINT = 3`, `10 PRINT "a" - 3`, `10 PRINT )`,
+		`10 LET A = 1 : LET B = 2 : PRINT A = B`,
+		`10 PRINT "Steve", 3; 1 / 0`,
+	} {
+		var out bytes.Buffer
+		obj := Compile(prg)
+		obj.SetOutput(&out)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+		if out.Len() != 0 {
+			t.Errorf("'%s' printed '%s' before failing", prg, out.String())
+		}
+	}
+}
+
 // TestREM ensures that REM is handled.
 func TestREM(t *testing.T) {
 
@@ -701,12 +1307,109 @@ func TestBIN(t *testing.T) {
 	}
 }
 
-// TestIfBIN tests our IF function
-func TestIFBIN(t *testing.T) {
+// TestRadixLiterals tests hexadecimal, octal, and binary numbers, as
+// well as scientific notation.
+func TestRadixLiterals(t *testing.T) {
 	input := `
-10 LET A = 1
-20 LET B = 0
-30 LET C = 0
+10 LET x = &H10
+20 LET y = &O10
+30 LET z = &B1010
+40 LET w = &hff + &b1
+50 LET e1 = 1E3
+60 LET e2 = 2.5E-1
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error: %s", err.Error())
+	}
+
+	vals := map[string]float64{"x": 16, "y": 8, "z": 10, "w": 256, "e1": 1000, "e2": 0.25}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+}
+
+// TestHex tests our HEX$ function.
+func TestHex(t *testing.T) {
+
+	tests := map[string]string{
+		"0":          "0",
+		"15":         "F",
+		"255":        "FF",
+		"65535":      "FFFF",
+		"2147483647": "7FFFFFFF",
+		"-1":         "FFFFFFFF",
+	}
+
+	for in, out := range tests {
+		obj := Compile("10 LET a$ = HEX$(" + in + ")\n")
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running HEX$ %s: %s", in, err.Error())
+			continue
+		}
+		if getString(t, obj, "a$") != out {
+			t.Errorf("HEX$ %s: expected %s, got %s", in, out, getString(t, obj, "a$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a$ = HEX$ 1.5`,
+		`10 LET a$ = HEX$ "Steve"`,
+		`10 LET a$ = HEX$ 4294967296`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestOct tests our OCT$ function.
+func TestOct(t *testing.T) {
+
+	tests := map[string]string{
+		"0":   "0",
+		"7":   "7",
+		"8":   "10",
+		"64":  "100",
+		"255": "377",
+		"511": "777",
+		"-1":  "37777777777",
+	}
+
+	for in, out := range tests {
+		obj := Compile("10 LET a$ = OCT$(" + in + ")\n")
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running OCT$ %s: %s", in, err.Error())
+			continue
+		}
+		if getString(t, obj, "a$") != out {
+			t.Errorf("OCT$ %s: expected %s, got %s", in, out, getString(t, obj, "a$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a$ = OCT$ 1.5`,
+		`10 LET a$ = OCT$ "Steve"`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestIfBIN tests our IF function
+func TestIFBIN(t *testing.T) {
+	input := `
+10 LET A = 1
+20 LET B = 0
+30 LET C = 0
 40 LET D = 0
 50 IF A = 1 OR B = 1 THEN LET C = 1
 60 IF A = 1 AND B = 0 THEN LET D = 1
@@ -861,12 +1564,17 @@ func TestBogusInput(t *testing.T) {
 // TestDump calls DUMP
 func TestDump(t *testing.T) {
 
-	obj := Compile("10 DUMP 3\n")
+	obj := Compile("10 DUMP 3\n20 DUMP \"Steve\"\n")
+	var out bytes.Buffer
+	obj.SetOutput(&out)
 	err := obj.Run()
 
 	if err != nil {
 		t.Errorf("Found error calling DUMP\n")
 	}
+	if out.String() != "NUMBER: 3.000000\nSTRING: Steve\n" {
+		t.Errorf("DUMP wrote the wrong output: '%s'", out.String())
+	}
 }
 
 // TestBuiltinError tests that a builtin-error is handled.
@@ -1108,3 +1816,3375 @@ func TestIssue37(t *testing.T) {
 	}
 
 }
+
+// TestCall ensures that CALL invokes registered functions.
+func TestCall(t *testing.T) {
+
+	input := `10 LET A = 3
+20 CALL "sum", A, 4, 5
+30 LET B = CALL_RESULT
+40 CALL "sum"
+`
+	obj := Compile(input)
+
+	count := 0
+	obj.RegisterCall("sum", func(env *Interpreter, args []object.Object) object.Object {
+		count++
+		total := 0.0
+		for _, arg := range args {
+			if arg.Type() != object.NUMBER {
+				return object.Error("Wrong type")
+			}
+			total += arg.(*object.NumberObject).Value
+		}
+		return &object.NumberObject{Value: total}
+	})
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running CALL: %s", err.Error())
+	}
+	if count != 2 {
+		t.Errorf("CALL invoked the function %d times, not 2", count)
+	}
+	if getFloat(t, obj, "B") != 12 {
+		t.Errorf("CALL passed the wrong arguments!")
+	}
+	if getFloat(t, obj, "CALL_RESULT") != 0 {
+		t.Errorf("CALL_RESULT was not updated!")
+	}
+}
+
+// TestBogusCall ensures that bogus CALL statements are caught.
+func TestBogusCall(t *testing.T) {
+
+	inputs := []string{
+		`10 CALL`,
+		`10 CALL 3`,
+		`10 CALL "missing", 1`,
+		`10 CALL "fail", 1`,
+	}
+
+	for _, txt := range inputs {
+
+		obj := Compile(txt)
+		obj.RegisterCall("fail", func(env *Interpreter, args []object.Object) object.Object {
+			return object.Error("CALL failed")
+		})
+
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("We expected to find an error, but didn't")
+		}
+		if !strings.Contains(err.Error(), "CALL") {
+			t.Errorf("The error we found was not what we expected: %s", err.Error())
+		}
+	}
+}
+
+// TestEnviron tests our ENVIRON$ function.
+func TestEnviron(t *testing.T) {
+
+	os.Setenv("GOBASIC_TEST", "steve")
+
+	input := `10 LET a = ENVIRON$ "GOBASIC_TEST"
+20 LET b = ENVIRON$ "GOBASIC_TEST_MISSING"
+30 LET c = ENVIRON$ 1
+40 LET d = ENVIRON$ 0
+50 LET e = ENVIRON$ 1000000
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running ENVIRON$: %s", err.Error())
+	}
+
+	if getString(t, obj, "a") != "steve" {
+		t.Errorf("ENVIRON$ by name failed!")
+	}
+	if getString(t, obj, "b") != "" {
+		t.Errorf("ENVIRON$ of a missing variable failed!")
+	}
+	if getString(t, obj, "c") != os.Environ()[0] {
+		t.Errorf("ENVIRON$ by number failed!")
+	}
+	if getString(t, obj, "d") != "" {
+		t.Errorf("ENVIRON$ 0 should be empty!")
+	}
+	if getString(t, obj, "e") != "" {
+		t.Errorf("ENVIRON$ out of range should be empty!")
+	}
+
+	obj = Compile(`10 LET a = ENVIRON$ "GOBASIC_TEST"`)
+	obj.SetSandbox(true)
+	err = obj.Run()
+	if err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Errorf("Expected a sandbox error, got %v", err)
+	}
+}
+
+// TestDates tests our date-arithmetic functions.
+func TestDates(t *testing.T) {
+
+	input := `10 LET a = DATEADD$ "31/01/2018", 1, "DAY"
+20 LET b = DATEADD$ "15/01/2018", 2, "month"
+30 LET c = DATEADD$ "29/02/2016", -1, "YEAR"
+40 LET d = DATEDIFF "01/01/2018", "01/03/2018", "DAY"
+50 LET e = DATEDIFF "15/01/2018", "14/03/2018", "MONTH"
+60 LET f = DATEDIFF "01/01/2018", "01/01/2016", "YEAR"
+70 LET g = DATEVALID "31/02/2018"
+80 LET h = DATEVALID "28/02/2018"
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running date functions: %s", err.Error())
+	}
+
+	strs := map[string]string{"a": "01/02/2018",
+		"b": "15/03/2018",
+		"c": "01/03/2015"}
+	for name, val := range strs {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected %s, got %s", name, val, getString(t, obj, name))
+		}
+	}
+
+	nums := map[string]float64{"d": 59,
+		"e": 1,
+		"f": -2,
+		"g": 0,
+		"h": 1}
+	for name, val := range nums {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+}
+
+// TestTimer tests TIMER counts the seconds since we started.
+func TestTimer(t *testing.T) {
+
+	obj := Compile(`10 LET a = TIMER
+20 LET b = TIMER
+`)
+	obj.startTime = time.Now().Add(-90 * time.Second)
+
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running TIMER: %s", err.Error())
+	}
+
+	a := getFloat(t, obj, "a")
+	b := getFloat(t, obj, "b")
+	if a < 90 || a > 100 {
+		t.Errorf("Unexpected value for TIMER: %f", a)
+	}
+	if b < a {
+		t.Errorf("TIMER went backwards: %f then %f", a, b)
+	}
+}
+
+// TestDateTime tests DATE$ and TIME$, with a fixed clock.
+func TestDateTime(t *testing.T) {
+
+	input := `10 LET d$ = DATE$
+20 LET t$ = TIME$
+30 LET i$ = DATE$("2006-01-02")
+40 LET h$ = TIME$("15h04")
+50 IF DATE$ = "16/10/2026" THEN LET ok = 1
+60 PRINT DATE$, TIME$
+`
+	obj := Compile(input)
+	obj.clock = func() time.Time {
+		return time.Date(2026, time.October, 16, 9, 5, 3, 0, time.UTC)
+	}
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running DATE$: %s", err.Error())
+	}
+
+	vals := map[string]string{"d$": "16/10/2026", "t$": "09:05:03", "i$": "2026-10-16", "h$": "09h05"}
+	for name, val := range vals {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected '%s', got '%s'", name, val, getString(t, obj, name))
+		}
+	}
+	if getFloat(t, obj, "ok") != 1 {
+		t.Errorf("DATE$ failed to compare")
+	}
+	if out.String() != "16/10/2026    09:05:03\n" {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+
+	for _, prg := range []string{`10 LET d$ = DATE$(3)`,
+		`10 LET t$ = TIME$("15", "04")`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestBogusDates tests that invalid dates and units are errors.
+func TestBogusDates(t *testing.T) {
+
+	inputs := []string{
+		`10 LET a = DATEADD$ "31/02/2018", 1, "DAY"`,
+		`10 LET a = DATEADD$ "01/02/2018", 1, "WEEK"`,
+		`10 LET a = DATEDIFF "01/02/2018", "steve", "DAY"`,
+		`10 LET a = DATEDIFF "01/02/2018", "01/02/2018", "HOUR"`,
+	}
+
+	for _, txt := range inputs {
+
+		obj := Compile(txt)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("We expected to find an error, but didn't")
+		}
+		if !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("The error we found was not what we expected: %s", err.Error())
+		}
+	}
+}
+
+// TestTermSize tests that the terminal-size functions return something sane.
+func TestTermSize(t *testing.T) {
+
+	input := `10 LET W = TERMWIDTH
+20 LET H = TERMHEIGHT
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running TERMWIDTH/TERMHEIGHT: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "W") < 1 {
+		t.Errorf("TERMWIDTH returned a bogus value")
+	}
+	if getFloat(t, obj, "H") < 1 {
+		t.Errorf("TERMHEIGHT returned a bogus value")
+	}
+
+	// When our output isn't a terminal we get the defaults, even if
+	// STDOUT is one.
+	obj = Compile(input)
+	obj.SetOutput(&bytes.Buffer{})
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running TERMWIDTH/TERMHEIGHT: %s", err.Error())
+	}
+	if getFloat(t, obj, "W") != 80 || getFloat(t, obj, "H") != 24 {
+		t.Errorf("Wrong size for a buffer: %vx%v", getFloat(t, obj, "W"), getFloat(t, obj, "H"))
+	}
+}
+
+// TestColourConstants tests that our colour-names are predefined.
+func TestColourConstants(t *testing.T) {
+
+	input := `10 LET a = RED
+20 LET b = WHITE + BLACK
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error using colour constants: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 1 {
+		t.Errorf("RED had the wrong value")
+	}
+	if getFloat(t, obj, "b") != 7 {
+		t.Errorf("WHITE + BLACK had the wrong value")
+	}
+
+	// Constants cannot be changed
+	inputs := []string{
+		`10 LET BLACK = 5`,
+		`10 FOR RED = 1 TO 10`,
+		`10 INPUT "Colour?", GREEN`,
+	}
+	for _, txt := range inputs {
+		obj := Compile(txt)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("We expected to find an error, but didn't")
+		}
+		if !strings.Contains(err.Error(), "is a constant") {
+			t.Errorf("The error we found was not what we expected: %s", err.Error())
+		}
+	}
+}
+
+// TestPrintString tests our PRINT$ function.
+func TestPrintString(t *testing.T) {
+
+	input := `10 LET T = "Title"
+20 LET a = "=== " + PRINT$(T, "===")
+30 LET b = PRINT$ 3, 1.5; "x"
+40 LET c = PRINT$()
+50 LET d = PRINT$
+60 LET e = PRINT$(T) + "!"
+70 LET f = PRINT$(T; " ==="; ) + PRINT$ 1 + 2; TAB(4); "x"
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running PRINT$: %s", err.Error())
+	}
+
+	strs := map[string]string{"a": "=== Title         ===",
+		"b": "3             1.5x",
+		"c": "",
+		"d": "",
+		"e": "Title!",
+		"f": "Title ===3   x"}
+	for name, val := range strs {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected '%s', got '%s'", name, val, getString(t, obj, name))
+		}
+	}
+}
+
+// TestBracketedArguments tests that builtin-arguments may be bracketed.
+func TestBracketedArguments(t *testing.T) {
+
+	input := `10 LET a = LEFT$("Steve", 2)
+20 LET b = LEN("Steve") + 1
+30 LET c = MID$("Steve", 1, LEN("abc"))
+40 LET d = LEFT$ ("Steve"), 3
+50 LET e = PI()
+60 LET f = ( LEN "Steve" ) * 2
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running bracketed builtins: %s", err.Error())
+	}
+
+	if getString(t, obj, "a") != "St" {
+		t.Errorf("LEFT$ failed, got '%s'", getString(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 6 {
+		t.Errorf("LEN failed, got %f", getFloat(t, obj, "b"))
+	}
+	if getString(t, obj, "c") != "tev" {
+		t.Errorf("MID$ failed, got '%s'", getString(t, obj, "c"))
+	}
+	if getString(t, obj, "d") != "Ste" {
+		t.Errorf("LEFT$ failed, got '%s'", getString(t, obj, "d"))
+	}
+	if getFloat(t, obj, "e") != math.Pi {
+		t.Errorf("PI failed, got %f", getFloat(t, obj, "e"))
+	}
+	if getFloat(t, obj, "f") != 10 {
+		t.Errorf("LEN failed, got %f", getFloat(t, obj, "f"))
+	}
+
+	// Unclosed/bogus arguments
+	obj = Compile(`10 LET a = PRINT$("steve" = 3)`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+	if !strings.Contains(err.Error(), "in arguments to") {
+		t.Errorf("The error we found was not what we expected: %s", err.Error())
+	}
+}
+
+// TestVALSTR tests our VAL$ function.
+func TestVALSTR(t *testing.T) {
+
+	input := `10 LET a = VAL$ 3.0
+20 LET b = VAL$(3.14)
+30 LET c = VAL$ -17
+40 LET d = VAL VAL$ 0.125
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running VAL$: %s", err.Error())
+	}
+
+	if getString(t, obj, "a") != "3" {
+		t.Errorf("VAL$ 3.0 failed, got '%s'", getString(t, obj, "a"))
+	}
+	if getString(t, obj, "b") != "3.14" {
+		t.Errorf("VAL$ 3.14 failed, got '%s'", getString(t, obj, "b"))
+	}
+	if getString(t, obj, "c") != "-17" {
+		t.Errorf("VAL$ -17 failed, got '%s'", getString(t, obj, "c"))
+	}
+	if getFloat(t, obj, "d") != 0.125 {
+		t.Errorf("VAL VAL$ failed, got %f", getFloat(t, obj, "d"))
+	}
+
+	obj = Compile(`10 LET a = VAL$ "steve"`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestReturnValue tests that RETURN can pass a value back to the caller.
+func TestReturnValue(t *testing.T) {
+
+	input := `10 LET N = 5
+20 GOSUB 100
+30 LET a = GOSUB_RESULT
+40 LET N = 7
+50 GOSUB 100
+60 LET b = GOSUB_RESULT
+70 GOSUB 200
+80 LET c = GOSUB_RESULT
+90 END
+100 RETURN N * N
+200 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running RETURN: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "a") != 25 {
+		t.Errorf("RETURN value 1 failed, got %f", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 49 {
+		t.Errorf("RETURN value 2 failed, got %f", getFloat(t, obj, "b"))
+	}
+	if getFloat(t, obj, "c") != 49 {
+		t.Errorf("A bare RETURN modified GOSUB_RESULT")
+	}
+
+	obj = Compile(`10 GOSUB 20
+20 RETURN "steve" * 3
+`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestPrintSeparators tests the handling of newlines, commas, and
+// semicolons in PRINT statements.
+func TestPrintSeparators(t *testing.T) {
+
+	type PrintTest struct {
+		Input  string
+		Output string
+	}
+
+	tests := []PrintTest{
+		{Input: `10 PRINT "A"`, Output: "A\n"},
+		{Input: `10 PRINT`, Output: "\n"},
+		{Input: `10 PRINT "A"; "B"`, Output: "AB\n"},
+		{Input: `10 PRINT "A";`, Output: "A"},
+		{Input: `10 PRINT ;`, Output: ""},
+		{Input: `10 PRINT "A"; : PRINT "B"`, Output: "AB\n"},
+		{Input: `10 PRINT "A", "B"`, Output: "A             B\n"},
+		{Input: `10 PRINT "A",`, Output: "A             "},
+		{Input: `10 PRINT "ABCDEFGHIJKLMNOP", "B"`, Output: "ABCDEFGHIJKLMNOP            B\n"},
+		{Input: `10 LET a = 3
+20 PRINT "a is "; a; ".";
+30 PRINT "!"`, Output: "a is 3.!\n"},
+		{Input: `10 PRINT "12345";
+20 PRINT "67", "X"`, Output: "1234567       X\n"},
+		{Input: `10 IF 1 = 1 THEN PRINT "T" ELSE PRINT "F"`, Output: "T\n"},
+		{Input: `10 IF 1 = 2 THEN PRINT "T" ELSE PRINT "F"`, Output: "F\n"},
+		{Input: `10 IF 1 = 2 THEN PRINT "T" ELSE GOTO 30
+20 PRINT "F"
+30 PRINT "G"`, Output: "G\n"},
+		{Input: `10 IF 1 = 1 THEN PRINT "A"; : PRINT "B" ELSE PRINT "C"; : PRINT "D"`, Output: "AB\n"},
+		{Input: `10 IF 1 = 2 THEN PRINT "A"; : PRINT "B" ELSE PRINT "C"; : PRINT "D"`, Output: "CD\n"},
+		{Input: `10 IF 1 = 2 THEN PRINT "A" : PRINT "B"
+20 PRINT "C"`, Output: "C\n"},
+		{Input: `10 IF 1 = 1 THEN PRINT "A"; : GOTO 30 : PRINT "B"
+20 PRINT "C"
+30 PRINT "D"`, Output: "AD\n"},
+		{Input: `10 FOR I = 1 TO 3 : PRINT I; : NEXT I : GOSUB 30 : PRINT "C" : END
+30 PRINT "S"; : RETURN`, Output: "123SC\n"},
+	}
+
+	for _, test := range tests {
+
+		var buf bytes.Buffer
+
+		obj := Compile(test.Input)
+		obj.SetOutput(&buf)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", test.Input, err.Error())
+		}
+		if buf.String() != test.Output {
+			t.Errorf("Output of '%s' was '%s', expected '%s'", test.Input, buf.String(), test.Output)
+		}
+	}
+}
+
+// TestPrintUsing tests formatting numbers via PRINT USING.
+func TestPrintUsing(t *testing.T) {
+
+	masks := []struct {
+		Mask   string
+		Value  float64
+		Output string
+	}{
+		{"###.##", 3.14159, "  3.14"},
+		{"###.##", 123.5, "123.50"},
+		{"###", 42, " 42"},
+		{"###.", 42, " 42."},
+		{"###.##", -3.5, " -3.50"},
+		{"###.##", -0.001, "  0.00"},
+		{"+###", 42, " +42"},
+		{"+##", -42, "-42"},
+		{"$###.##", 9.99, "  $9.99"},
+		{"**###", 42, "***42"},
+		{"**$##.##", 5, "***$5.00"},
+		{"##", 123, "%%"},
+		{"#.#", -5, "%%%"},
+		{"Total: ### items", 7, "Total:   7 items"},
+		{"none", 7, "none"},
+	}
+	for _, test := range masks {
+		out := formatUsing(test.Mask, test.Value)
+		if out != test.Output {
+			t.Errorf("formatUsing(%q, %v) gave %q, expected %q", test.Mask, test.Value, out, test.Output)
+		}
+	}
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: `10 PRINT USING "##.#"; 1.26; 2, 3`, Output: " 1.3 2.0 3.0\n"},
+		{Input: `10 LET m = "###" : PRINT USING m; 5;`, Output: "  5"},
+		{Input: `10 OPEN "/dev/null" FOR OUTPUT AS #1 : PRINT #1, USING "#"; 1 : PRINT "ok"`, Output: "ok\n"},
+	}
+	for _, test := range tests {
+
+		var buf bytes.Buffer
+
+		obj := Compile(test.Input)
+		obj.SetOutput(&buf)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", test.Input, err.Error())
+		}
+		if buf.String() != test.Output {
+			t.Errorf("Output of '%s' was '%s', expected '%s'", test.Input, buf.String(), test.Output)
+		}
+	}
+
+	for _, prg := range []string{
+		`10 PRINT USING "##"; "Steve"`,
+		`10 PRINT USING 3; 4`,
+		`10 PRINT USING "##" 4`,
+	} {
+		obj := Compile(prg)
+		obj.SetOutput(&bytes.Buffer{})
+		if obj.Run() == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestTab tests moving to a column via TAB.
+func TestTab(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: `10 PRINT TAB(3); "X"`, Output: "   X\n"},
+		{Input: `10 PRINT "AB"; TAB(5); "X"; TAB(8); "Y"`, Output: "AB   X  Y\n"},
+		{Input: `10 PRINT "ABCDEF"; TAB(3); "X"`, Output: "ABCDEFX\n"},
+		{Input: `10 PRINT "AB"
+20 PRINT TAB(2); "X"`, Output: "AB\n  X\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		obj := Compile(test.Input)
+		obj.SetOutput(&buf)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", test.Input, err.Error())
+		}
+		if buf.String() != test.Output {
+			t.Errorf("Output of '%s' was '%s', expected '%s'", test.Input, buf.String(), test.Output)
+		}
+	}
+
+	for _, prg := range []string{`10 PRINT TAB(0)`,
+		`10 PRINT TAB(-3)`,
+		`10 PRINT TAB(1E18)`,
+		`10 PRINT TAB(1E10)`,
+		`10 PRINT TAB("Steve")`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestSpace tests our SPACE$ function.
+func TestSpace(t *testing.T) {
+
+	for _, n := range []int{0, 1, 10, 1000} {
+		obj := Compile(fmt.Sprintf("10 LET s$ = SPACE$(%d)\n", n))
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running SPACE$ %d: %s", n, err.Error())
+			continue
+		}
+		if getString(t, obj, "s$") != strings.Repeat(" ", n) {
+			t.Errorf("SPACE$ %d: got '%s'", n, getString(t, obj, "s$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET s$ = SPACE$(-1)`,
+		`10 LET s$ = SPACE$(1E18)`,
+		`10 LET s$ = SPACE$("Steve")`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestStringRepeat tests our STRING$ function.
+func TestStringRepeat(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: `STRING$(10, 45)`, Output: "----------"},
+		{Input: `STRING$(3, "-")`, Output: "---"},
+		{Input: `STRING$(3, "ab")`, Output: "aaa"},
+		{Input: `STRING$(2, "é")`, Output: "éé"},
+		{Input: `STRING$(0, 42)`, Output: ""},
+	}
+
+	for _, test := range tests {
+		obj := Compile("10 LET s$ = " + test.Input + "\n")
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running %s: %s", test.Input, err.Error())
+			continue
+		}
+		if getString(t, obj, "s$") != test.Output {
+			t.Errorf("%s: expected '%s', got '%s'", test.Input, test.Output, getString(t, obj, "s$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET s$ = STRING$(-1, 45)`,
+		`10 LET s$ = STRING$(1E18, 45)`,
+		`10 LET s$ = STRING$(3, "")`,
+		`10 LET s$ = STRING$(3, 256)`,
+		`10 LET s$ = STRING$(3, -1)`,
+		`10 LET s$ = STRING$("Steve", 45)`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestFormatNumber tests the display of numbers.
+func TestFormatNumber(t *testing.T) {
+
+	tests := map[float64]string{
+		3:         "3",
+		-17:       "-17",
+		3.14:      "3.14",
+		0.1:       "0.1",
+		1e18:      "1000000000000000000",
+		1e300:     "1e+300",
+		-0.000025: "-2.5e-05",
+	}
+
+	for n, expected := range tests {
+		if formatNumber(n) != expected {
+			t.Errorf("formatNumber(%f) gave '%s', expected '%s'", n, formatNumber(n), expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	obj := Compile(`10 PRINT 19.22; " "; 3.0; " "; PI; " "; STR$ 0.5`)
+	obj.SetOutput(&buf)
+	obj.Run()
+	if buf.String() != "19.22 3 3.141592653589793 0.5\n" {
+		t.Errorf("PRINT formatted numbers incorrectly: '%s'", buf.String())
+	}
+}
+
+// TestSplit tests our SPLIT$ function.
+func TestSplit(t *testing.T) {
+
+	input := `10 LET N = SPLIT$("Steve,Kemp,,Finland", ",")
+20 LET a = SPLIT_0$
+30 LET b = SPLIT_1$
+40 LET c = SPLIT_2$
+50 LET d = SPLIT_3$
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running SPLIT$: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "N") != 4 {
+		t.Errorf("SPLIT$ returned the wrong count: %f", getFloat(t, obj, "N"))
+	}
+	strs := map[string]string{"a": "Steve",
+		"b": "Kemp",
+		"c": "",
+		"d": "Finland"}
+	for name, val := range strs {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected '%s', got '%s'", name, val, getString(t, obj, name))
+		}
+	}
+
+	obj = Compile(`10 LET N = SPLIT$ 3, ","`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestComplex tests our complex-number support.
+func TestComplex(t *testing.T) {
+
+	input := `10 LET C = COMPLEX 1, 2
+20 LET D = C * C + 1
+30 LET R = REAL D
+40 LET I = IMAG D
+50 LET S = SQR -4
+60 LET E = D / COMPLEX 0, 1
+70 PRINT C; " "; E
+`
+	obj := Compile(input)
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+	obj.SetComplexMode(true)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running complex program: %s", err.Error())
+	}
+
+	// (1+2i)^2 + 1 == -2+4i
+	if getFloat(t, obj, "R") != -2 {
+		t.Errorf("Wrong real part: %f", getFloat(t, obj, "R"))
+	}
+	if getFloat(t, obj, "I") != 4 {
+		t.Errorf("Wrong imaginary part: %f", getFloat(t, obj, "I"))
+	}
+
+	s := obj.GetVariable("S")
+	if s.Type() != object.COMPLEX || s.(*object.ComplexObject).Value != complex(0, 2) {
+		t.Errorf("SQR -4 should be 2i in complex mode, got %v", s)
+	}
+
+	if out.String() != "(1+2i) (4+2i)\n" {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+
+	//
+	// Without complex mode we get NaN.
+	//
+	obj = Compile(`10 LET S = SQR -4`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running SQR: %s", err.Error())
+	}
+	if !math.IsNaN(getFloat(t, obj, "S")) {
+		t.Errorf("SQR -4 should be NaN outside complex mode")
+	}
+
+	//
+	// Bogus operations.
+	//
+	bogus := []string{`10 LET C = COMPLEX "1", 2`,
+		`10 LET C = REAL "steve"`,
+		`10 LET C = COMPLEX 1, 2 + "steve"`,
+		`10 LET C = (COMPLEX 1, 2) % 2`,
+		`10 LET C = (COMPLEX 1, 2) / 0`,
+		`10 LET C = (COMPLEX 1, 2) AND 2`,
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestBigInt tests our big-integer mode.
+func TestBigInt(t *testing.T) {
+
+	input := `10 LET A = FACTORIAL 20
+20 LET B = FACTORIAL 25
+30 LET C = B / FACTORIAL 24
+40 LET D = (VAL "123456789012345678901234567890") + 1
+50 LET E$ = STR$ B
+60 LET F = 0
+70 IF B > A THEN LET F = 1
+80 LET G = SIN B
+90 PRINT B
+`
+	obj := Compile(input)
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+	obj.SetBigIntMode(true)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running big-integer program: %s", err.Error())
+	}
+
+	a := obj.GetVariable("A")
+	if a.Type() != object.BIGINT || a.(*object.BigIntObject).Value.String() != "2432902008176640000" {
+		t.Errorf("Wrong value for 20!: %v", a)
+	}
+
+	// 25! / 24! is small again.
+	if getFloat(t, obj, "C") != 25 {
+		t.Errorf("Wrong value for 25!/24!: %f", getFloat(t, obj, "C"))
+	}
+
+	d := obj.GetVariable("D")
+	if d.Type() != object.BIGINT || d.(*object.BigIntObject).Value.String() != "123456789012345678901234567891" {
+		t.Errorf("Wrong value for D: %v", d)
+	}
+
+	if getString(t, obj, "E$") != "15511210043330985984000000" {
+		t.Errorf("Wrong value for STR$: %s", getString(t, obj, "E$"))
+	}
+	if getFloat(t, obj, "F") != 1 {
+		t.Errorf("Big integer comparison failed")
+	}
+	if out.String() != "15511210043330985984000000\n" {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+
+	//
+	// Without big-integer mode we lose precision.
+	//
+	obj = Compile(`10 LET B = FACTORIAL 25`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running FACTORIAL: %s", err.Error())
+	}
+	if obj.GetVariable("B").Type() != object.NUMBER {
+		t.Errorf("Expected a plain number outside big-integer mode")
+	}
+
+	//
+	// Bogus operations.
+	//
+	bogus := []string{`10 LET A = FACTORIAL -1`,
+		`10 LET A = FACTORIAL 1.5`,
+		`10 LET A = FACTORIAL "steve"`,
+		`10 LET A = (FACTORIAL 25) % 0`,
+		`10 LET A = FACTORIAL 10001`,
+		`10 LET A = FACTORIAL 1E18`,
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		obj.SetBigIntMode(true)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestInstr tests our INSTR function.
+func TestInstr(t *testing.T) {
+
+	input := `10 LET a = INSTR("Steve Kemp", "e")
+20 LET b = INSTR(4, "Steve Kemp", "e")
+30 LET c = INSTR("Steve", "x")
+40 LET d = INSTR(9, "Steve", "e")
+50 LET e = INSTR("Steve", "")
+60 LET f = INSTR(1E20, "abc", "b")
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running INSTR: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 3,
+		"b": 5,
+		"c": 0,
+		"d": 0,
+		"e": 1,
+		"f": 0}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a = INSTR("Steve")`,
+		`10 LET a = INSTR(1, "Steve")`,
+		`10 LET a = INSTR("Steve", 3)`,
+		`10 LET a = INSTR(0, "Steve", "e")`,
+		`10 LET a = INSTR("1", "Steve", "e")`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestCase tests our UPPER$ and LOWER$ functions.
+func TestCase(t *testing.T) {
+
+	tests := []struct {
+		Input string
+		Upper string
+		Lower string
+	}{
+		{Input: "hello", Upper: "HELLO", Lower: "hello"},
+		{Input: "WORLD", Upper: "WORLD", Lower: "world"},
+		{Input: "Steve Kemp 123", Upper: "STEVE KEMP 123", Lower: "steve kemp 123"},
+		{Input: "Straße Ωμέγα", Upper: "STRAßE ΩΜΈΓΑ", Lower: "straße ωμέγα"},
+		{Input: "", Upper: "", Lower: ""},
+	}
+
+	for _, test := range tests {
+		obj := Compile(`10 LET u$ = UPPER$("` + test.Input + `")
+20 LET l$ = LOWER$("` + test.Input + `")
+`)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error converting '%s': %s", test.Input, err.Error())
+			continue
+		}
+		if getString(t, obj, "u$") != test.Upper {
+			t.Errorf("UPPER$ '%s': expected '%s', got '%s'", test.Input, test.Upper, getString(t, obj, "u$"))
+		}
+		if getString(t, obj, "l$") != test.Lower {
+			t.Errorf("LOWER$ '%s': expected '%s', got '%s'", test.Input, test.Lower, getString(t, obj, "l$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a$ = UPPER$ 3`,
+		`10 LET a$ = LOWER$ 3`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestTrim tests our TRIM$, LTRIM$, and RTRIM$ functions.
+func TestTrim(t *testing.T) {
+
+	tests := []struct {
+		Input string
+		Trim  string
+		Left  string
+		Right string
+	}{
+		{Input: " hello ", Trim: "hello", Left: "hello ", Right: " hello"},
+		{Input: "\t a  b \n", Trim: "a  b", Left: "a  b \n", Right: "\t a  b"},
+		{Input: "   ", Trim: "", Left: "", Right: ""},
+		{Input: "", Trim: "", Left: "", Right: ""},
+		{Input: "Steve", Trim: "Steve", Left: "Steve", Right: "Steve"},
+	}
+
+	for _, test := range tests {
+		obj := Compile(`10 LET t$ = TRIM$(IN$)
+20 LET l$ = LTRIM$(IN$)
+30 LET r$ = RTRIM$(IN$)
+`)
+		obj.SetVariable("IN$", &object.StringObject{Value: test.Input})
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error trimming '%s': %s", test.Input, err.Error())
+			continue
+		}
+		if getString(t, obj, "t$") != test.Trim {
+			t.Errorf("TRIM$ '%s': expected '%s', got '%s'", test.Input, test.Trim, getString(t, obj, "t$"))
+		}
+		if getString(t, obj, "l$") != test.Left {
+			t.Errorf("LTRIM$ '%s': expected '%s', got '%s'", test.Input, test.Left, getString(t, obj, "l$"))
+		}
+		if getString(t, obj, "r$") != test.Right {
+			t.Errorf("RTRIM$ '%s': expected '%s', got '%s'", test.Input, test.Right, getString(t, obj, "r$"))
+		}
+	}
+
+	for _, prg := range []string{`10 LET a$ = TRIM$ 3`,
+		`10 LET a$ = LTRIM$ 3`,
+		`10 LET a$ = RTRIM$ 3`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestInstrAll tests our INSTRALL function.
+func TestInstrAll(t *testing.T) {
+
+	input := `10 LET N = INSTRALL "AAAA-AA", "AA"
+20 LET a = INSTRALL_0
+30 LET b = INSTRALL_1
+40 LET c = INSTRALL_2
+50 LET M = INSTRALL "Steve", "x"
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running INSTRALL: %s", err.Error())
+	}
+
+	vals := map[string]float64{"N": 3,
+		"a": 1,
+		"b": 3,
+		"c": 6,
+		"M": 0}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	obj = Compile(`10 LET N = INSTRALL "Steve", ""`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestBitCount tests our BITCOUNT function.
+func TestBitCount(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Result float64
+	}{
+		{Input: "0", Result: 0},
+		{Input: "7", Result: 3},
+		{Input: "256", Result: 1},
+		{Input: "-1", Result: 64},
+	}
+
+	for _, test := range tests {
+
+		obj := Compile("10 LET a = BITCOUNT " + test.Input + "\n")
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running BITCOUNT %s: %s", test.Input, err.Error())
+		}
+
+		if getFloat(t, obj, "a") != test.Result {
+			t.Errorf("BITCOUNT %s: expected %f, got %f", test.Input, test.Result, getFloat(t, obj, "a"))
+		}
+	}
+}
+
+// TestGetch tests reading single characters via GETCH.
+func TestGetch(t *testing.T) {
+
+	input := `10 LET a = GETCH
+20 LET b = GETCH()
+`
+	obj := Compile(input)
+	obj.STDIN = bufio.NewReader(strings.NewReader("Ab"))
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running GETCH: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 65 {
+		t.Errorf("GETCH returned the wrong value: %f", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 98 {
+		t.Errorf("GETCH returned the wrong value: %f", getFloat(t, obj, "b"))
+	}
+
+	// Reading past the end of the input is an error.
+	obj = Compile(`10 LET a = GETCH`)
+	obj.STDIN = bufio.NewReader(strings.NewReader(""))
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestSys tests our SYS function.
+func TestSys(t *testing.T) {
+
+	input := `10 LET a = SYS 0
+20 GOSUB 100
+30 FOR I = 1 TO 2
+40 LET d = SYS 3
+50 NEXT I
+60 LET e = SYS 3
+70 END
+100 LET b = SYS 1
+110 LET c = SYS 2
+120 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running SYS: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 10,
+		"b": 1,
+		"c": 2,
+		"d": 1,
+		"e": 0}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	obj = Compile(`10 LET a = SYS 42`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestReplaceLine tests editing a program in-memory.
+func TestReplaceLine(t *testing.T) {
+
+	input := `10 LET a = 1
+20 LET b = 2
+30 GOTO 50
+40 LET c = 3
+50 LET d = 4
+`
+	obj := Compile(input)
+
+	err := obj.ReplaceLine("20", "20 LET b = LEN \"Steve\" : LET e = 5\n")
+	if err != nil {
+		t.Errorf("Error replacing line: %s", err.Error())
+	}
+	err = obj.ReplaceLine("30", "30 GOTO 40")
+	if err != nil {
+		t.Errorf("Error replacing line: %s", err.Error())
+	}
+
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running edited program: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 1,
+		"b": 5,
+		"c": 3,
+		"d": 4,
+		"e": 5}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	//
+	// Bogus edits.
+	//
+	bogus := map[string]string{"60": "60 END",
+		"10": "20 END",
+		"40": "40 END\n50 END",
+	}
+	for n, src := range bogus {
+		err = obj.ReplaceLine(n, src)
+		if err == nil {
+			t.Errorf("Expected an error replacing line %s with '%s'", n, src)
+		}
+	}
+	err = obj.ReplaceLine("10", "LET a = 3")
+	if err == nil {
+		t.Errorf("Expected an error replacing a line without a line-number")
+	}
+}
+
+// TestAppendStatement tests the APPEND statement.
+func TestAppendStatement(t *testing.T) {
+
+	input := `10 LET a$ = "Steve"
+20 APPEND a$, " "
+30 APPEND a$, "Kemp"
+40 LET b$ = a$
+50 FOR I = 1 TO 3
+60 APPEND c$, STR$ I
+70 NEXT I
+80 APPEND c$, "!"
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running APPEND: %s", err.Error())
+	}
+
+	strs := map[string]string{"a$": "Steve Kemp",
+		"b$": "Steve Kemp",
+		"c$": "123!"}
+	for name, val := range strs {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected '%s', got '%s'", name, val, getString(t, obj, name))
+		}
+	}
+
+	//
+	// Bogus usage.
+	//
+	bogus := []string{`10 APPEND 3, "Steve"`,
+		`10 APPEND a$ "Steve"`,
+		`10 APPEND a$, 3`,
+		`10 LET a = 3 : APPEND a, "Steve"`,
+		`10 APPEND RED, "Steve"`,
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestClear tests the CLEAR statement.
+func TestClear(t *testing.T) {
+
+	input := `10 LET a = 1
+20 APPEND b$, "Steve"
+30 FOR I = 1 TO 3
+40 CLEAR
+50 LET c = (SYS 2) + (SYS 3)
+60 LET d = RED
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running CLEAR: %s", err.Error())
+	}
+
+	for _, name := range []string{"a", "b$", "I"} {
+		if obj.GetVariable(name).Type() != object.ERROR {
+			t.Errorf("Variable %s survived CLEAR", name)
+		}
+	}
+	if getFloat(t, obj, "c") != 0 {
+		t.Errorf("Expected no variables or loops after CLEAR, got %f", getFloat(t, obj, "c"))
+	}
+
+	// Constants survive.
+	if getFloat(t, obj, "d") != 1 {
+		t.Errorf("Constant was lost by CLEAR")
+	}
+
+	//
+	// The size of the string-space may be given, but is ignored.
+	//
+	obj = Compile(`10 LET a = 1
+20 CLEAR 1000 : LET b = 2
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running CLEAR: %s", err.Error())
+	}
+	if obj.GetVariable("a").Type() != object.ERROR {
+		t.Errorf("Variable a survived CLEAR 1000")
+	}
+	if getFloat(t, obj, "b") != 2 {
+		t.Errorf("LET failed after CLEAR 1000")
+	}
+}
+
+// TestClearModifiers tests limiting what CLEAR removes.
+func TestClearModifiers(t *testing.T) {
+
+	input := `10 LET a = 1
+20 GOSUB 100
+30 END
+100 CLEAR VARIABLES
+110 LET b = SYS 1
+120 clear gosub
+130 LET c = SYS 1
+140 CLEAR SCREEN
+150 CLEAR ARRAYS
+160 CLEAR ALL
+`
+	var out ttyBuffer
+	obj := Compile(input)
+	obj.SetOutput(&out)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running CLEAR: %s", err.Error())
+	}
+
+	if out.String() != "\033[2J\033[H\033[2J\033[H" {
+		t.Errorf("The screen wasn't cleared: %q", out.String())
+	}
+
+	obj = Compile(input[:strings.Index(input, "140")])
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running CLEAR: %s", err.Error())
+	}
+	if obj.GetVariable("a").Type() != object.ERROR {
+		t.Errorf("Variable a survived CLEAR VARIABLES")
+	}
+	if getFloat(t, obj, "b") != 1 {
+		t.Errorf("CLEAR VARIABLES removed the GOSUB return")
+	}
+	if getFloat(t, obj, "c") != 0 {
+		t.Errorf("CLEAR GOSUB didn't remove the GOSUB return")
+	}
+
+	obj = Compile(`10 CLEAR STEVE`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error with a bogus modifier")
+	}
+}
+
+// TestLnum tests our LNUM function.
+func TestLnum(t *testing.T) {
+
+	input := `10 LET a = LNUM
+20 GOSUB 100
+30 END
+100 LET b = LNUM()
+110 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running LNUM: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 10 {
+		t.Errorf("LNUM returned the wrong value: %f", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 100 {
+		t.Errorf("LNUM returned the wrong value: %f", getFloat(t, obj, "b"))
+	}
+}
+
+// TestComputedJumps tests GOTO and GOSUB with computed targets.
+func TestComputedJumps(t *testing.T) {
+
+	input := `10 LET x = 2
+20 GOTO x * 100
+30 END
+100 LET a = 1
+110 END
+200 LET a = 2
+210 GOSUB x * 100 + 100
+220 END
+300 LET b = 3
+310 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running computed jumps: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 2 {
+		t.Errorf("GOTO went to the wrong place")
+	}
+	if getFloat(t, obj, "b") != 3 {
+		t.Errorf("GOSUB went to the wrong place")
+	}
+
+	//
+	// Bogus targets.
+	//
+	bogus := []string{`10 GOTO 10 / 3`,
+		`10 GOTO "Steve"`,
+		`10 GOTO 20`,
+		`10 GOSUB 3 / 2`,
+		`10 GOSUB 20`,
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestProgram tests our PROGRAM$ function.
+func TestProgram(t *testing.T) {
+
+	input := `10 REM "Test"
+20 LET a$ = PROGRAM$
+
+30 LET b$ = PROGRAM$(20, 30)
+40 PRINT LEFT$("Steve\n", 2), 3; -4 : LET c = (1 + 2) * 3
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running PROGRAM$: %s", err.Error())
+	}
+
+	a := `10 REM "Test"
+20 LET a$ = PROGRAM$
+30 LET b$ = PROGRAM$(20, 30)
+40 PRINT LEFT$("Steve\n", 2), 3; -4 : LET c = (1 + 2) * 3
+`
+	if getString(t, obj, "a$") != a {
+		t.Errorf("PROGRAM$ returned the wrong value: '%s'", getString(t, obj, "a$"))
+	}
+
+	b := `20 LET a$ = PROGRAM$
+30 LET b$ = PROGRAM$(20, 30)
+`
+	if getString(t, obj, "b$") != b {
+		t.Errorf("PROGRAM$ returned the wrong value: '%s'", getString(t, obj, "b$"))
+	}
+
+	obj = Compile(`10 LET a$ = PROGRAM$(1)`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// TestGetLineSource tests reconstructing the source of a single line.
+func TestGetLineSource(t *testing.T) {
+
+	obj := Compile(`10 REM "Test"
+20 PRINT LEFT$("Steve\n", 2), 3; -4 : LET c = (1 + 2) * 3
+30 END
+`)
+
+	tests := map[string]string{
+		"10": `10 REM "Test"`,
+		"20": `20 PRINT LEFT$("Steve\n", 2), 3; -4 : LET c = (1 + 2) * 3`,
+		"30": `30 END`,
+		"40": ``,
+	}
+	for line, expected := range tests {
+		out := obj.GetLineSource(line)
+		if out != expected {
+			t.Errorf("Line %s: got '%s', expected '%s'", line, out, expected)
+		}
+	}
+}
+
+// TestSharedProgram tests running one program in several interpreters.
+func TestSharedProgram(t *testing.T) {
+
+	prog, err := CompileProgram(`10 LET a = a + LEN "Steve"
+20 LET b = DOUBLE a
+`)
+	if err != nil {
+		t.Errorf("Error compiling program: %s", err.Error())
+	}
+
+	double := func(env Interpreter, args []object.Object) object.Object {
+		return &object.NumberObject{Value: args[0].(*object.NumberObject).Value * 2}
+	}
+
+	one := NewFromProgram(prog)
+	one.SetVariable("a", &object.NumberObject{Value: 1})
+	one.RegisterBuiltin("DOUBLE", 1, double)
+
+	two := NewFromProgram(prog)
+	two.SetVariable("a", &object.NumberObject{Value: 10})
+
+	err = one.Run()
+	if err != nil {
+		t.Errorf("Found error running shared program: %s", err.Error())
+	}
+	if getFloat(t, one, "b") != 12 {
+		t.Errorf("Wrong result: %f", getFloat(t, one, "b"))
+	}
+
+	// The second interpreter doesn't know about DOUBLE, so treats
+	// it as a variable, and its state is independent.
+	err = two.Run()
+	if err == nil {
+		t.Errorf("Expected an error running without DOUBLE")
+	}
+	if getFloat(t, two, "a") != 15 {
+		t.Errorf("Wrong result: %f", getFloat(t, two, "a"))
+	}
+
+	// The shared program was not modified.
+	for _, tok := range prog.tokens {
+		if tok.Literal == "DOUBLE" && tok.Type != token.IDENT {
+			t.Errorf("Shared program was modified by RegisterBuiltin")
+		}
+	}
+
+	_, err = CompileProgram("10 END\n10 END\n")
+	if err == nil {
+		t.Errorf("Expected an error compiling duplicate lines")
+	}
+}
+
+// TestSetInput tests reading INPUT from a custom reader.
+func TestSetInput(t *testing.T) {
+
+	input := `10 INPUT "Name:", N$
+20 INPUT "Age:", A
+30 LET C = GETCH
+`
+	obj := Compile(input)
+	obj.SetInput(strings.NewReader("Steve\n42\nx"))
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running INPUT: %s", err.Error())
+	}
+	if getString(t, obj, "N$") != "Steve" {
+		t.Errorf("Wrong value for N$: %s", getString(t, obj, "N$"))
+	}
+	if getFloat(t, obj, "A") != 42 {
+		t.Errorf("Wrong value for A: %f", getFloat(t, obj, "A"))
+	}
+	if getFloat(t, obj, "C") != 'x' {
+		t.Errorf("Wrong value for C: %f", getFloat(t, obj, "C"))
+	}
+	if out.String() != "Name:Age:" {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+}
+
+// TestInkey tests polling for a key via INKEY$, which returns keys
+// already read into our buffer, and never waits.
+func TestInkey(t *testing.T) {
+
+	input := `10 LET e$ = INKEY$
+20 LET c = GETCH
+30 LET k1$ = INKEY$
+40 LET k2$ = INKEY$
+50 LET k3$ = INKEY$
+`
+	obj := Compile(input)
+	obj.SetInput(strings.NewReader("abc"))
+
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running INKEY$: %s", err.Error())
+	}
+
+	vals := map[string]string{"e$": "", "k1$": "b", "k2$": "c", "k3$": ""}
+	for name, val := range vals {
+		if getString(t, obj, name) != val {
+			t.Errorf("%s: expected '%s', got '%s'", name, val, getString(t, obj, name))
+		}
+	}
+}
+
+// TestInputValidation tests INPUT re-prompting upon bad input.
+func TestInputValidation(t *testing.T) {
+
+	input := `10 INPUT "Number:", N%
+20 INPUT "1-10:", M, 1, 10
+`
+	obj := Compile(input)
+	obj.STDIN = bufio.NewReader(strings.NewReader("abc\n1.5\n3\n11\n0\n7\n"))
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running INPUT: %s", err.Error())
+	}
+	if getFloat(t, obj, "N%") != 3 {
+		t.Errorf("Wrong value for N%%: %f", getFloat(t, obj, "N%"))
+	}
+	if getFloat(t, obj, "M") != 7 {
+		t.Errorf("Wrong value for M: %f", getFloat(t, obj, "M"))
+	}
+
+	expected := "Number:?REDO FROM START\nNumber:?REDO FROM START\nNumber:" +
+		"1-10:?REDO FROM START\n1-10:?REDO FROM START\n1-10:"
+	if out.String() != expected {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+
+	//
+	// Running out of input is an error, rather than a loop.
+	//
+	obj = Compile(`10 INPUT "Number:", N%`)
+	obj.STDIN = bufio.NewReader(strings.NewReader("abc\n"))
+	obj.SetOutput(&out)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error at the end of the input")
+	}
+
+	//
+	// Bogus ranges.
+	//
+	bogus := []string{`10 INPUT "Name:", A$, 1, 10`,
+		`10 INPUT "Number:", A, "one", 10`,
+		`10 INPUT "Number:", A, 1`,
+		`10 INPUT "Number:", A, 1, "ten"`,
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		obj.STDIN = bufio.NewReader(strings.NewReader("3\n"))
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestProfile tests our execution-profiling.
+func TestProfile(t *testing.T) {
+
+	input := `10 PROFILECLEAR
+20 FOR I = 1 TO 3
+30 GOSUB 100
+40 NEXT I
+50 LET a$ = PROFILE
+60 END
+100 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running PROFILE: %s", err.Error())
+	}
+
+	expected := "20:1\n30:3\n40:3\n50:1\n100:3\n"
+	if getString(t, obj, "a$") != expected {
+		t.Errorf("PROFILE returned the wrong value: '%s'", getString(t, obj, "a$"))
+	}
+
+	if obj.LineProfile()["60"] != 1 {
+		t.Errorf("LineProfile returned the wrong value")
+	}
+	obj.ResetProfile()
+	if len(obj.LineProfile()) != 0 {
+		t.Errorf("ResetProfile didn't reset")
+	}
+}
+
+// TestStrErr tests our STRERR$ function.
+func TestStrErr(t *testing.T) {
+
+	obj := Compile(`10 LET a$ = STRERR$ 2`)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running STRERR$: %s", err.Error())
+	}
+	if getString(t, obj, "a$") != syscall.ENOENT.Error() {
+		t.Errorf("STRERR$ returned the wrong value: %s", getString(t, obj, "a$"))
+	}
+
+	obj = Compile(`10 LET a$ = STRERR$ -1`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// ttyBuffer is a buffer which claims to be a terminal.
+type ttyBuffer struct {
+	bytes.Buffer
+}
+
+// IsTTY claims that we're a terminal.
+func (t *ttyBuffer) IsTTY() bool {
+	return true
+}
+
+// TestTextAttributes tests our ANSI text-attributes.
+func TestTextAttributes(t *testing.T) {
+
+	input := `10 PRINT BOLD$; "Warning"; RESET$
+20 PRINT UNDERLINE$; ITALIC$; DIM$; BLINK$; REVERSE$
+`
+	obj := Compile(input)
+	var tty ttyBuffer
+	obj.SetOutput(&tty)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running text-attributes: %s", err.Error())
+	}
+	expected := "\033[1mWarning\033[0m\n\033[4m\033[3m\033[2m\033[5m\033[7m\n"
+	if tty.String() != expected {
+		t.Errorf("Unexpected output: %q", tty.String())
+	}
+
+	//
+	// If we're not writing to a terminal then we get nothing.
+	//
+	obj = Compile(input)
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running text-attributes: %s", err.Error())
+	}
+	if out.String() != "Warning\n\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+// TestStackFrames tests inspecting the GOSUB stack.
+func TestStackFrames(t *testing.T) {
+
+	input := `10 LET a = STACKDEPTH
+20 GOSUB 100
+30 END
+100 GOSUB 200
+110 RETURN
+200 LET b = STACKDEPTH()
+210 LET c$ = STACKFRAME$(1)
+220 LET d$ = STACKFRAME$ 2
+230 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running STACKFRAME$: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "a") != 0 {
+		t.Errorf("Wrong stack depth: %f", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 2 {
+		t.Errorf("Wrong stack depth: %f", getFloat(t, obj, "b"))
+	}
+	if getString(t, obj, "c$") != "100" {
+		t.Errorf("Wrong stack frame: %s", getString(t, obj, "c$"))
+	}
+	if getString(t, obj, "d$") != "20" {
+		t.Errorf("Wrong stack frame: %s", getString(t, obj, "d$"))
+	}
+
+	obj = Compile(`10 LET a$ = STACKFRAME$ 1`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("We expected to find an error, but didn't")
+	}
+}
+
+// fakeGraphics records the drawing-commands it receives.
+type fakeGraphics struct {
+	commands []string
+}
+
+func (f *fakeGraphics) Plot(x int, y int, colour int) {
+	f.commands = append(f.commands, fmt.Sprintf("PLOT %d,%d,%d", x, y, colour))
+}
+
+func (f *fakeGraphics) Line(x1 int, y1 int, x2 int, y2 int, colour int) {
+	f.commands = append(f.commands, fmt.Sprintf("LINE %d,%d,%d,%d,%d", x1, y1, x2, y2, colour))
+}
+
+func (f *fakeGraphics) Print(txt string) {
+	f.commands = append(f.commands, fmt.Sprintf("PRINT %q", txt))
+}
+
+// TestGraphics tests switching between text and graphics modes.
+func TestGraphics(t *testing.T) {
+
+	input := `10 PRINT "Text"
+20 GRAPHICS
+30 PLOT 1, 2, RED
+40 LINE 1, 2, 3, 4, BLUE
+50 PRINT "Graphics"
+60 TEXT
+70 PRINT "Text"
+`
+	obj := Compile(input)
+	var out bytes.Buffer
+	obj.SetOutput(&out)
+	var gfx fakeGraphics
+	obj.SetGraphicsMode(&gfx)
+
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running graphics: %s", err.Error())
+	}
+
+	if out.String() != "Text\nText\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+	expected := []string{"PLOT 1,2,1",
+		"LINE 1,2,3,4,4",
+		`PRINT "Graphics"`,
+		`PRINT "\n"`}
+	if strings.Join(gfx.commands, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected drawing-commands: %v", gfx.commands)
+	}
+
+	//
+	// Bogus usage.
+	//
+	bogus := []string{"10 GRAPHICS",
+		"10 PLOT 1, 2, 3",
+		"10 LINE 1, 2, 3, 4, 5",
+	}
+	for _, prg := range bogus {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+
+	obj = Compile(`10 GRAPHICS : PLOT 1, 2, "red"`)
+	obj.SetGraphicsMode(&gfx)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error plotting with a bogus colour")
+	}
+}
+
+// TestRuntimeErrorLines tests errors report the line they occurred upon.
+func TestRuntimeErrorLines(t *testing.T) {
+
+	tests := []struct {
+		Input string
+		Line  string
+	}{
+		{Input: `10 IF 1 = 1 THEN LET a = "Steve" + 1
+20 END`, Line: "10"},
+		{Input: `10 IF 1 = 2 THEN END ELSE LET a = "Steve" + 1
+20 END`, Line: "10"},
+		{Input: `10 FOR I = 1 TO 2 : LET a = I * I
+20 NEXT I : LET b = I / "Steve"
+`, Line: "20"},
+		{Input: `10 FOR I = 1 TO 3 : LET a = 4 / (2 - I)
+20 NEXT I
+`, Line: "10"},
+		{Input: `10 GOSUB 100
+20 END
+100 LET a = "Steve" * 3
+`, Line: "100"},
+	}
+
+	for _, test := range tests {
+
+		obj := Compile(test.Input)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", test.Input)
+			continue
+		}
+
+		rerr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Errorf("Expected a RuntimeError, got %T", err)
+			continue
+		}
+		if rerr.Line != test.Line {
+			t.Errorf("Error '%s' reported upon line %s, expected %s", err.Error(), rerr.Line, test.Line)
+		}
+	}
+}
+
+// TestThenLineNumber tests `IF .. THEN 100` is treated as a GOTO.
+func TestThenLineNumber(t *testing.T) {
+
+	input := `10 LET a = 6
+20 IF a > 5 THEN 100
+30 LET b = 1
+40 END
+100 LET b = 2
+110 IF a < 5 THEN 200
+120 LET c = 3
+130 END
+200 LET c = 4
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running IF: %s", err.Error())
+	}
+	if getFloat(t, obj, "b") != 2 {
+		t.Errorf("THEN 100 didn't jump")
+	}
+	if getFloat(t, obj, "c") != 3 {
+		t.Errorf("THEN 200 jumped, but shouldn't have")
+	}
+
+	obj = Compile(`10 IF 1 = 1 THEN 100`)
+	err = obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error jumping to a missing line")
+	}
+}
+
+// TestElseLineNumber tests `IF .. THEN 100 ELSE 200` takes the right branch.
+func TestElseLineNumber(t *testing.T) {
+
+	for _, test := range []struct {
+		A      float64
+		Result float64
+	}{
+		{A: 6, Result: 100},
+		{A: 4, Result: 200},
+	} {
+		input := fmt.Sprintf(`10 LET a = %v
+20 IF a > 5 THEN 100 ELSE 200
+30 LET b = 30
+40 END
+100 LET b = 100
+110 END
+200 LET b = 200
+210 END
+`, test.A)
+		obj := Compile(input)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running IF: %s", err.Error())
+		}
+		if getFloat(t, obj, "b") != test.Result {
+			t.Errorf("IF with a = %v reached line %v, expected %v", test.A, getFloat(t, obj, "b"), test.Result)
+		}
+	}
+
+	obj := Compile(`10 IF 1 = 2 THEN 100 ELSE 300`)
+	err := obj.Run()
+	if err == nil {
+		t.Errorf("Expected an error jumping to a missing line")
+	}
+}
+
+// TestElseGoto tests `ELSE GOTO` runs the first statement of its target.
+func TestElseGoto(t *testing.T) {
+
+	input := `10 IF 1 = 2 THEN GOTO 100 ELSE GOTO 200
+20 END
+100 LET b = 100
+110 END
+200 LET b = 200 : LET c = 1
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running ELSE GOTO: %s", err.Error())
+	}
+	if getFloat(t, obj, "b") != 200 {
+		t.Errorf("ELSE GOTO reached the wrong line: %v", getFloat(t, obj, "b"))
+	}
+	if getFloat(t, obj, "c") != 1 {
+		t.Errorf("ELSE GOTO didn't continue after the first statement")
+	}
+}
+
+// TestFunctionList tests we can enumerate the registered builtins.
+func TestFunctionList(t *testing.T) {
+
+	obj := Compile(`10 PRINT "OK"`)
+	obj.RegisterBuiltin("ZZZ", 3, nil)
+
+	names := obj.FunctionList()
+	if len(names) == 0 {
+		t.Fatalf("No builtins were listed")
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Errorf("Builtins are not sorted: %s > %s", names[i-1], names[i])
+		}
+	}
+
+	found := map[string]bool{}
+	for _, name := range names {
+		found[name] = true
+	}
+	for _, name := range []string{"LEN", "LEFT$", "PROGRAM$", "ZZZ"} {
+		if !found[name] {
+			t.Errorf("Builtin %s wasn't listed", name)
+		}
+	}
+
+	tests := []struct {
+		Name  string
+		Arity int
+		Found bool
+	}{
+		{Name: "LEN", Arity: 1, Found: true},
+		{Name: "LEFT$", Arity: 2, Found: true},
+		{Name: "PROGRAM$", Arity: -1, Found: true},
+		{Name: "ZZZ", Arity: 3, Found: true},
+		{Name: "STEVE", Arity: 0, Found: false},
+	}
+	for _, test := range tests {
+		n, ok := obj.FunctionArity(test.Name)
+		if n != test.Arity || ok != test.Found {
+			t.Errorf("FunctionArity(%s) gave %d,%v expected %d,%v", test.Name, n, ok, test.Arity, test.Found)
+		}
+	}
+}
+
+// TestLineZero tests that line zero may be the target of a jump.
+func TestLineZero(t *testing.T) {
+
+	input := `0 LET a = a + 1
+10 IF a < 3 THEN GOTO 0
+20 IF a < 5 THEN GOSUB 0
+30 IF a < 6 THEN 0
+`
+	obj := Compile(input)
+	obj.SetVariable("a", &object.NumberObject{Value: 0})
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error jumping to line zero: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 6 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+}
+
+// TestVarSaveLoad tests saving and restoring variables.
+func TestVarSaveLoad(t *testing.T) {
+
+	path := t.TempDir() + "/vars.json"
+
+	obj := Compile(fmt.Sprintf(`10 LET a = 3
+20 LET b$ = "Steve"
+30 LET c = 4
+40 VARSAVE "%s"
+`, path))
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running VARSAVE: %s", err.Error())
+	}
+
+	obj = Compile(fmt.Sprintf(`10 LET a = 1
+20 VARLOAD "%s"
+30 LET d = a + LEN b$
+`, path))
+	err = obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running VARLOAD: %s", err.Error())
+	}
+	if getFloat(t, obj, "d") != 8 {
+		t.Errorf("Wrong value for d: %v", getFloat(t, obj, "d"))
+	}
+
+	// c isn't used by the program, so isn't loaded.
+	if obj.GetVariable("c").Type() != object.ERROR {
+		t.Errorf("Unused variable c was loaded")
+	}
+
+	for _, prg := range []string{`10 VARSAVE 3`,
+		`10 VARLOAD 3`,
+		`10 VARLOAD "/this/does/not/exist"`,
+		`10 VARSAVE "/this/does/not/exist"`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestTraceStatements tests tracing may be enabled by a program.
+func TestTraceStatements(t *testing.T) {
+
+	input := `10 LET a = 1
+20 TRACEON
+30 LET b = 2
+40 TRACEOFF
+50 LET c = 3
+`
+	var out bytes.Buffer
+	obj := Compile(input)
+	obj.SetOutput(&out)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running TRACEON: %s", err.Error())
+	}
+
+	if !strings.Contains(out.String(), "RunOnce( Token{Type:LINENO Value:30}") {
+		t.Errorf("Line 30 wasn't traced: %s", out.String())
+	}
+	if strings.Contains(out.String(), "Value:10}") ||
+		strings.Contains(out.String(), "Value:50}") {
+		t.Errorf("Lines were traced outside TRACEON/TRACEOFF: %s", out.String())
+	}
+}
+
+// TestTraceBuiltins tests the tracing of builtins goes to our output.
+func TestTraceBuiltins(t *testing.T) {
+
+	var out bytes.Buffer
+	obj := Compile(`10 LET a = LEN "Steve"`)
+	obj.SetOutput(&out)
+	obj.SetTrace(true)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running trace: %s", err.Error())
+	}
+
+	for _, expected := range []string{"callBultin(LEN)",
+		"Argument 1 -> Object{Type:string, Value:Steve}",
+		"Return value Object{Type:number, Value:5.000000}"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Trace output didn't contain '%s': %s", expected, out.String())
+		}
+	}
+}
+
+// TestNewFromString tests the convenience constructors.
+func TestNewFromString(t *testing.T) {
+
+	obj, err := NewFromString(`10 LET a = 3`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running program: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 3 {
+		t.Errorf("Wrong value for a")
+	}
+
+	for _, src := range []string{"", "\n\n"} {
+		_, err = NewFromString(src)
+		if err == nil {
+			t.Errorf("Expected an error for an empty program")
+		}
+	}
+
+	_, err = NewFromString("10 LET a = 1\n10 LET a = 2\n")
+	if err == nil || err.Error() != "Line 10 is duplicated" {
+		t.Errorf("Expected an error for a duplicated line, got %v", err)
+	}
+
+	path := t.TempDir() + "/test.bas"
+	err = os.WriteFile(path, []byte("10 LET b = 4\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write program: %s", err.Error())
+	}
+	obj, err = NewFromFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running program: %s", err.Error())
+	}
+	if getFloat(t, obj, "b") != 4 {
+		t.Errorf("Wrong value for b")
+	}
+
+	_, err = NewFromFile(path + ".missing")
+	if err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+// TestFlowGraph tests the static control-flow graph of a program.
+func TestFlowGraph(t *testing.T) {
+
+	input := `10 FOR I = 1 TO 3
+20 GOSUB 100
+30 NEXT I
+40 IF a > 3 THEN 60 ELSE 70
+50 GOTO X * 10
+60 GOTO 80
+70 LET a = 1
+80 END
+100 RETURN
+`
+	obj := Compile(input)
+
+	expected := []FlowEdge{
+		{From: "10", To: "20", Kind: "sequential"},
+		{From: "20", To: "100", Kind: "gosub"},
+		{From: "20", To: "30", Kind: "sequential"},
+		{From: "10", To: "30", Kind: "for"},
+		{From: "30", To: "10", Kind: "next"},
+		{From: "30", To: "40", Kind: "sequential"},
+		{From: "40", To: "60", Kind: "if-true"},
+		{From: "40", To: "70", Kind: "if-false"},
+		{From: "40", To: "50", Kind: "sequential"},
+		{From: "60", To: "80", Kind: "goto"},
+		{From: "70", To: "80", Kind: "sequential"},
+		{From: "100", To: "30", Kind: "return"},
+	}
+
+	edges := obj.FlowGraph()
+	if len(edges) != len(expected) {
+		t.Fatalf("Expected %d edges, got %d: %v", len(expected), len(edges), edges)
+	}
+	for i, edge := range edges {
+		if edge != expected[i] {
+			t.Errorf("Edge %d: expected %v, got %v", i, expected[i], edge)
+		}
+	}
+	//
+	// END SELECT doesn't end the program.
+	//
+	obj = Compile(`10 SELECT CASE a : CASE 1
+20 END SELECT
+30 END
+`)
+	edges = obj.FlowGraph()
+	if len(edges) != 2 || edges[1] != (FlowEdge{From: "20", To: "30", Kind: "sequential"}) {
+		t.Errorf("Unexpected edges for END SELECT: %v", edges)
+	}
+}
+
+// TestExec tests running external commands, and the sandbox.
+func TestExec(t *testing.T) {
+
+	obj := Compile(`10 LET a$ = EXEC$("echo Steve")`)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running EXEC$: %s", err.Error())
+	}
+	if getString(t, obj, "a$") != "Steve" {
+		t.Errorf("Wrong output from EXEC$: '%s'", getString(t, obj, "a$"))
+	}
+
+	obj = Compile(`10 LET a$ = EXEC$("echo Kemp >&2 ; exit 3")`)
+	err = obj.Run()
+	if err == nil || !strings.Contains(err.Error(), "Kemp") {
+		t.Errorf("Expected an error including stderr, got %v", err)
+	}
+
+	for _, prg := range []string{`10 LET a$ = EXEC$("echo Steve")`,
+		`10 VARSAVE "vars.json"`,
+		`10 VARLOAD "vars.json"`,
+	} {
+		obj = Compile(prg)
+		obj.SetSandbox(true)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), "sandbox") {
+			t.Errorf("Expected a sandbox error running '%s', got %v", prg, err)
+		}
+	}
+}
+
+// TestFiles tests writing and reading files via OPEN, PRINT# and INPUT#.
+func TestFiles(t *testing.T) {
+
+	path := t.TempDir() + "/data.txt"
+
+	obj := Compile(`10 OPEN "` + path + `" FOR OUTPUT AS #1
+20 PRINT #1, "Steve"
+30 PRINT #1, 3 * 4
+40 CLOSE #1
+50 OPEN "` + path + `" FOR INPUT AS #2
+60 INPUT #2, a$
+70 INPUT #2, b
+80 CLOSE #2
+`)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error using files: %s", err.Error())
+	}
+	if getString(t, obj, "a$") != "Steve" {
+		t.Errorf("Read the wrong string: '%s'", getString(t, obj, "a$"))
+	}
+	if getFloat(t, obj, "b") != 12 {
+		t.Errorf("Read the wrong number: %f", getFloat(t, obj, "b"))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err.Error())
+	}
+	if string(data) != "Steve\n12\n" {
+		t.Errorf("File has the wrong contents: '%s'", string(data))
+	}
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `10 CLOSE #1`, Error: "not open"},
+		{Input: `10 CLOSE 1`, Error: "expected a channel"},
+		{Input: `10 PRINT #10, "x"`, Error: "unknown channel"},
+		{Input: `10 PRINT #3, "x"`, Error: "not open for output"},
+		{Input: `10 INPUT #3, a$`, Error: "not open for input"},
+		{Input: `10 OPEN "` + path + `" FOR INPUT AS #1 : PRINT #1, "x"`, Error: "not open for output"},
+		{Input: `10 OPEN "` + path + `" FOR OUTPUT AS #1 : INPUT #1, a$`, Error: "not open for input"},
+		{Input: `10 OPEN "` + path + `" FOR OUTPUT AS #1 : OPEN "` + path + `" FOR OUTPUT AS #1`, Error: "already open"},
+		{Input: `10 OPEN "` + path + `" FOR INPUT AS #1 : INPUT #1, a$ : INPUT #1, b$`, Error: "end of file"},
+		{Input: `10 OPEN "` + path + `" FOR SPEED AS #1`, Error: "unknown mode"},
+		{Input: `10 OPEN 3 FOR INPUT AS #1`, Error: "must be a string"},
+		{Input: `10 OPEN "/does/not/exist" FOR INPUT AS #1`, Error: "OPEN"},
+	}
+
+	for _, test := range tests {
+		obj = Compile(test.Input)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("Expected error '%s' running '%s', got %v", test.Error, test.Input, err)
+		}
+	}
+
+	// Records may be read and written by number.
+	records := t.TempDir() + "/records.dat"
+	obj = Compile(`10 OPEN "` + records + `" FOR RANDOM AS #3
+20 FIELD #3, 5 AS NAME$, 2 AS AGE$
+30 LET NAME$ = "Steven" : LET AGE$ = "7"
+40 PUT #3, 2
+50 LET NAME$ = "Bob"
+60 PUT #3, 1
+70 GET #3, 2
+80 LET a$ = NAME$ + "|" + AGE$
+90 GET #3, 1
+100 LET b$ = NAME$ + "|" + AGE$
+110 GET #3, 3
+120 LET c$ = NAME$ + "|" + AGE$
+130 CLOSE #3
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Fatalf("Found error using records: %s", err.Error())
+	}
+	for name, val := range map[string]string{"a$": "Steve|7 ", "b$": "Bob  |7 ", "c$": "     |  "} {
+		if getString(t, obj, name) != val {
+			t.Errorf("Wrong value for %s: '%s'", name, getString(t, obj, name))
+		}
+	}
+	data, err = os.ReadFile(records)
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err.Error())
+	}
+	if string(data) != "Bob  7 Steve7 " {
+		t.Errorf("File has the wrong contents: '%s'", string(data))
+	}
+
+	for _, prg := range []string{`10 FIELD #1, 5 AS A$`,
+		`10 GET #1, 1`,
+		`10 OPEN "` + path + `" FOR OUTPUT AS #1 : PUT #1, 1`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : GET #1, 1`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : PRINT #1, "x"`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1, 0 AS A$`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1, 5 AS A`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1, 5 AS A$ : PUT #1, 0`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1, 5 AS A$ : GET #1, 1E20`,
+		`10 OPEN "` + records + `" FOR RANDOM AS #1 : FIELD #1, 5 AS A$ : GET #1`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+
+	// Failures record the operating-system error-code in ERRNO.
+	obj = Compile(`10 ON ERROR GOTO 100
+20 OPEN "/does/not/exist" FOR INPUT AS #1
+30 END
+100 LET a = ERRNO : LET a$ = STRERR$ ERRNO
+110 ON ERROR GOTO 200
+120 OPEN "` + path + `" FOR INPUT AS #1 : INPUT #1, x$ : INPUT #1, x$ : INPUT #1, x$
+130 END
+200 LET b = ERRNO
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Fatalf("Found error testing ERRNO: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != float64(syscall.ENOENT) {
+		t.Errorf("Wrong value for ERRNO: %f", getFloat(t, obj, "a"))
+	}
+	if getString(t, obj, "a$") != syscall.ENOENT.Error() {
+		t.Errorf("Wrong description for ERRNO: '%s'", getString(t, obj, "a$"))
+	}
+	if getFloat(t, obj, "b") != 0 {
+		t.Errorf("Wrong value for ERRNO at the end of a file: %f", getFloat(t, obj, "b"))
+	}
+
+	obj = Compile(`10 OPEN "` + path + `" FOR OUTPUT AS #1`)
+	obj.SetSandbox(true)
+	err = obj.Run()
+	if err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Errorf("Expected a sandbox error, got %v", err)
+	}
+}
+
+// TestOnError tests handling runtime errors via ON ERROR GOTO.
+func TestOnError(t *testing.T) {
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `20 LET a = 1 / 0`, Error: "Division by zero"},
+		{Input: `20 LET a = q + 1`, Error: "doesn't exist"},
+		{Input: `20 GOTO 99`, Error: "Failed to GOTO 99"},
+	}
+
+	for _, test := range tests {
+		obj := Compile(`10 ON ERROR GOTO 900
+` + test.Input + `
+30 END
+900 LET handled = 1
+`)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", test.Input, err.Error())
+			continue
+		}
+		if getFloat(t, obj, "handled") != 1 {
+			t.Errorf("The handler didn't run for '%s'", test.Input)
+		}
+		if !strings.Contains(getString(t, obj, "ERR$"), test.Error) {
+			t.Errorf("ERR$ has the wrong value for '%s': '%s'", test.Input, getString(t, obj, "ERR$"))
+		}
+		if getFloat(t, obj, "ERL") != 20 {
+			t.Errorf("ERL has the wrong value for '%s': %f", test.Input, getFloat(t, obj, "ERL"))
+		}
+	}
+
+	//
+	// Errors are propagated once the handler is removed, from within
+	// the handler, or if the handler line is missing.
+	//
+	for _, prg := range []string{`10 ON ERROR GOTO 900 : ON ERROR GOTO 0
+20 LET a = 1 / 0
+900 END`,
+		`10 ON ERROR GOTO 900
+20 LET a = 1 / 0
+900 LET b = 1 / 0`,
+		`10 ON ERROR GOTO 800`,
+		`10 ON ERROR 800`,
+		`10 ON ERROR SET E GOTO 900
+900 END`,
+		`10 ON ERROR SET GOTO 900
+900 END`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+
+	//
+	// The error-message may be stored in a variable of our choosing.
+	//
+	obj := Compile(`10 LET ERL = 7 : LET SET = 3
+20 ON ERROR SET E$ GOTO 900
+30 LET a = 1 / 0
+40 END
+900 LET handled = SET
+`)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running ON ERROR SET: %s", err.Error())
+	}
+	if getFloat(t, obj, "handled") != 3 {
+		t.Errorf("The handler didn't run for ON ERROR SET")
+	}
+	if !strings.Contains(getString(t, obj, "E$"), "Division by zero") {
+		t.Errorf("E$ has the wrong value: '%s'", getString(t, obj, "E$"))
+	}
+	if getFloat(t, obj, "ERL") != 7 || obj.GetVariable("ERR$").Type() != object.ERROR {
+		t.Errorf("ERR$ and ERL were changed by ON ERROR SET")
+	}
+
+	//
+	// Re-arming the handler allows it to catch further errors.
+	//
+	obj = Compile(`10 ON ERROR GOTO 900
+20 LET a = 1 / 0
+30 LET b = 1 / 0
+40 END
+900 LET count = count + 1
+910 ON ERROR GOTO 900
+920 GOTO ERL + 10
+`)
+	obj.SetVariable("count", &object.NumberObject{Value: 0})
+	err = obj.Run()
+	if err != nil {
+		t.Fatalf("Found error re-arming the handler: %s", err.Error())
+	}
+	if getFloat(t, obj, "count") != 2 {
+		t.Errorf("The handler ran the wrong number of times: %f", getFloat(t, obj, "count"))
+	}
+}
+
+// TestResume tests returning from an error-handler via RESUME.
+func TestResume(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		// Retry the statement, once the divisor has been fixed.
+		{Input: `10 ON ERROR GOTO 900
+20 LET d = 0
+30 PRINT "A" : PRINT 10 / d : PRINT "B"
+40 END
+900 LET d = 2
+910 RESUME
+`, Output: "A\n5\nB\n"},
+		// Skip the statement.
+		{Input: `10 ON ERROR GOTO 900
+20 PRINT "A" : PRINT 10 / 0 : PRINT "B"
+30 PRINT "C"
+40 END
+900 RESUME NEXT
+`, Output: "A\nB\nC\n"},
+		// Continue at a line.
+		{Input: `10 ON ERROR GOTO 900
+20 PRINT "A" : PRINT 10 / 0 : PRINT "B"
+30 PRINT "C"
+40 END
+900 RESUME 30
+`, Output: "A\nC\n"},
+		// The handler may be used repeatedly.
+		{Input: `10 ON ERROR GOTO 900
+20 PRINT 1 / 0
+30 PRINT 2 / 0
+40 END
+900 PRINT ERL; " "; ERR$
+910 RESUME NEXT
+`, Output: "20 Division by zero!\n30 Division by zero!\n"},
+	}
+
+	for _, test := range tests {
+		obj := Compile(test.Input)
+		var out bytes.Buffer
+		obj.SetOutput(&out)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running '%s': %s", test.Input, err.Error())
+			continue
+		}
+		if out.String() != test.Output {
+			t.Errorf("Wrong output running '%s': '%s'", test.Input, out.String())
+		}
+		if obj.GetVariable("ERR$").Type() != object.ERROR {
+			t.Errorf("ERR$ wasn't removed by RESUME")
+		}
+	}
+
+	for _, prg := range []string{`10 RESUME`,
+		`10 ON ERROR GOTO 900
+20 PRINT 1 / 0
+900 RESUME 800`,
+	} {
+		obj := Compile(prg)
+		err := obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestMetadata tests reading details from REM comments.
+func TestMetadata(t *testing.T) {
+
+	input := `10 REM @author Alice Smith
+20 REM @version 1.0
+30 REM @description My "first" program, v2
+40 REM An ordinary comment
+50 REM @
+60 REM @date 2024-01-02
+70 REM @url   http://example.com/x_y?a=1&b=2
+80 REM @title Hello:World  
+90 PRINT "Hello"
+`
+	obj := Compile(input)
+	meta := obj.Metadata()
+
+	expected := map[string]string{
+		"author":      "Alice Smith",
+		"version":     "1.0",
+		"description": `My "first" program, v2`,
+		"date":        "2024-01-02",
+		"url":         "http://example.com/x_y?a=1&b=2",
+		"title":       "Hello:World",
+	}
+	if len(meta) != len(expected) {
+		t.Errorf("Wrong metadata: %v", meta)
+	}
+	for key, val := range expected {
+		if meta[key] != val {
+			t.Errorf("Metadata %s was '%s', expected '%s'", key, meta[key], val)
+		}
+	}
+}
+
+// TestLabels tests GOTO and GOSUB may use labels.
+func TestLabels(t *testing.T) {
+
+	input := `10 LET a = 0
+20 LABEL "start" : LET z = 1
+30 LET a = a + 1
+40 IF a < 3 THEN GOTO "start"
+50 GOSUB "double"
+60 GOSUB 100
+70 END
+80 LABEL "double"
+90 LET a = a * 2 : RETURN
+100 LET b = LNUM
+110 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running labels: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 6 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 100 {
+		t.Errorf("Wrong value for b: %v", getFloat(t, obj, "b"))
+	}
+
+	// Labels within comments aren't recorded.
+	obj = Compile(`10 REM see LABEL "x" below
+20 GOTO "x"
+`)
+	if _, ok := obj.lines["x"]; ok {
+		t.Errorf("A label within a comment was recorded")
+	}
+
+	// Labels which are numbers don't hide line-numbers.
+	obj = Compile(`10 GOTO 30
+20 LABEL "30"
+30 LET a = 1
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running labels: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 1 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+
+	for _, prg := range []string{`10 GOTO "missing"`,
+		`10 GOSUB "missing"`,
+		`10 LABEL 3`,
+		`10 LABEL "10"`,
+		`10 REM see LABEL "x" below
+20 GOTO "x"`,
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestData tests DATA, READ, and RESTORE.
+func TestData(t *testing.T) {
+
+	input := `10 DATA 1, 2.5, "Steve", Kemp
+20 READ a, b, c$ : READ d$
+30 RESTORE
+40 READ e
+50 RESTORE 90
+60 READ f, g$
+70 GOTO 100
+80 DATA -3
+90 DATA 4 : DATA "Last"
+100 LET h = a + b + e + f
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running DATA: %s", err.Error())
+	}
+
+	if getFloat(t, obj, "h") != 8.5 {
+		t.Errorf("Wrong value for h: %v", getFloat(t, obj, "h"))
+	}
+	strs := map[string]string{"c$": "Steve", "d$": "Kemp", "g$": "Last"}
+	for name, val := range strs {
+		if getString(t, obj, name) != val {
+			t.Errorf("Wrong value for %s: %s", name, getString(t, obj, name))
+		}
+	}
+
+	// DATA within a comment is ignored.
+	obj = Compile(`10 REM the DATA table : DATA "x"
+20 DATA 5
+30 READ a
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running DATA after REM: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 5 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+
+	// Named tables may be restored by name.
+	obj = Compile(`10 DATA.TABLE1 1, 2
+20 data.Table2 30, 40
+30 RESTORE Table2
+40 READ a
+50 RESTORE TABLE1
+60 READ b, c, d
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running named DATA: %s", err.Error())
+	}
+	for name, val := range map[string]float64{"a": 30, "b": 1, "c": 2, "d": 30} {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("Wrong value for %s: %v", name, getFloat(t, obj, name))
+		}
+	}
+
+	for _, prg := range []string{"10 DATA 1\n20 READ a, b\n",
+		"10 DATA 1\n20 READ a$\n",
+		"10 DATA \"x\"\n20 READ a\n",
+		"10 DATA 1\n20 RESTORE 30\n",
+		"10 DATA.T 1\n20 RESTORE U\n",
+		"10 DATA >\n20 READ a\n",
+		"10 DATA 1\n20 READ 3\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestDim tests arrays.
+func TestDim(t *testing.T) {
+
+	input := `10 DIM A(10), B$(2)
+20 FOR I = 0 TO 10
+30 LET A(I) = I * I
+40 NEXT I
+50 LET B$(2) = "Steve"
+60 LET c = A(3) + A(A(2))
+70 LET d$ = B$(0) + B$(1 + 1)
+80 IF A(10) = 100 THEN LET e = 1
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running DIM: %s", err.Error())
+	}
+	if getFloat(t, obj, "c") != 25 {
+		t.Errorf("Wrong value for c: %v", getFloat(t, obj, "c"))
+	}
+	if getString(t, obj, "d$") != "Steve" {
+		t.Errorf("Wrong value for d$: %s", getString(t, obj, "d$"))
+	}
+	if getFloat(t, obj, "e") != 1 {
+		t.Errorf("Array element wasn't compared")
+	}
+
+	for _, prg := range []string{"10 LET a = A(1)\n",
+		"10 LET A(1) = 3\n",
+		"10 DIM A(3)\n20 LET a = A(4)\n",
+		"10 DIM A(3)\n20 LET a = A(-1)\n",
+		"10 DIM A(3)\n20 LET a = A(1.5)\n",
+		"10 DIM A(3)\n20 LET A(1) = \"Steve\"\n",
+		"10 DIM A$(3)\n20 LET A$(1) = 3\n",
+		"10 DIM A(3)\n20 DIM A(4)\n",
+		"10 DIM A(-1)\n",
+		"10 DIM A(1E18)\n",
+		"10 DIM A(1E9)\n",
+		"10 DIM A(3)\n20 LET a = A(1E20)\n",
+		"10 DIM A(3)\n20 LET A(-1) = 5\n",
+		"10 DIM A(3)\n20 LET A(1E20) = 7\n",
+		"10 DIM A\n",
+		"10 DIM A(3\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestArraySlice tests taking slices of arrays with LET.
+func TestArraySlice(t *testing.T) {
+
+	input := `10 DIM A(10), A$(3)
+20 FOR I = 0 TO 10 : LET A(I) = I * I : NEXT I
+30 LET A$(2) = "Steve"
+40 LET B = A(2 TO 5)
+50 LET c = B(0) + B(3)
+60 LET B$ = A$(1 TO 3)
+70 LET d$ = B$(1)
+80 LET E = A(5 TO 2)
+90 LET B(1) = 0
+100 LET f = A(3)
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running slice: %s", err.Error())
+	}
+	if getFloat(t, obj, "c") != 29 {
+		t.Errorf("Wrong value for c: %v", getFloat(t, obj, "c"))
+	}
+	if getString(t, obj, "d$") != "Steve" {
+		t.Errorf("Wrong value for d$: %s", getString(t, obj, "d$"))
+	}
+	if getFloat(t, obj, "f") != 9 {
+		t.Errorf("Slice wasn't copied: %v", getFloat(t, obj, "f"))
+	}
+	if obj.vars.GetIndex("E", 0).Type() != object.ERROR {
+		t.Errorf("Expected an empty slice")
+	}
+
+	for _, prg := range []string{"10 LET B = A(1 TO 2)\n",
+		"10 DIM A(3)\n20 LET B = A(2 TO 4)\n",
+		"10 DIM A(3)\n20 LET B = A(-1 TO 2)\n",
+		"10 DIM A(3)\n20 LET B$ = A(1 TO 2)\n",
+		"10 DIM A(3)\n20 LET B = A(1 TO 2) + 1\n",
+		"10 DIM A(3)\n20 LET B = A(1 TO 2) + A(1 TO 2)\n",
+		"10 DIM A(3)\n20 LET B = (A(1 TO 2))\n",
+		"10 DIM A(3)\n20 LET A(1) = A(1 TO 2)\n",
+		"10 DIM A(3)\n20 PRINT A(1 TO 2)\n",
+		"10 DIM A(3)\n20 LET B = A(1 TO 2\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestDimMatrix tests arrays with two dimensions.
+func TestDimMatrix(t *testing.T) {
+
+	input := `10 DIM A(2, 3), B$(1, 1)
+20 FOR R = 0 TO 2 : FOR C = 0 TO 3 : LET A(R, C) = R * 10 + C : NEXT C : NEXT R
+30 LET B$(1, 0) = "Steve"
+40 LET c = A(2, 3) + A(1, 0)
+50 LET d$ = B$(1, 0)
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running DIM: %s", err.Error())
+	}
+	if getFloat(t, obj, "c") != 33 {
+		t.Errorf("Wrong value for c: %v", getFloat(t, obj, "c"))
+	}
+	if getString(t, obj, "d$") != "Steve" {
+		t.Errorf("Wrong value for d$: %s", getString(t, obj, "d$"))
+	}
+
+	for _, prg := range []string{"10 DIM A(2, 3)\n20 LET a = A(3, 0)\n",
+		"10 DIM A(2, 3)\n20 LET a = A(0, 4)\n",
+		"10 DIM A(2, 3)\n20 LET a = A(1)\n",
+		"10 DIM A(2)\n20 LET a = A(1, 1)\n",
+		"10 DIM A(2, 3)\n20 LET A(1) = 4\n",
+		"10 DIM A(2, 3)\n20 LET A(0, -1) = 4\n",
+		"10 DIM A(2, 3)\n20 LET B = A(1 TO 2)\n",
+		"10 DIM A(2, 3)\n20 LET a = BSEARCH(A, 1)\n",
+		"10 DIM A(1, -1)\n",
+		"10 DIM A(1E5, 1E5)\n",
+		"10 DIM A(1, 2, 3)\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestMat tests the MAT statement.
+func TestMat(t *testing.T) {
+
+	input := `10 DIM A(1, 2), B(2, 1), S$(0, 1)
+20 MAT READ A, B, S$
+30 MAT C = A * B
+40 MAT T = TRN(A)
+50 MAT I = INV(C)
+60 MAT U = C * I
+70 MAT PRINT A, S$
+80 DATA 1, 2, 3, 4, 5, 6
+90 DATA 7, 8, 9, 10, 11, 12
+100 DATA "a", "b"
+`
+	var out bytes.Buffer
+	obj := Compile(input)
+	obj.SetOutput(&out)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running MAT: %s", err.Error())
+	}
+
+	// [1 2 3; 4 5 6] * [7 8; 9 10; 11 12] = [58 64; 139 154]
+	for i, v := range []float64{58, 64, 139, 154} {
+		if n := obj.vars.GetIndex("C", i).(*object.NumberObject).Value; n != v {
+			t.Errorf("Wrong value for element %d of C: %v", i, n)
+		}
+	}
+	if obj.vars.Columns("C") != 2 {
+		t.Errorf("Wrong number of columns for C: %d", obj.vars.Columns("C"))
+	}
+	for i, v := range []float64{1, 4, 2, 5, 3, 6} {
+		if n := obj.vars.GetIndex("T", i).(*object.NumberObject).Value; n != v {
+			t.Errorf("Wrong value for element %d of T: %v", i, n)
+		}
+	}
+	for i, v := range []float64{1, 0, 0, 1} {
+		if n := obj.vars.GetIndex("U", i).(*object.NumberObject).Value; math.Abs(n-v) > 1e-9 {
+			t.Errorf("Wrong value for element %d of U: %v", i, n)
+		}
+	}
+
+	expected := "1             2             3\n4             5             6\n\na             b\n"
+	if out.String() != expected {
+		t.Errorf("Wrong output for MAT PRINT: %q", out.String())
+	}
+
+	for _, prg := range []string{"10 MAT READ A\n",
+		"10 DIM A(1, 1)\n20 MAT READ A\n30 DATA 1, 2, 3\n",
+		"10 DIM A$(1, 1)\n20 MAT READ A$\n30 DATA 1, 2, 3, 4\n",
+		"10 MAT PRINT A\n",
+		"10 DIM A(1, 2)\n20 MAT C = A * A\n",
+		"10 DIM A(1, 2)\n20 MAT C = INV(A)\n",
+		"10 DIM A(1, 1)\n20 MAT C = INV(A)\n",
+		"10 DIM A(3)\n20 MAT C = TRN(A)\n",
+		"10 DIM A$(1, 1)\n20 MAT C = TRN(A$)\n",
+		"10 DIM A(1, 1)\n20 MAT C$ = A\n",
+		"10 DIM A(1, 1)\n20 MAT C = TRN(A\n",
+		"10 DIM A(1, 1)\n20 MAT C A\n",
+		"10 MAT 3\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestBSearch tests searching sorted arrays.
+func TestBSearch(t *testing.T) {
+
+	input := `10 DIM A(4), A$(2)
+20 FOR I = 0 TO 4 : LET A(I) = I * 2 : NEXT I
+30 LET A$(0) = "apple" : LET A$(1) = "banana" : LET A$(2) = "cherry"
+40 LET a = BSEARCH(A, 0)
+50 LET b = BSEARCH(A, 6)
+60 LET c = BSEARCH A, 5
+70 LET d = BSEARCH(A, 9)
+80 LET e = BSEARCHSTR$(A$, "cherry")
+90 LET f = BSEARCHSTR$(A$, "date")
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running BSEARCH: %s", err.Error())
+	}
+	for name, val := range map[string]float64{"a": 1, "b": 4, "c": 0, "d": 0, "e": 3, "f": 0} {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("Wrong value for %s: %v", name, getFloat(t, obj, name))
+		}
+	}
+
+	for _, prg := range []string{"10 LET a = BSEARCH(A, 1)\n",
+		"10 LET A = 3\n20 LET a = BSEARCH(A, 1)\n",
+		"10 DIM A(3)\n20 LET a = BSEARCH(A, \"x\")\n",
+		"10 DIM A$(3)\n20 LET a = BSEARCH(A$, 1)\n",
+		"10 DIM A(3)\n20 LET a = BSEARCHSTR$(A, \"x\")\n",
+		"10 DIM A(3)\n20 LET a = BSEARCH(3, 1)\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestSelect tests SELECT CASE.
+func TestSelect(t *testing.T) {
+
+	input := `10 FOR X = 0 TO 12
+20 SELECT CASE X
+30 CASE 1
+40   PRINT "One"
+50 CASE 2, 3 : PRINT "Two or three"
+60 CASE IS > 10, -1
+70   PRINT "Big"
+80 CASE 4 TO 6
+90   SELECT CASE X : CASE 5 : PRINT "Five" : CASE ELSE : PRINT "Four or six" : END SELECT
+100 CASE ELSE
+110   PRINT "Other "; X
+120 END SELECT
+130 NEXT X
+140 SELECT CASE "b" : CASE "a" : PRINT "A" : END SELECT
+150 SELECT CASE "b" : CASE IS < "c" : PRINT "B" : END SELECT
+`
+	expected := `Other 0
+One
+Two or three
+Two or three
+Four or six
+Five
+Four or six
+Other 7
+Other 8
+Other 9
+Other 10
+Big
+Big
+B
+`
+	var out bytes.Buffer
+	obj := Compile(input)
+	obj.SetOutput(&out)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running SELECT: %s", err.Error())
+	}
+	if out.String() != expected {
+		t.Errorf("Unexpected output: '%s'", out.String())
+	}
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `10 SELECT X`, Error: "SELECT should be"},
+		{Input: `10 SELECT CASE 1 : CASE 1 : PRINT "A"`, Error: "without END SELECT"},
+		{Input: `10 SELECT CASE 1 : CASE "a" : END SELECT`, Error: "type mismatch"},
+		{Input: `10 SELECT CASE 1 : CASE IS 3 : END SELECT`, Error: "expected a comparison"},
+		{Input: `10 SELECT CASE 1 : CASE 1 2 : END SELECT`, Error: "unexpected token"},
+		{Input: `10 SELECT CASE 1 : CASE 2 : CASE 3 : END SELECT
+20 CASE 4`, Error: "without END SELECT"},
+	}
+
+	for _, test := range tests {
+		obj = Compile(test.Input)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("Expected error '%s' running '%s', got %v", test.Error, test.Input, err)
+		}
+	}
+}
+
+// TestRepeat tests REPEAT/UNTIL loops.
+func TestRepeat(t *testing.T) {
+
+	input := `10 LET a = 0 : LET n = 0
+20 REPEAT
+30   LET a = a + 1
+40   LET b = 0
+50   REPEAT : LET b = b + 1 : LET n = n + 1 : UNTIL b = 3
+60 UNTIL a >= 4
+70 REPEAT : LET c = 1 : UNTIL 1 = 1
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running REPEAT: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 4, "b": 3, "n": 12, "c": 1}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `10 UNTIL 1 = 1`, Error: "UNTIL without REPEAT"},
+		{Input: `10 REPEAT
+20 LET a = 1`, Error: "Unclosed REPEAT loop"},
+		{Input: `10 REPEAT : UNTIL "Steve"`, Error: "UNTIL"},
+	}
+
+	for _, test := range tests {
+		obj = Compile(test.Input)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("Expected error '%s' running '%s', got %v", test.Error, test.Input, err)
+		}
+	}
+}
+
+// TestDo tests DO loops.
+func TestDo(t *testing.T) {
+
+	input := `10 LET a = 0 : LET n = 0
+20 DO WHILE a < 3
+30   LET a = a + 1
+40   LET b = 0
+50   DO : LET b = b + 1 : LET n = n + 1 : LOOP UNTIL b = 2
+60 LOOP
+70 DO UNTIL a > 0 : LET skipped = 1 : LOOP
+80 LET c = 0
+90 DO
+100  LET c = c + 1
+110  IF c = 5 THEN EXIT DO
+120 LOOP WHILE c < 10
+130 DO : LET d = 1 : LOOP WHILE 1 = 2
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Fatalf("Found error running DO: %s", err.Error())
+	}
+
+	vals := map[string]float64{"a": 3, "b": 2, "n": 6, "c": 5, "d": 1}
+	for name, val := range vals {
+		if getFloat(t, obj, name) != val {
+			t.Errorf("%s: expected %f, got %f", name, val, getFloat(t, obj, name))
+		}
+	}
+	if obj.GetVariable("skipped").Type() != object.ERROR {
+		t.Errorf("The body of a failed DO UNTIL was executed")
+	}
+
+	tests := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `10 LOOP`, Error: "LOOP without DO"},
+		{Input: `10 DO WHILE 1 = 2`, Error: "DO without LOOP"},
+		{Input: `10 EXIT DO`, Error: "EXIT DO outside"},
+		{Input: `10 DO : EXIT : LOOP`, Error: "EXIT DO"},
+		{Input: `10 DO
+20 LET a = 1`, Error: "Unclosed DO loop"},
+		{Input: `10 DO WHILE "Steve" : LOOP`, Error: "DO WHILE"},
+	}
+
+	for _, test := range tests {
+		obj = Compile(test.Input)
+		err = obj.Run()
+		if err == nil || !strings.Contains(err.Error(), test.Error) {
+			t.Errorf("Expected error '%s' running '%s', got %v", test.Error, test.Input, err)
+		}
+	}
+}
+
+// TestWhile tests WHILE loops.
+func TestWhile(t *testing.T) {
+
+	input := `10 LET a = 0
+20 LET count = 0
+30 WHILE a < 3
+40   LET b = 0
+50   WHILE b < 2 AND a < 5
+60     LET b = b + 1
+70     LET count = count + 1
+80   WEND
+90   LET a = a + 1
+100 WEND
+110 WHILE a > 10 : LET count = 100 : WEND
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running WHILE: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 3 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "count") != 6 {
+		t.Errorf("Wrong value for count: %v", getFloat(t, obj, "count"))
+	}
+
+	// END WHILE is a synonym for WEND.
+	obj = Compile(`10 LET a = 0
+20 WHILE a < 3
+30   WHILE a > 10 : LET a = 100 : END WHILE
+40   LET a = a + 1
+50 END WHILE
+`)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error running END WHILE: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 3 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+
+	for _, prg := range []string{"10 WHILE 1 = 2\n",
+		"10 WEND\n",
+		"10 END WHILE\n",
+		"10 WHILE 1 = 2\n20 END\n",
+		"10 WHILE 1 = 1\n20 END\n30 WEND\n",
+		"10 WHILE \"a\" < 3\n20 WEND\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestOnGoto tests ON X GOTO and ON X GOSUB.
+func TestOnGoto(t *testing.T) {
+
+	for _, test := range []struct {
+		X      float64
+		Result string
+	}{
+		{X: 0, Result: "none"},
+		{X: 1, Result: "one"},
+		{X: 2, Result: "two"},
+		{X: 3, Result: "none"},
+		{X: 1e20, Result: "none"},
+	} {
+		input := fmt.Sprintf(`10 LET x = %v
+20 LET r$ = "none"
+30 ON x GOTO 100, 200
+40 END
+100 LET r$ = "one"
+110 END
+200 LET r$ = "two"
+`, test.X)
+		obj := Compile(input)
+		err := obj.Run()
+		if err != nil {
+			t.Errorf("Found error running ON GOTO: %s", err.Error())
+		}
+		if getString(t, obj, "r$") != test.Result {
+			t.Errorf("ON %v GOTO reached '%s', expected '%s'", test.X, getString(t, obj, "r$"), test.Result)
+		}
+	}
+
+	input := `10 LET a = 0
+20 ON 1 + 1 GOSUB 100, 200 : LET a = a * 10
+30 END
+100 LET a = 1
+110 RETURN
+200 LET a = 2
+210 RETURN
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running ON GOSUB: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 20 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+
+	for _, prg := range []string{"10 ON -1 GOTO 10\n",
+		"10 ON 1.5 GOTO 10\n",
+		"10 ON \"a\" GOTO 10\n",
+		"10 ON 1 PRINT 10\n",
+		"10 ON 1 GOTO\n",
+		"10 ON 1 GOTO 10,\n",
+		"10 ON 1 GOTO 30\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
+
+// TestDefFn tests user-defined functions.
+func TestDefFn(t *testing.T) {
+
+	input := `10 DEF FN AREA(W) = W * W
+20 DEF FN HALF(W) = FN AREA(W) / 2
+30 DEF FN GREET$(N$) = "Hello " + N$
+40 LET W = 7
+50 LET a = FN AREA(3) + 1
+60 LET b = FN HALF(W + 1)
+70 LET c$ = FN GREET$("Steve")
+`
+	obj := Compile(input)
+	err := obj.Run()
+	if err != nil {
+		t.Errorf("Found error running DEF FN: %s", err.Error())
+	}
+	if getFloat(t, obj, "a") != 10 {
+		t.Errorf("Wrong value for a: %v", getFloat(t, obj, "a"))
+	}
+	if getFloat(t, obj, "b") != 32 {
+		t.Errorf("Wrong value for b: %v", getFloat(t, obj, "b"))
+	}
+	if getString(t, obj, "c$") != "Hello Steve" {
+		t.Errorf("Wrong value for c$: %s", getString(t, obj, "c$"))
+	}
+
+	// The parameter is restored after the call.
+	if getFloat(t, obj, "W") != 7 {
+		t.Errorf("The parameter W wasn't restored: %v", getFloat(t, obj, "W"))
+	}
+	if obj.GetVariable("N$").Type() != object.ERROR {
+		t.Errorf("The parameter N$ wasn't removed")
+	}
+
+	// Functions may be called by PRINT.
+	var out bytes.Buffer
+	obj = Compile(`10 DEF FN A(X) = X * 2
+20 PRINT FN A(3); " "; FN A(4) + 1
+`)
+	obj.SetOutput(&out)
+	err = obj.Run()
+	if err != nil {
+		t.Errorf("Found error printing FN: %s", err.Error())
+	}
+	if out.String() != "6 9\n" {
+		t.Errorf("Unexpected output printing FN: '%s'", out.String())
+	}
+
+	for _, prg := range []string{"10 DEF FN LEN(X) = X\n",
+		"10 DEF FN A(RED) = RED\n",
+		"10 DEF FN A(X) =\n",
+		"10 DEF A(X) = X\n",
+		"10 DEF FN A X = X\n",
+		"10 LET a = FN MISSING(3)\n",
+		"10 DEF FN A(X) = X\n20 LET a = FN A 3\n",
+		"10 DEF FN A(X) = X\n20 LET a = FN A(3\n",
+		"10 DEF FN A(X) = X )\n20 LET a = FN A(3)\n",
+		"10 DEF FN F(X) = FN F(X)\n20 LET a = FN F(1)\n",
+		"10 DEF FN F(X) = FN G(X)\n20 DEF FN G(X) = FN F(X)\n30 PRINT FN F(1)\n",
+	} {
+		obj = Compile(prg)
+		err = obj.Run()
+		if err == nil {
+			t.Errorf("Expected an error running '%s'", prg)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// flowgraph.go - Static analysis of the control-flow of a program.
+
+package eval
+
+import (
+	"github.com/skx/gobasic/token"
+)
+
+// FlowEdge is a single edge in the control-flow graph of a program,
+// recording that control may pass from one line to another.
+type FlowEdge struct {
+
+	// From is the line-number control leaves.
+	From string
+
+	// To is the line-number control reaches.
+	To string
+
+	// Kind describes how control passes between the lines, and is
+	// one of:
+	//
+	//  "sequential" - Execution continues with the following line.
+	//  "goto"       - A GOTO statement.
+	//  "gosub"      - A GOSUB statement.
+	//  "return"     - A RETURN, to the line after a GOSUB.
+	//  "if-true"    - An `IF .. THEN 100` shorthand.
+	//  "if-false"   - An `IF .. ELSE 100` shorthand.
+	//  "for"        - From a FOR statement to its matching NEXT.
+	//  "next"       - From a NEXT statement back to its FOR loop.
+	Kind string
+}
+
+// FlowGraph returns the control-flow graph of our program.
+//
+// The graph is built by examining the program, rather than running
+// it, so only jumps to literal line-numbers are found; computed jumps
+// such as `GOTO X * 100` are ignored.  A RETURN is linked to the line
+// after every GOSUB, since we can't know which called it.
+func (e *Interpreter) FlowGraph() []FlowEdge {
+
+	var edges []FlowEdge
+
+	// The line-numbers of the program, in order.
+	var lines []string
+
+	// The lines which contain a GOSUB, or a RETURN.
+	var gosubs []string
+	var returns []string
+
+	// The FOR loops which are open, so that we can match them
+	// with their NEXT.
+	type loop struct {
+		id   string
+		line string
+	}
+	var loops []loop
+
+	// Does the current line fall through to the next?
+	sequential := false
+
+	// terminal returns true if the token at the given offset ends
+	// a statement.
+	terminal := func(i int) bool {
+		if i >= len(e.program) {
+			return true
+		}
+		t := e.program[i].Type
+		return t == token.NEWLINE || t == token.COLON || t == token.ELSE
+	}
+
+	// target returns the literal line-number following the token
+	// at the given offset, if there is one.
+	target := func(i int) (string, bool) {
+		if i+1 < len(e.program) && e.program[i+1].Type == token.INT && terminal(i+2) {
+			return e.program[i+1].Literal, true
+		}
+		return "", false
+	}
+
+	line := ""
+	for i, tok := range e.program {
+
+		switch tok.Type {
+		case token.LINENO:
+			if sequential {
+				edges = append(edges, FlowEdge{From: line, To: tok.Literal, Kind: "sequential"})
+			}
+			line = tok.Literal
+			lines = append(lines, line)
+
+			// Unless the line begins with an unconditional
+			// change of flow we'll continue to the next.
+			sequential = true
+			if i+1 < len(e.program) {
+				switch e.program[i+1].Type {
+				case token.END:
+					// END SELECT doesn't end the program.
+					sequential = i+2 < len(e.program) && e.program[i+2].Type == token.SELECT
+				case token.GOTO, token.RETURN:
+					sequential = false
+				}
+			}
+		case token.GOTO:
+			if to, ok := target(i); ok {
+				edges = append(edges, FlowEdge{From: line, To: to, Kind: "goto"})
+			}
+		case token.GOSUB:
+			if to, ok := target(i); ok {
+				edges = append(edges, FlowEdge{From: line, To: to, Kind: "gosub"})
+			}
+			if len(gosubs) == 0 || gosubs[len(gosubs)-1] != line {
+				gosubs = append(gosubs, line)
+			}
+		case token.RETURN:
+			if len(returns) == 0 || returns[len(returns)-1] != line {
+				returns = append(returns, line)
+			}
+		case token.THEN:
+			if to, ok := target(i); ok {
+				edges = append(edges, FlowEdge{From: line, To: to, Kind: "if-true"})
+			}
+		case token.ELSE:
+			if to, ok := target(i); ok {
+				edges = append(edges, FlowEdge{From: line, To: to, Kind: "if-false"})
+			}
+		case token.FOR:
+			if i+1 < len(e.program) && e.program[i+1].Type == token.IDENT {
+				loops = append(loops, loop{id: e.program[i+1].Literal, line: line})
+			}
+		case token.NEXT:
+			if i+1 < len(e.program) && e.program[i+1].Type == token.IDENT {
+				for j := len(loops) - 1; j >= 0; j-- {
+					if loops[j].id == e.program[i+1].Literal {
+						edges = append(edges,
+							FlowEdge{From: loops[j].line, To: line, Kind: "for"},
+							FlowEdge{From: line, To: loops[j].line, Kind: "next"})
+						loops = append(loops[:j], loops[j+1:]...)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	//
+	// Now link each RETURN to the line following every GOSUB.
+	//
+	following := make(map[string]string)
+	for i := 0; i+1 < len(lines); i++ {
+		following[lines[i]] = lines[i+1]
+	}
+	for _, r := range returns {
+		for _, g := range gosubs {
+			if to, ok := following[g]; ok {
+				edges = append(edges, FlowEdge{From: r, To: to, Kind: "return"})
+			}
+		}
+	}
+
+	return edges
+}
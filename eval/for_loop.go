@@ -22,16 +22,13 @@ type ForLoop struct {
 	offset int
 
 	// start is the initial value of the variable at the start of the loop
-	start int
+	start float64
 
 	// end is the terminating value of the variable
-	end int
+	end float64
 
 	// increment is how much to step by
-	step int
-
-	// is the loop finnished?
-	finished bool
+	step float64
 }
 
 // Loops is the structure which holds ForLoop entries
@@ -79,3 +76,11 @@ func (l *Loops) Empty() bool {
 
 	return (len(l.data) == 0)
 }
+
+// Len returns the number of open FOR loop-references.
+func (l *Loops) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return (len(l.data))
+}
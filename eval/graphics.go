@@ -0,0 +1,32 @@
+// graphics.go - Support for sending output to a graphical display.
+
+package eval
+
+// GraphicsHandler is the interface which must be implemented to
+// receive the output of a program which is running in graphics mode.
+//
+// The interpreter doesn't draw anything itself, it just passes along
+// drawing-commands, so a handler might draw upon an image, a window,
+// or a web-page canvas.
+type GraphicsHandler interface {
+
+	// Plot sets the pixel at the given position to the given colour.
+	Plot(x int, y int, colour int)
+
+	// Line draws a line between the given positions, in the given
+	// colour.
+	Line(x1 int, y1 int, x2 int, y2 int, colour int)
+
+	// Print displays the given text, which PRINT would otherwise
+	// have written to our output.
+	Print(txt string)
+}
+
+// SetGraphicsMode registers the handler which receives our output
+// while the program is in graphics mode.
+//
+// Programs enter graphics mode via the GRAPHICS statement, and leave
+// it via the TEXT statement.
+func (e *Interpreter) SetGraphicsMode(handler GraphicsHandler) {
+	e.graphics = handler
+}
@@ -0,0 +1,13 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+// inkey_bsd.go - The requests for the terminal settings used by INKEY$.
+
+package eval
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
@@ -0,0 +1,10 @@
+// inkey_linux.go - The requests for the terminal settings used by INKEY$.
+
+package eval
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
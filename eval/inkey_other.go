@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+// inkey_other.go - Poll the terminal for a keypress.
+
+package eval
+
+// pollKey returns the key which has been pressed upon the terminal
+// attached to the given file-descriptor.
+//
+// This platform isn't supported, so no key is ever pressed.
+func pollKey(fd uintptr) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// inkey_unix.go - Poll the terminal for a keypress.
+
+package eval
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termios reads, or changes, the settings of the terminal attached to
+// the given file-descriptor.
+func termios(fd uintptr, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req,
+		uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pollKey returns the key which has been pressed upon the terminal
+// attached to the given file-descriptor, or an empty string if there
+// is none, without waiting.
+//
+// The terminal is switched out of line-buffered mode while we read,
+// and restored afterwards.
+func pollKey(fd uintptr) (string, error) {
+	var old syscall.Termios
+	if err := termios(fd, ioctlGetTermios, &old); err != nil {
+		return "", err
+	}
+
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(fd, ioctlSetTermios, &raw); err != nil {
+		return "", err
+	}
+	defer termios(fd, ioctlSetTermios, &old)
+
+	buf := make([]byte, 1)
+	n, err := syscall.Read(int(fd), buf)
+	if err != nil && err != syscall.EAGAIN {
+		return "", err
+	}
+	if n <= 0 {
+		return "", nil
+	}
+	return string(rune(buf[0])), nil
+}
@@ -0,0 +1,139 @@
+// listing.go - Reconstruct the source of a program from its tokens.
+
+package eval
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/skx/gobasic/token"
+)
+
+// stringEscaper reverses the escaping the tokenizer performs upon
+// string literals.
+var stringEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\t", "\\t")
+
+// tokenSource returns the source-form of the given token.
+func tokenSource(tok token.Token) string {
+	switch tok.Type {
+	case token.NEWLINE:
+		return "\n"
+	case token.STRING:
+		return "\"" + stringEscaper.Replace(tok.Literal) + "\""
+	}
+	return tok.Literal
+}
+
+// spaced returns true if a space should separate the given tokens, when
+// reconstructing source.
+func spaced(prev token.Token, tok token.Token) bool {
+	return prev.Type != token.NEWLINE &&
+		prev.Type != token.LBRACKET &&
+		prev.Type != token.HASH &&
+		tok.Type != token.NEWLINE &&
+		tok.Type != token.COMMA &&
+		tok.Type != token.SEMICOLON &&
+		tok.Type != token.RBRACKET &&
+		!(tok.Type == token.LBRACKET && prev.Type == token.BUILTIN)
+}
+
+// listing reconstructs the source of the lines of our program with
+// line-numbers between from and to, inclusive.
+//
+// The whitespace of the original source is lost, so tokens are
+// separated by a single space, except where that would look odd.
+func (e *Interpreter) listing(from float64, to float64) string {
+
+	var out strings.Builder
+
+	// Are we within the requested range of lines?
+	include := false
+
+	// The previous token we output.
+	prev := token.Token{Type: token.NEWLINE}
+
+	for _, tok := range e.program {
+
+		if tok.Type == token.LINENO {
+			n, err := strconv.ParseFloat(tok.Literal, 64)
+			include = err == nil && n >= from && n <= to
+		}
+		if !include {
+			continue
+		}
+
+		// Skip blank lines.
+		if tok.Type == token.NEWLINE && prev.Type == token.NEWLINE {
+			continue
+		}
+
+		if spaced(prev, tok) {
+			out.WriteString(" ")
+		}
+		out.WriteString(tokenSource(tok))
+		prev = tok
+	}
+
+	return out.String()
+}
+
+// GetLineSource returns the source of the line with the given number,
+// reconstructed in the same way as `PROGRAM$`, without the trailing
+// newline.
+//
+// If there is no such line an empty string is returned.
+func (e *Interpreter) GetLineSource(n string) string {
+
+	if _, ok := e.lines[n]; !ok {
+		return ""
+	}
+
+	line, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(e.listing(line, line), "\n")
+}
+
+// Metadata returns the details recorded in the program by comments of
+// the form:
+//
+//  10 REM @author Steve
+//  20 REM @version 1.0
+//
+// The result is keyed by the name following the "@", so the example
+// would result in {"author": "Steve", "version": "1.0"}.  Each value is
+// the remainder of the comment as it was written, without the white
+// space which surrounds it.
+func (e *Interpreter) Metadata() map[string]string {
+
+	meta := make(map[string]string)
+
+	for i := 0; i+1 < len(e.program); i++ {
+		if e.program[i].Type != token.REM || e.program[i+1].Type != token.COMMENT {
+			continue
+		}
+
+		txt := e.program[i+1].Literal
+		if !strings.HasPrefix(txt, "@") {
+			continue
+		}
+
+		key, val := txt[1:], ""
+		if n := strings.IndexAny(key, " \t"); n >= 0 {
+			key, val = key[:n], strings.TrimSpace(key[n:])
+		}
+		if key == "" {
+			continue
+		}
+		meta[key] = val
+	}
+
+	return meta
+}
@@ -0,0 +1,339 @@
+// mat.go - Handles the MAT statement, which operates upon whole arrays.
+//
+// The arrays are those created by DIM, and the arithmetic requires them
+// to have two dimensions:
+//
+//    MAT READ A             MAT A = B * C
+//    MAT PRINT A            MAT A = TRN(B)
+//                           MAT A = INV(B)
+//
+// The elements of a matrix are those of the array, row by row, so that
+// `DIM A(2, 3)` has three rows and four columns.
+//
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/skx/gobasic/object"
+	"github.com/skx/gobasic/token"
+)
+
+// matrix holds the numeric elements of an array with two dimensions,
+// row by row.
+type matrix struct {
+	rows int
+	cols int
+	val  []float64
+}
+
+// at returns the element at the given row and column.
+func (m matrix) at(row int, col int) float64 {
+	return m.val[row*m.cols+col]
+}
+
+// runMAT handles the MAT statement, dispatching upon the token which
+// follows it.
+func (e *Interpreter) runMAT() error {
+
+	// Bump past the MAT token
+	e.offset++
+
+	if e.offset >= len(e.program) {
+		return fmt.Errorf("Hit end of program processing MAT")
+	}
+
+	switch tok := e.program[e.offset]; tok.Type {
+	case token.READ:
+		return e.runMATREAD()
+	case token.PRINT:
+		return e.runMATPRINT()
+	case token.IDENT:
+		return e.runMATLET()
+	default:
+		return fmt.Errorf("MAT should be followed by READ, PRINT, or an array, got %v", tok)
+	}
+}
+
+// matArrays returns the names of the comma-separated arrays which
+// follow the current token, leaving the offset after the last of them.
+func (e *Interpreter) matArrays(stmt string) ([]string, error) {
+
+	var names []string
+	for {
+		// Bump past the READ/PRINT token, or the comma.
+		e.offset++
+
+		if e.offset >= len(e.program) {
+			return nil, fmt.Errorf("Hit end of program processing %s", stmt)
+		}
+		tok := e.program[e.offset]
+		if tok.Type != token.IDENT || !e.vars.IsArray(tok.Literal) {
+			return nil, fmt.Errorf("%s: expected the name of an array, got %v", stmt, tok)
+		}
+		names = append(names, tok.Literal)
+
+		e.offset++
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.COMMA {
+			return names, nil
+		}
+	}
+}
+
+// runMATREAD fills each of the given arrays, row by row, from the
+// values recorded by DATA:
+//
+//  MAT READ A, B
+func (e *Interpreter) runMATREAD() error {
+
+	names, err := e.matArrays("MAT READ")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		for i := range e.vars.Elements(name) {
+			val, err := e.readData("MAT READ", name)
+			if err != nil {
+				return err
+			}
+			if err := e.vars.SetIndex(name, i, val); err != nil {
+				return fmt.Errorf("MAT READ: %s", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// runMATPRINT displays each of the given arrays, one row per line,
+// with the elements of each row in successive print-zones, so that
+// the columns are aligned.  An array with a single dimension is
+// displayed as one row, and the arrays are separated by a blank line.
+//
+//  MAT PRINT A, B
+func (e *Interpreter) runMATPRINT() error {
+
+	names, err := e.matArrays("MAT PRINT")
+	if err != nil {
+		return err
+	}
+
+	for n, name := range names {
+		if n > 0 {
+			e.print("\n")
+		}
+
+		elements := e.vars.Elements(name)
+		cols := e.vars.Columns(name)
+		if cols == 0 {
+			cols = len(elements)
+		}
+		for i, val := range elements {
+			if i%cols != 0 {
+				e.print(strings.Repeat(" ", printZone-e.printColumn%printZone))
+			}
+			e.printValue(val)
+			if i%cols == cols-1 {
+				e.print("\n")
+			}
+		}
+	}
+	return nil
+}
+
+// runMATLET handles the assignment of a whole array, which is replaced
+// by the result:
+//
+//  MAT A = B        copies B.
+//  MAT A = B * C    multiplies B by C.
+//  MAT A = TRN(B)   transposes B.
+//  MAT A = INV(B)   inverts B, which must be square.
+func (e *Interpreter) runMATLET() error {
+
+	target := e.program[e.offset]
+	if strings.HasSuffix(target.Literal, "$") {
+		return fmt.Errorf("MAT: %s is not a numeric array", target.Literal)
+	}
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.ASSIGN {
+		return fmt.Errorf("MAT should be : MAT %s = B * C, TRN(B), or INV(B)", target.Literal)
+	}
+	e.offset++
+
+	if e.offset >= len(e.program) || e.program[e.offset].Type != token.IDENT {
+		return fmt.Errorf("MAT should be : MAT %s = B * C, TRN(B), or INV(B)", target.Literal)
+	}
+
+	var res matrix
+	var err error
+
+	name := e.program[e.offset].Literal
+	fn := strings.ToUpper(name)
+	if (fn == "TRN" || fn == "INV") && e.offset+1 < len(e.program) &&
+		e.program[e.offset+1].Type == token.LBRACKET {
+
+		// Bump past the function, and the lbracket.
+		e.offset += 2
+
+		var m matrix
+		m, err = e.matOperand()
+		if err != nil {
+			return err
+		}
+		if e.offset >= len(e.program) || e.program[e.offset].Type != token.RBRACKET {
+			return fmt.Errorf("MAT: unclosed bracket after %s", fn)
+		}
+		e.offset++
+
+		if fn == "TRN" {
+			res = m.transpose()
+		} else {
+			res, err = m.invert()
+		}
+	} else {
+		res, err = e.matOperand()
+		if err == nil && e.offset < len(e.program) && e.program[e.offset].Type == token.ASTERISK {
+
+			// Bump past the "*"
+			e.offset++
+
+			var m matrix
+			m, err = e.matOperand()
+			if err == nil {
+				res, err = res.multiply(m)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(res.val))
+	for i, f := range res.val {
+		elements[i] = &object.NumberObject{Value: f}
+	}
+	e.vars.SetMatrix(target.Literal, res.cols, elements)
+	return nil
+}
+
+// matOperand returns the contents of the array named by the current
+// token, which must have two dimensions, and hold numbers.
+func (e *Interpreter) matOperand() (matrix, error) {
+
+	if e.offset >= len(e.program) {
+		return matrix{}, fmt.Errorf("Hit end of program processing MAT")
+	}
+	tok := e.program[e.offset]
+	if tok.Type != token.IDENT || !e.vars.IsArray(tok.Literal) {
+		return matrix{}, fmt.Errorf("MAT: expected the name of an array, got %v", tok)
+	}
+	e.offset++
+
+	cols := e.vars.Columns(tok.Literal)
+	if cols == 0 {
+		return matrix{}, fmt.Errorf("MAT: the array '%s' must have two dimensions", tok.Literal)
+	}
+
+	elements := e.vars.Elements(tok.Literal)
+	m := matrix{rows: len(elements) / cols, cols: cols, val: make([]float64, len(elements))}
+	for i, val := range elements {
+		n, ok := val.(*object.NumberObject)
+		if !ok {
+			return matrix{}, fmt.Errorf("MAT: the array '%s' must hold numbers", tok.Literal)
+		}
+		m.val[i] = n.Value
+	}
+	return m, nil
+}
+
+// multiply returns the product of the matrix with another, which must
+// have as many rows as this one has columns.
+func (m matrix) multiply(o matrix) (matrix, error) {
+
+	if m.cols != o.rows {
+		return matrix{}, fmt.Errorf("MAT: cannot multiply a %d x %d matrix by a %d x %d matrix", m.rows, m.cols, o.rows, o.cols)
+	}
+	res := matrix{rows: m.rows, cols: o.cols, val: make([]float64, m.rows*o.cols)}
+	for r := 0; r < m.rows; r++ {
+		for c := 0; c < o.cols; c++ {
+			sum := 0.0
+			for k := 0; k < m.cols; k++ {
+				sum += m.at(r, k) * o.at(k, c)
+			}
+			res.val[r*res.cols+c] = sum
+		}
+	}
+	return res, nil
+}
+
+// transpose returns the matrix with its rows and columns exchanged.
+func (m matrix) transpose() matrix {
+
+	res := matrix{rows: m.cols, cols: m.rows, val: make([]float64, len(m.val))}
+	for r := 0; r < m.rows; r++ {
+		for c := 0; c < m.cols; c++ {
+			res.val[c*res.cols+r] = m.at(r, c)
+		}
+	}
+	return res
+}
+
+// invert returns the inverse of the matrix, which must be square, and
+// not singular, found by Gauss-Jordan elimination.
+func (m matrix) invert() (matrix, error) {
+
+	if m.rows != m.cols {
+		return matrix{}, fmt.Errorf("MAT: cannot invert a %d x %d matrix, as it isn't square", m.rows, m.cols)
+	}
+	n := m.rows
+
+	// Work upon a copy, reducing it to the identity, whilst applying
+	// the same operations to the identity, which becomes the inverse.
+	a := matrix{rows: n, cols: n, val: make([]float64, len(m.val))}
+	copy(a.val, m.val)
+	res := matrix{rows: n, cols: n, val: make([]float64, len(m.val))}
+	for i := 0; i < n; i++ {
+		res.val[i*n+i] = 1
+	}
+
+	for c := 0; c < n; c++ {
+
+		// Use the row with the largest value in this column as
+		// the pivot, for accuracy.
+		pivot := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(a.at(r, c)) > math.Abs(a.at(pivot, c)) {
+				pivot = r
+			}
+		}
+		if a.at(pivot, c) == 0 {
+			return matrix{}, fmt.Errorf("MAT: cannot invert a singular matrix")
+		}
+		for k := 0; k < n; k++ {
+			a.val[c*n+k], a.val[pivot*n+k] = a.val[pivot*n+k], a.val[c*n+k]
+			res.val[c*n+k], res.val[pivot*n+k] = res.val[pivot*n+k], res.val[c*n+k]
+		}
+
+		p := a.at(c, c)
+		for k := 0; k < n; k++ {
+			a.val[c*n+k] /= p
+			res.val[c*n+k] /= p
+		}
+
+		for r := 0; r < n; r++ {
+			f := a.at(r, c)
+			if r == c || f == 0 {
+				continue
+			}
+			for k := 0; k < n; k++ {
+				a.val[r*n+k] -= f * a.at(c, k)
+				res.val[r*n+k] -= f * res.at(c, k)
+			}
+		}
+	}
+	return res, nil
+}
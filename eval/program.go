@@ -0,0 +1,120 @@
+// program.go - A parsed program, which may be shared between interpreters.
+
+package eval
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/skx/gobasic/token"
+	"github.com/skx/gobasic/tokenizer"
+)
+
+// Program holds a parsed BASIC program.
+//
+// A program is read-only once created, so a single program may be
+// run by many interpreters at once, via NewFromProgram.
+type Program struct {
+
+	// tokens holds the tokens the program consists of.
+	tokens []token.Token
+
+	// lines is a lookup table - the key is the line-number of
+	// the source program, and the value is the offset in our
+	// tokens-array that this is located at.
+	lines map[string]int
+}
+
+// newProgram stores all the tokens the given lexer produces.
+//
+// We also record the offset at which each line starts, which means
+// that the GOTO & GOSUB statements don't need to scan the program
+// from start to finish to find the destination to jump to.
+//
+// Any line-numbers which are duplicated are returned.
+func newProgram(stream *tokenizer.Tokenizer) (*Program, []string) {
+
+	p := &Program{lines: make(map[string]int)}
+
+	var dupes []string
+
+	offset := 0
+	for {
+		tok := stream.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+
+		// Did we find a line-number?
+		if tok.Type == token.LINENO {
+
+			// Save the offset in the map
+			line := tok.Literal
+
+			// Already an offset?  That means we
+			// have duplicate line-numbers
+			if _, ok := p.lines[line]; ok {
+				dupes = append(dupes, line)
+			}
+			p.lines[line] = offset
+		}
+
+		// Did we find a label?  We record the offset of its
+		// name, which is skipped when we jump to it.
+		if tok.Type == token.STRING && isLabel(p.tokens, tok.Literal) {
+			if _, ok := p.lines[tok.Literal]; ok {
+				dupes = append(dupes, tok.Literal)
+			}
+			p.lines[tok.Literal] = offset
+		}
+
+		// Regardless append the token to our array
+		p.tokens = append(p.tokens, tok)
+
+		offset++
+	}
+
+	return p, dupes
+}
+
+// CompileProgram parses the given source, returning a program which
+// may be run by many interpreters via NewFromProgram.
+func CompileProgram(src string) (*Program, error) {
+
+	p, dupes := newProgram(tokenizer.New(src))
+	if len(dupes) > 0 {
+		return nil, fmt.Errorf("Line %s is duplicated", dupes[0])
+	}
+
+	//
+	// Registering our builtins rewrites the program, to mark
+	// calls to them, so we do that once here rather than have
+	// each interpreter take a copy of the program to do so.
+	//
+	newInterpreter(p, false)
+
+	return p, nil
+}
+
+// isLabel returns true if a string with the given value, following the
+// given tokens, names a label which may be the target of a jump.
+//
+// That's the case if it follows LABEL, outside of a comment, and isn't
+// a number, which would be confused with a line-number.
+func isLabel(tokens []token.Token, name string) bool {
+
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != token.LABEL {
+		return false
+	}
+	if _, err := strconv.ParseFloat(name, 64); err == nil {
+		return false
+	}
+
+	// Comments run to the end of the line.
+	for i := len(tokens) - 1; i >= 0 && tokens[i].Type != token.NEWLINE; i-- {
+		if tokens[i].Type == token.REM {
+			return false
+		}
+	}
+	return true
+}
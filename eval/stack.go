@@ -43,6 +43,27 @@ func (s *Stack) Pop() (int, error) {
 	return res, nil
 }
 
+// Len returns the number of items on our stack.
+func (s *Stack) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.s)
+}
+
+// Peek returns the item n places from the top of our stack, without
+// removing it.  The most recently pushed item is at position 1.
+func (s *Stack) Peek(n int) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l := len(s.s)
+	if n < 1 || n > l {
+		return 0, errors.New("Invalid stack position")
+	}
+	return s.s[l-n], nil
+}
+
 // Empty returns `true` if our stack is empty.
 func (s *Stack) Empty() bool {
 
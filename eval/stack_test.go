@@ -17,6 +17,9 @@ func TestEmpty(t *testing.T) {
 	if s.Empty() {
 		t.Errorf("Despite storing a value the stack is still empty!")
 	}
+	if s.Len() != 1 {
+		t.Errorf("The stack has the wrong length!")
+	}
 }
 
 // TestEmptyPop: Test that pop'ing from an empty stack fails.
@@ -43,3 +46,32 @@ func TestPushPop(t *testing.T) {
 		t.Errorf("We retrieved a value from our stack, but it was wrong")
 	}
 }
+
+// TestPeek: Test that we can look at items without removing them.
+func TestPeek(t *testing.T) {
+	s := NewStack()
+
+	s.Push(33)
+	s.Push(44)
+
+	out, err := s.Peek(1)
+	if err != nil || out != 44 {
+		t.Errorf("Peek returned the wrong value")
+	}
+	out, err = s.Peek(2)
+	if err != nil || out != 33 {
+		t.Errorf("Peek returned the wrong value")
+	}
+	if s.Len() != 2 {
+		t.Errorf("Peek modified the stack")
+	}
+
+	_, err = s.Peek(3)
+	if err == nil {
+		t.Errorf("Expected an error peeking past the stack")
+	}
+	_, err = s.Peek(0)
+	if err == nil {
+		t.Errorf("Expected an error peeking at position zero")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+// termsize_other.go - Determine the dimensions of the terminal.
+
+package eval
+
+import "errors"
+
+// termSize returns the width and height of the terminal attached to
+// the given file-descriptor.
+//
+// This platform isn't supported, so the caller will use defaults.
+func termSize(fd uintptr) (int, int, error) {
+	return 0, 0, errors.New("terminal size unavailable")
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// termsize_unix.go - Determine the dimensions of the terminal.
+
+package eval
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termSize returns the width and height of the terminal attached to
+// the given file-descriptor.
+func termSize(fd uintptr) (int, int, error) {
+	var ws struct {
+		Row    uint16
+		Col    uint16
+		Xpixel uint16
+		Ypixel uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
@@ -5,6 +5,9 @@
 package eval
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/skx/gobasic/object"
@@ -17,11 +20,31 @@ type Variables struct {
 
 	// data stores our data
 	data map[string]object.Object
+
+	// constants records the names of read-only variables
+	constants map[string]bool
+
+	// builders holds the contents of string variables which have
+	// been appended to, which are only converted to strings when
+	// they are read.
+	builders map[string]*strings.Builder
+
+	// arrays stores the contents of arrays created by DIM.
+	arrays map[string][]object.Object
+
+	// columns records the number of columns of each array which has
+	// two dimensions, whose elements are stored row by row.
+	columns map[string]int
 }
 
 // NewVars handles a new variable-holder.
 func NewVars() *Variables {
-	return &Variables{lock: sync.Mutex{}, data: make(map[string]object.Object)}
+	return &Variables{lock: sync.Mutex{},
+		data:      make(map[string]object.Object),
+		constants: make(map[string]bool),
+		builders:  make(map[string]*strings.Builder),
+		arrays:    make(map[string][]object.Object),
+		columns:   make(map[string]int)}
 }
 
 // Set stores the given value against the specified name.
@@ -30,11 +53,292 @@ func (v *Variables) Set(name string, val object.Object) {
 	defer v.lock.Unlock()
 
 	v.data[name] = val
+	delete(v.builders, name)
 }
 
 // Get returns the value stored against the specified name.
 func (v *Variables) Get(name string) object.Object {
 	v.lock.Lock()
 	defer v.lock.Unlock()
+
+	// Has the variable been appended to?
+	if b, ok := v.builders[name]; ok {
+		v.data[name] = &object.StringObject{Value: b.String()}
+	}
 	return (v.data[name])
 }
+
+// Append adds the given text to the end of the specified string
+// variable, creating it if it doesn't exist.
+//
+// Repeated appends are cheap, as the string is only built when the
+// variable is read.
+func (v *Variables) Append(name string, txt string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	b, ok := v.builders[name]
+	if !ok {
+		b = &strings.Builder{}
+		if cur, ok := v.data[name].(*object.StringObject); ok {
+			b.WriteString(cur.Value)
+		} else {
+			v.data[name] = &object.StringObject{Value: ""}
+		}
+		v.builders[name] = b
+	}
+	b.WriteString(txt)
+}
+
+// Delete removes the specified variable.
+func (v *Variables) Delete(name string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	delete(v.data, name)
+	delete(v.builders, name)
+}
+
+// SetConstant stores the given value against the specified name, and
+// marks the variable as being read-only.
+func (v *Variables) SetConstant(name string, val object.Object) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.data[name] = val
+	v.constants[name] = true
+}
+
+// IsConstant returns true if the specified name refers to a read-only
+// variable.
+func (v *Variables) IsConstant(name string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return (v.constants[name])
+}
+
+// Count returns the number of variables which have been set, not
+// including constants.
+func (v *Variables) Count() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return (len(v.data) - len(v.constants))
+}
+
+// Names returns the sorted names of all the variables which have been
+// set, not including constants.
+func (v *Variables) Names() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	var names []string
+	for name := range v.data {
+		if !v.constants[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clear removes all variables, except for constants.
+func (v *Variables) Clear() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for name := range v.data {
+		if !v.constants[name] {
+			delete(v.data, name)
+		}
+	}
+	v.builders = make(map[string]*strings.Builder)
+}
+
+// MaxArraySize is the largest size with which an array may be created,
+// which stops a program from exhausting our memory.
+const MaxArraySize = 1000000
+
+// Dim creates an array with the given name, whose elements may be
+// indexed from zero to size inclusive, each set to the given value.
+//
+// The size must be between zero and MaxArraySize.
+func (v *Variables) Dim(name string, size int, val object.Object) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if size < 0 || size > MaxArraySize {
+		return fmt.Errorf("The size %d of the array '%s' must be between 0 and %d", size, name, MaxArraySize)
+	}
+
+	arr := make([]object.Object, size+1)
+	for i := range arr {
+		arr[i] = val
+	}
+	v.arrays[name] = arr
+	delete(v.columns, name)
+	return nil
+}
+
+// DimMatrix creates an array with two dimensions, whose rows are indexed
+// from zero to rows inclusive, and whose columns from zero to cols
+// inclusive, each element set to the given value.
+//
+// The array may have at most MaxArraySize elements.
+func (v *Variables) DimMatrix(name string, rows int, cols int, val object.Object) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if rows < 0 || cols < 0 || (rows+1)*(cols+1) > MaxArraySize+1 {
+		return fmt.Errorf("The size %d x %d of the array '%s' must be at least 0 x 0, with at most %d elements", rows, cols, name, MaxArraySize+1)
+	}
+
+	arr := make([]object.Object, (rows+1)*(cols+1))
+	for i := range arr {
+		arr[i] = val
+	}
+	v.arrays[name] = arr
+	v.columns[name] = cols + 1
+	return nil
+}
+
+// Columns returns the number of columns of the named array, or zero if
+// it doesn't have two dimensions.
+func (v *Variables) Columns(name string) int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.columns[name]
+}
+
+// Offset returns the position of the element of the named array given
+// by the indexes, of which there must be one for each of its dimensions,
+// for use with GetIndex and SetIndex.
+func (v *Variables) Offset(name string, indexes []int) (int, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	arr, ok := v.arrays[name]
+	if !ok {
+		return 0, fmt.Errorf("The array '%s' doesn't exist", name)
+	}
+	cols, ok := v.columns[name]
+	if !ok {
+		if len(indexes) != 1 {
+			return 0, fmt.Errorf("The array '%s' has a single dimension", name)
+		}
+		return indexes[0], nil
+	}
+	if len(indexes) != 2 {
+		return 0, fmt.Errorf("The array '%s' has two dimensions", name)
+	}
+	row, col := indexes[0], indexes[1]
+	if row < 0 || col < 0 || col >= cols || row*cols+col >= len(arr) {
+		return 0, fmt.Errorf("Index (%d, %d) is out of bounds for the array '%s'", row, col, name)
+	}
+	return row*cols + col, nil
+}
+
+// IsArray returns true if the specified name refers to an array.
+func (v *Variables) IsArray(name string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	_, ok := v.arrays[name]
+	return ok
+}
+
+// GetIndex returns the value stored at the given index of the named
+// array, or an error-object if there is no such element.
+func (v *Variables) GetIndex(name string, index int) object.Object {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	arr, ok := v.arrays[name]
+	if !ok {
+		return object.Error("The array '%s' doesn't exist", name)
+	}
+	if index < 0 || index >= len(arr) {
+		return object.Error("Index %d is out of bounds for the array '%s'", index, name)
+	}
+	return arr[index]
+}
+
+// SetIndex stores the value at the given index of the named array.
+func (v *Variables) SetIndex(name string, index int, val object.Object) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	arr, ok := v.arrays[name]
+	if !ok {
+		return fmt.Errorf("The array '%s' doesn't exist", name)
+	}
+	if index < 0 || index >= len(arr) {
+		return fmt.Errorf("Index %d is out of bounds for the array '%s'", index, name)
+	}
+	arr[index] = val
+	return nil
+}
+
+// Elements returns the elements of the named array, which must not be
+// modified, or nil if there is no such array.
+func (v *Variables) Elements(name string) []object.Object {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.arrays[name]
+}
+
+// Slice returns a copy of the elements of the named array from lo to
+// hi inclusive, which is empty if hi is less than lo, or an
+// error-object if those elements don't exist.
+func (v *Variables) Slice(name string, lo int, hi int) object.Object {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	arr, ok := v.arrays[name]
+	if !ok {
+		return object.Error("The array '%s' doesn't exist", name)
+	}
+	if _, ok := v.columns[name]; ok {
+		return object.Error("The array '%s' has two dimensions, so may not be sliced", name)
+	}
+	if hi < lo {
+		return &object.ArrayObject{Value: []object.Object{}}
+	}
+	if lo < 0 || hi >= len(arr) {
+		return object.Error("Range %d TO %d is out of bounds for the array '%s'", lo, hi, name)
+	}
+	out := make([]object.Object, hi-lo+1)
+	copy(out, arr[lo:hi+1])
+	return &object.ArrayObject{Value: out}
+}
+
+// SetArray stores the given elements as the named array, replacing
+// any existing array of that name.
+func (v *Variables) SetArray(name string, val []object.Object) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.arrays[name] = val
+	delete(v.columns, name)
+}
+
+// SetMatrix stores the given elements, row by row, as the named array
+// with two dimensions, and the given number of columns, replacing any
+// existing array of that name.
+func (v *Variables) SetMatrix(name string, cols int, val []object.Object) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.arrays[name] = val
+	v.columns[name] = cols
+}
+
+// ClearArrays removes all arrays.
+func (v *Variables) ClearArrays() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.arrays = make(map[string][]object.Object)
+	v.columns = make(map[string]int)
+}
@@ -53,3 +53,179 @@ func TestString(t *testing.T) {
 		t.Errorf("Our value was lost!")
 	}
 }
+
+// TestConstant: Test we can mark a variable as read-only.
+func TestConstant(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	v.Set("steve", &object.NumberObject{Value: 42})
+	v.SetConstant("RED", &object.NumberObject{Value: 1})
+
+	if v.IsConstant("steve") {
+		t.Errorf("A normal variable was a constant!")
+	}
+	if !v.IsConstant("RED") {
+		t.Errorf("A constant was not a constant!")
+	}
+
+	// And check the value is correct.
+	if v.Get("RED").(*object.NumberObject).Value != 1 {
+		t.Errorf("Our value was lost!")
+	}
+}
+
+// TestAppend: Test we can append to a string.
+func TestAppend(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	v.Set("steve$", &object.StringObject{Value: "Steve"})
+	v.Append("steve$", " ")
+	v.Append("steve$", "Kemp")
+	v.Append("new$", "Kemp")
+
+	if v.Get("steve$").(*object.StringObject).Value != "Steve Kemp" {
+		t.Errorf("Our value was lost!")
+	}
+	if v.Get("new$").(*object.StringObject).Value != "Kemp" {
+		t.Errorf("Our value was lost!")
+	}
+
+	// Setting the variable replaces the appended contents.
+	v.Set("steve$", &object.StringObject{Value: "Steve"})
+	if v.Get("steve$").(*object.StringObject).Value != "Steve" {
+		t.Errorf("Our value was not replaced!")
+	}
+}
+
+// TestNames: Test we can list the variables which have been set.
+func TestNames(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	v.Set("steve", &object.NumberObject{Value: 42})
+	v.Append("kemp$", "Kemp")
+	v.SetConstant("RED", &object.NumberObject{Value: 1})
+
+	names := v.Names()
+	if len(names) != 2 || names[0] != "kemp$" || names[1] != "steve" {
+		t.Errorf("Wrong names: %v", names)
+	}
+}
+
+// TestArrays: Test we can store/retrieve array elements.
+func TestArrays(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	err := v.Dim("a", 2, &object.NumberObject{Value: 0})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if v.Dim("b", -1, &object.NumberObject{}) == nil ||
+		v.Dim("b", MaxArraySize+1, &object.NumberObject{}) == nil {
+		t.Errorf("Expected an error creating an array with a bogus size")
+	}
+	if !v.IsArray("a") || v.IsArray("b") {
+		t.Errorf("Arrays weren't recorded correctly")
+	}
+
+	err = v.SetIndex("a", 2, &object.NumberObject{Value: 42})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if v.GetIndex("a", 2).(*object.NumberObject).Value != 42 {
+		t.Errorf("Our value was lost!")
+	}
+	if v.GetIndex("a", 0).(*object.NumberObject).Value != 0 {
+		t.Errorf("Our initial value was lost!")
+	}
+
+	if v.GetIndex("a", 3).Type() != object.ERROR ||
+		v.GetIndex("b", 0).Type() != object.ERROR {
+		t.Errorf("Expected an error reading a missing element")
+	}
+	if v.SetIndex("a", 3, &object.NumberObject{}) == nil ||
+		v.SetIndex("b", 0, &object.NumberObject{}) == nil {
+		t.Errorf("Expected an error setting a missing element")
+	}
+
+	slice := v.Slice("a", 1, 2)
+	if slice.Type() != object.ARRAY || len(slice.(*object.ArrayObject).Value) != 2 {
+		t.Errorf("Unexpected slice: %v", slice)
+	}
+	v.SetArray("c", slice.(*object.ArrayObject).Value)
+	if v.GetIndex("c", 1).(*object.NumberObject).Value != 42 {
+		t.Errorf("Our sliced value was lost!")
+	}
+	if len(v.Slice("a", 2, 1).(*object.ArrayObject).Value) != 0 {
+		t.Errorf("Expected an empty slice")
+	}
+	if v.Slice("a", 1, 3).Type() != object.ERROR ||
+		v.Slice("b", 0, 0).Type() != object.ERROR {
+		t.Errorf("Expected an error slicing missing elements")
+	}
+
+	v.ClearArrays()
+	if v.IsArray("a") {
+		t.Errorf("Arrays weren't cleared")
+	}
+}
+
+// TestMatrix: Test arrays with two dimensions.
+func TestMatrix(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	err := v.DimMatrix("m", 1, 2, &object.NumberObject{Value: 0})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if v.DimMatrix("n", 0, -1, &object.NumberObject{}) == nil ||
+		v.DimMatrix("n", 1000, 1000, &object.NumberObject{}) == nil {
+		t.Errorf("Expected an error creating an array with a bogus size")
+	}
+	if v.Columns("m") != 3 || len(v.Elements("m")) != 6 {
+		t.Errorf("Array has the wrong shape")
+	}
+
+	offset, err := v.Offset("m", []int{1, 2})
+	if err != nil || offset != 5 {
+		t.Errorf("Unexpected offset %d: %v", offset, err)
+	}
+	for _, indexes := range [][]int{{2, 0}, {0, 3}, {-1, 0}, {1}} {
+		if _, err := v.Offset("m", indexes); err == nil {
+			t.Errorf("Expected an error for the indexes %v", indexes)
+		}
+	}
+	if v.Slice("m", 0, 1).Type() != object.ERROR {
+		t.Errorf("Expected an error slicing a matrix")
+	}
+
+	v.SetArray("m", []object.Object{&object.NumberObject{}})
+	if v.Columns("m") != 0 {
+		t.Errorf("Array should have a single dimension")
+	}
+}
+
+// TestDelete: Test we can remove a variable.
+func TestDelete(t *testing.T) {
+
+	// Holder for variables
+	v := NewVars()
+
+	v.Set("steve", &object.NumberObject{Value: 42})
+	v.Append("kemp$", "Kemp")
+	v.Delete("steve")
+	v.Delete("kemp$")
+
+	if v.Get("steve") != nil || v.Get("kemp$") != nil {
+		t.Errorf("Variables weren't deleted")
+	}
+}
@@ -0,0 +1,69 @@
+// while_loop.go - Handles the state required for while-loops
+//
+// A while-loop looks like this:
+//
+//    WHILE condition
+//      ..
+//    WEND
+//
+// Loops are identified by the offset of their WHILE statement, so
+// they may be nested.
+//
+
+package eval
+
+import "sync"
+
+// WhileLoop is the structure used to record a while-loop
+type WhileLoop struct {
+	// offset of the WHILE statement, which evaluates the condition
+	condOffset int
+}
+
+// WhileLoops is the structure which holds WhileLoop entries
+type WhileLoops struct {
+	// lock ensures we're thread-safe (ha!)
+	lock sync.Mutex
+
+	// data stores our data
+	data map[int]WhileLoop
+}
+
+// NewWhileLoops creates a new while-loop holder
+func NewWhileLoops() *WhileLoops {
+	return &WhileLoops{lock: sync.Mutex{}, data: make(map[int]WhileLoop)}
+}
+
+// Add stores a reference to a while-loop in our map
+func (w *WhileLoops) Add(x WhileLoop) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.data[x.condOffset] = x
+}
+
+// Get returns a reference to the while-loop whose WHILE statement is
+// at the given offset, and whether it is open.
+func (w *WhileLoops) Get(offset int) (WhileLoop, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	x, ok := w.data[offset]
+	return x, ok
+}
+
+// Remove removes a reference to a while-loop.
+func (w *WhileLoops) Remove(offset int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.data, offset)
+}
+
+// Empty returns true if we have no open WHILE loop-references.
+func (w *WhileLoops) Empty() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return (len(w.data) == 0)
+}
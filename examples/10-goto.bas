@@ -3,7 +3,7 @@
 10 GOTO 80
 20 GOTO 70
 30 GOTO 60
-40 PRINT "Hello-GOTO!\n"
+40 PRINT "Hello-GOTO!"
 50 END
 60 GOTO 40
 70 GOTO 30
@@ -5,5 +5,5 @@
 40 GOSUB 100
 50 END
 
-100 PRINT "SUBROUTINE WAS CALLED!\n"
+100 PRINT "SUBROUTINE WAS CALLED!"
 110 RETURN
@@ -7,9 +7,9 @@
 120 FOR I=0 TO L
 130   LET A$ = MID$ A, I, 1
 140   IF A$ >= "A" AND A$ <= "Z" THEN GOSUB 8000
-150   PRINT A$
+150   PRINT A$;
 160 NEXT I
-170 PRINT "\n"
+170 PRINT
 
 
 200 LET A="steve is in upper-case, now!"
@@ -17,9 +17,9 @@
 220 FOR I=0 TO L
 230   LET A$ = MID$ A, I, 1
 240   IF A$ >= "a" AND A$ <= "z" THEN GOSUB 9000
-250   PRINT A$
+250   PRINT A$;
 260 NEXT I
-270 PRINT "\n"
+270 PRINT
 
 300 END
 
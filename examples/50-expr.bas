@@ -3,4 +3,4 @@
 30 LET a = 3
 40 LET b = 7
 50 LET c = a * 2 + b
-60 PRINT c ,"\n"
+60 PRINT c
@@ -6,10 +6,10 @@
 110 LET A = BIN 00001111
 120 LET B = BIN 11110000
 130 LET C = A OR B
-140 IF  C = BIN 11111111 THEN PRINT "OR worked\n"
+140 IF  C = BIN 11111111 THEN PRINT "OR worked"
 
 
 200 LET A = BIN 10000001
 210 LET B = BIN 10000011
 220 LET C = A AND B
-230 IF  C = 129 THEN PRINT "AND worked\n"
+230 IF  C = 129 THEN PRINT "AND worked"
@@ -5,5 +5,5 @@
 100 INPUT "Enter a string: ", a$
 110 INPUT "Enter a number: ", a
 
-200 PRINT "Your string was '" a$ "'\n"
-210 PRINT "Your number was '" a "'\n"
+200 PRINT "Your string was '" a$ "'"
+210 PRINT "Your number was '" a "'"
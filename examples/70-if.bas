@@ -4,12 +4,12 @@
 40 REM expression between THEN+ELSE, or ELSE+NEWLINE
 50 REM
 
-100 IF 1 < 10 THEN PRINT "OK1\n" : ELSE PRINT "FAIL1\n"
-110 IF 1 > 0 THEN PRINT "OK2\n" : ELSE PRINT "FAIL2\n"
+100 IF 1 < 10 THEN PRINT "OK1" : ELSE PRINT "FAIL1"
+110 IF 1 > 0 THEN PRINT "OK2" : ELSE PRINT "FAIL2"
 
 120 REM
 130 REM Prove execution keeps going.
 140 REM
 
 150 LET a = 3
-160 PRINT "A is", a, "\n"
+160 PRINT "A is "; a
@@ -1,6 +1,6 @@
 10 LET A = PI
-15 PRINT "PI\t\t", A, "\n"
+15 PRINT "PI", A
 20 LET A = A / 2
-25 PRINT "PI/2\t\t", A, "\n"
+25 PRINT "PI/2", A
 30 LET A = COS A
-35 PRINT "COS(PI/2)\t", A, "\n"
+35 PRINT "COS(PI/2)", A
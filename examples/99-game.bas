@@ -10,16 +10,16 @@
 
  10 LET b=RND 100
  20 LET count=0
- 30 PRINT "I have picked a random number, please guess it!!\n"
+ 30 PRINT "I have picked a random number, please guess it!!"
  40 INPUT "Enter your choice:", a
- 50 PRINT "\n"
- 60 IF b = a THEN GOTO 2000 ELSE PRINT "You were wrong: ":
- 70 IF a < b THEN PRINT "too low\n":
- 80 IF a > b THEN PRINT "too high\n":
+ 50 PRINT
+ 60 IF b = a THEN GOTO 2000 ELSE PRINT "You were wrong: ";
+ 70 IF a < b THEN PRINT "too low"
+ 80 IF a > b THEN PRINT "too high"
  90 LET count = count + 1
 100 GOTO 40
 
 
-2000 PRINT "You guessed my number!\n"
-2010 PRINT "You took", count, "attepts\n"
+2000 PRINT "You guessed my number!"
+2010 PRINT "You took "; count; " attepts"
 2020 END
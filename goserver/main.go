@@ -30,6 +30,10 @@ import (
 	"github.com/skx/gobasic/tokenizer"
 )
 
+// maxIterations is the number of steps a submitted script may execute,
+// so that one which loops forever doesn't tie up the server.
+const maxIterations = 10000000
+
 // img holds the canvas we draw into.
 var img *image.RGBA
 
@@ -379,6 +383,8 @@ func runScript(code string) (string, error) {
 	t := tokenizer.New(code)
 
 	e := eval.New(t)
+	e.SetSandbox(true)
+	e.SetMaxIterations(maxIterations)
 	e.RegisterBuiltin("CIRCLE", 3, circleFunction)
 	e.RegisterBuiltin("COLOR", 3, colorFunction)
 	e.RegisterBuiltin("COLOUR", 3, colorFunction)
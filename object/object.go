@@ -7,18 +7,31 @@
 // floating-point numbers.  When it comes to output our interpreter will
 // round values that are int-like to avoid showing "3.0000" when "3"
 // would be sufficient.
+//
+// Complex numbers are also available, via the COMPLEX builtin, and
+// are stored as `complex128`, and integers too large to be held exactly
+// in a `float64` may be stored as a `*big.Int`.
+//
+// Finally an array of values may be held, which is how a slice of an
+// array, such as `A(2 TO 5)`, is returned by an expression.
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+)
 
 // Type describes the type of an object.
 type Type string
 
 // These are our object-types.
 const (
-	ERROR  = "ERROR"
-	NUMBER = "NUMBER"
-	STRING = "STRING"
+	ARRAY   = "ARRAY"
+	BIGINT  = "BIGINT"
+	COMPLEX = "COMPLEX"
+	ERROR   = "ERROR"
+	NUMBER  = "NUMBER"
+	STRING  = "STRING"
 )
 
 // Object is the interface that our types must implement.
@@ -66,6 +79,57 @@ func (s *NumberObject) String() string {
 	return (fmt.Sprintf("Object{Type:number, Value:%f}", s.Value))
 }
 
+// BigIntObject holds an arbitrary-precision integer.
+type BigIntObject struct {
+
+	// Value is the value our object wraps.
+	Value *big.Int
+}
+
+// Type returns the type of this object.
+func (s *BigIntObject) Type() Type {
+	return BIGINT
+}
+
+// String returns a string representation of this object.
+func (s *BigIntObject) String() string {
+	return (fmt.Sprintf("Object{Type:bigint, Value:%s}", s.Value.String()))
+}
+
+// ComplexObject holds a complex number.
+type ComplexObject struct {
+
+	// Value is the value our object wraps.
+	Value complex128
+}
+
+// Type returns the type of this object.
+func (s *ComplexObject) Type() Type {
+	return COMPLEX
+}
+
+// String returns a string representation of this object.
+func (s *ComplexObject) String() string {
+	return (fmt.Sprintf("Object{Type:complex, Value:%v}", s.Value))
+}
+
+// ArrayObject holds the elements of an array.
+type ArrayObject struct {
+
+	// Value is the value our object wraps.
+	Value []Object
+}
+
+// Type returns the type of this object.
+func (s *ArrayObject) Type() Type {
+	return ARRAY
+}
+
+// String returns a string representation of this object.
+func (s *ArrayObject) String() string {
+	return (fmt.Sprintf("Object{Type:array, Value:%v}", s.Value))
+}
+
 // ErrorObject holds a string, which describes an error
 type ErrorObject struct {
 
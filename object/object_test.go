@@ -2,6 +2,7 @@ package object
 
 import (
 	"math"
+	"math/big"
 	"strings"
 	"testing"
 )
@@ -25,6 +26,30 @@ func TestTypes(t *testing.T) {
 		t.Errorf("Unexpected value for stringified object")
 	}
 
+	b := BigIntObject{Value: big.NewInt(42)}
+	if b.Type() != BIGINT {
+		t.Errorf("Wrong type for BigInt")
+	}
+	if !strings.Contains(b.String(), ":bigint") {
+		t.Errorf("Unexpected value for stringified object")
+	}
+
+	c := ComplexObject{Value: complex(1, 2)}
+	if c.Type() != COMPLEX {
+		t.Errorf("Wrong type for Complex")
+	}
+	if !strings.Contains(c.String(), ":complex") {
+		t.Errorf("Unexpected value for stringified object")
+	}
+
+	a := ArrayObject{Value: []Object{&n, &v}}
+	if a.Type() != ARRAY {
+		t.Errorf("Wrong type for Array")
+	}
+	if !strings.Contains(a.String(), ":array") {
+		t.Errorf("Unexpected value for stringified object")
+	}
+
 	e := ErrorObject{Value: "You fail!"}
 	if e.Type() != ERROR {
 		t.Errorf("Wrong type for Error")
@@ -31,16 +31,47 @@ const (
 	INT     = "INT"     // integer literal
 	STRING  = "STRING"  // string literal
 	BUILTIN = "BUILTIN" // builtin-function
+	COMMENT = "COMMENT" // the text following REM
 
 	// Implemented keywords.
-	END    = "END"
-	GOSUB  = "GOSUB"
-	GOTO   = "GOTO"
-	INPUT  = "INPUT"
-	LET    = "LET"
-	PRINT  = "PRINT"
-	REM    = "REM"
-	RETURN = "RETURN"
+	APPEND    = "APPEND"
+	CALL      = "CALL"
+	CASE      = "CASE"
+	CLEAR     = "CLEAR"
+	CLOSE     = "CLOSE"
+	DATA      = "DATA"
+	DEF       = "DEF"
+	DIM       = "DIM"
+	END       = "END"
+	ERROR     = "ERROR"
+	FIELD     = "FIELD"
+	FN        = "FN"
+	GET       = "GET"
+	GOSUB     = "GOSUB"
+	GOTO      = "GOTO"
+	GRAPHICS  = "GRAPHICS"
+	INPUT     = "INPUT"
+	LABEL     = "LABEL"
+	LET       = "LET"
+	MAT       = "MAT"
+	ON        = "ON"
+	OPEN      = "OPEN"
+	PRINT     = "PRINT"
+	PUT       = "PUT"
+	RANDOMIZE = "RANDOMIZE"
+	READ      = "READ"
+	REM       = "REM"
+	RESTORE   = "RESTORE"
+	RESUME    = "RESUME"
+	RETURN    = "RETURN"
+	SELECT    = "SELECT"
+	SLEEP     = "SLEEP"
+	SWAP      = "SWAP"
+	TEXT      = "TEXT"
+	TRACEOFF  = "TRACEOFF"
+	TRACEON   = "TRACEON"
+	VARLOAD   = "VARLOAD"
+	VARSAVE   = "VARSAVE"
 
 	// Did I mention that for-loops work?  :D
 	FOR  = "FOR"
@@ -48,6 +79,30 @@ const (
 	STEP = "STEP"
 	TO   = "TO"
 
+	// And while-loops.
+	WHILE = "WHILE"
+	WEND  = "WEND"
+
+	// And repeat-loops.
+	REPEAT = "REPEAT"
+	UNTIL  = "UNTIL"
+
+	// And do-loops, which may also use WHILE and UNTIL.
+	DO   = "DO"
+	EXIT = "EXIT"
+	LOOP = "LOOP"
+
+	// Modifiers of OPEN.
+	AS     = "AS"
+	OUTPUT = "OUTPUT"
+	RANDOM = "RANDOM"
+
+	// Modifier of CASE.
+	IS = "IS"
+
+	// Modifier of PRINT.
+	USING = "USING"
+
 	// And conditionals?
 	IF   = "IF"
 	THEN = "THEN"
@@ -66,9 +121,11 @@ const (
 	PLUS     = "+" // integer addition
 	SLASH    = "/" // integer division
 
-	COLON    = ":"
-	LBRACKET = "("
-	RBRACKET = ")"
+	COLON     = ":"
+	HASH      = "#"
+	SEMICOLON = ";"
+	LBRACKET  = "("
+	RBRACKET  = ")"
 
 	// Comparison functions.
 	GT         = ">"
@@ -80,23 +137,65 @@ const (
 
 // reversed keywords
 var keywords = map[string]Type{
-	"and":    AND,
-	"else":   ELSE,
-	"end":    END,
-	"for":    FOR,
-	"gosub":  GOSUB,
-	"goto":   GOTO,
-	"if":     IF,
-	"input":  INPUT,
-	"let":    LET,
-	"next":   NEXT,
-	"or":     OR,
-	"print":  PRINT,
-	"rem":    REM,
-	"return": RETURN,
-	"step":   STEP,
-	"then":   THEN,
-	"to":     TO,
+	"and":       AND,
+	"append":    APPEND,
+	"as":        AS,
+	"call":      CALL,
+	"case":      CASE,
+	"clear":     CLEAR,
+	"close":     CLOSE,
+	"data":      DATA,
+	"def":       DEF,
+	"dim":       DIM,
+	"do":        DO,
+	"else":      ELSE,
+	"end":       END,
+	"error":     ERROR,
+	"exit":      EXIT,
+	"field":     FIELD,
+	"fn":        FN,
+	"for":       FOR,
+	"get":       GET,
+	"gosub":     GOSUB,
+	"goto":      GOTO,
+	"graphics":  GRAPHICS,
+	"if":        IF,
+	"input":     INPUT,
+	"is":        IS,
+	"label":     LABEL,
+	"let":       LET,
+	"loop":      LOOP,
+	"mat":       MAT,
+	"next":      NEXT,
+	"on":        ON,
+	"open":      OPEN,
+	"or":        OR,
+	"output":    OUTPUT,
+	"print":     PRINT,
+	"put":       PUT,
+	"random":    RANDOM,
+	"randomize": RANDOMIZE,
+	"read":      READ,
+	"rem":       REM,
+	"repeat":    REPEAT,
+	"restore":   RESTORE,
+	"resume":    RESUME,
+	"return":    RETURN,
+	"select":    SELECT,
+	"sleep":     SLEEP,
+	"swap":      SWAP,
+	"step":      STEP,
+	"text":      TEXT,
+	"then":      THEN,
+	"to":        TO,
+	"traceoff":  TRACEOFF,
+	"traceon":   TRACEON,
+	"until":     UNTIL,
+	"using":     USING,
+	"varload":   VARLOAD,
+	"varsave":   VARSAVE,
+	"wend":      WEND,
+	"while":     WHILE,
 }
 
 // LookupIdentifier used to determine whether identifier is keyword nor not.
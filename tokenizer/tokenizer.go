@@ -3,6 +3,9 @@
 package tokenizer
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/skx/gobasic/token"
 )
 
@@ -60,6 +63,17 @@ func (l *Tokenizer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
 
+	//
+	// The text of a comment is kept as it was written, rather
+	// than being split into tokens.
+	//
+	if l.prevToken.Type == token.REM && l.ch != rune('\n') && l.ch != rune(0) {
+		tok.Literal = l.readComment()
+		tok.Type = token.COMMENT
+		l.prevToken = tok
+		return tok
+	}
+
 	switch l.ch {
 	case rune('='):
 		tok = newToken(token.ASSIGN, l.ch)
@@ -67,6 +81,10 @@ func (l *Tokenizer) NextToken() token.Token {
 		tok = newToken(token.COLON, l.ch)
 	case rune(','):
 		tok = newToken(token.COMMA, l.ch)
+	case rune(';'):
+		tok = newToken(token.SEMICOLON, l.ch)
+	case rune('#'):
+		tok = newToken(token.HASH, l.ch)
 	case rune('+'):
 		tok = newToken(token.PLUS, l.ch)
 	case rune('-'):
@@ -84,6 +102,18 @@ func (l *Tokenizer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.MINUS, l.ch)
 		}
+	case rune('&'):
+		// &H1F, &O17, and &B11111 are all 31.
+		if base := radix(l.peekChar()); base != 0 && isRadixDigit(l.peekAhead(2), base) {
+			// swallow the &
+			l.readChar()
+
+			tok.Literal = l.readRadix(base)
+			tok.Type = token.INT
+		} else {
+			tok.Literal = l.readIdentifier()
+			tok.Type = token.LookupIdentifier(tok.Literal)
+		}
 	case rune('/'):
 		tok = newToken(token.SLASH, l.ch)
 	case rune('%'):
@@ -158,18 +188,36 @@ func newToken(tokenType token.Type, ch rune) token.Token {
 
 // readIdentifier is designed to read an identifier (name of variable,
 // function, etc).
+//
+// Digits are permitted after the first character, so "A1" is a
+// single identifier.  However a keyword followed by a digit ends
+// there, so that "GOTO20" and "TO10" remain valid, as they are in
+// other BASICs.
 func (l *Tokenizer) readIdentifier() string {
 
 	id := ""
 
-	for isIdentifier(l.peekChar()) {
+	for isIdentifier(l.peekChar()) || isDigit(l.peekChar()) {
 		id += string(l.ch)
+		if isDigit(l.peekChar()) && token.LookupIdentifier(id) != token.IDENT {
+			return id
+		}
 		l.readChar()
 	}
 	id += string(l.ch)
 	return id
 }
 
+// readComment reads the remainder of the current line, which follows
+// REM, without any trailing white space.
+func (l *Tokenizer) readComment() string {
+	start := l.position
+	for l.ch != rune('\n') && l.ch != rune(0) {
+		l.readChar()
+	}
+	return strings.TrimRight(string(l.characters[start:l.position]), " \t\r")
+}
+
 // skip white space
 func (l *Tokenizer) skipWhitespace() {
 	for isWhitespace(l.ch) {
@@ -177,7 +225,8 @@ func (l *Tokenizer) skipWhitespace() {
 	}
 }
 
-// read a number, note that this only handles integers.
+// read a number, which may have a fractional part, and an exponent
+// such as "1.5E10", or "3.2E-4".
 func (l *Tokenizer) readNumber() string {
 	str := ""
 
@@ -185,10 +234,51 @@ func (l *Tokenizer) readNumber() string {
 		str += string(l.ch)
 		l.readChar()
 	}
+
+	//
+	// The exponent is only consumed if digits follow it, so that
+	// "1E" remains a number followed by an identifier.
+	//
+	if l.peekChar() == rune('E') || l.peekChar() == rune('e') {
+		digits := 2
+		if l.peekAhead(2) == rune('+') || l.peekAhead(2) == rune('-') {
+			digits = 3
+		}
+		if isDigit(l.peekAhead(digits)) {
+			for i := 1; i < digits; i++ {
+				str += string(l.ch)
+				l.readChar()
+			}
+			for isDigit(l.peekChar()) {
+				str += string(l.ch)
+				l.readChar()
+			}
+		}
+	}
 	str += string(l.ch)
 	return str
 }
 
+// readRadix reads the digits of a hexadecimal, octal, or binary number
+// following its prefix, returning the decimal equivalent so that the
+// evaluator sees an ordinary number.
+func (l *Tokenizer) readRadix(base int) string {
+	prefix := "&" + string(l.ch)
+	str := ""
+
+	for isRadixDigit(l.peekChar(), base) {
+		l.readChar()
+		str += string(l.ch)
+	}
+
+	val, err := strconv.ParseInt(str, base, 64)
+	if err != nil {
+		// Too large - the evaluator will report this.
+		return prefix + str
+	}
+	return strconv.FormatInt(val, 10)
+}
+
 // read a string, handling "\t", "\n", etc.
 func (l *Tokenizer) readString() string {
 	out := ""
@@ -238,9 +328,17 @@ func (l *Tokenizer) peekChar() rune {
 	return l.characters[l.readPosition]
 }
 
+// peekAhead looks at the character n places ahead of the current one.
+func (l *Tokenizer) peekAhead(n int) rune {
+	if l.position+n >= len(l.characters) {
+		return rune(0)
+	}
+	return l.characters[l.position+n]
+}
+
 // determinate ch is identifier or not
 func isIdentifier(ch rune) bool {
-	return !isDigit(ch) && !isWhitespace(ch) && !isBrace(ch) && !isOperator(ch) && !isComparison(ch) && !isCompound(ch) && !isBrace(ch) && !isParen(ch) && !isBracket(ch) && !isEmpty(ch) && (ch != rune('\n'))
+	return !isDigit(ch) && !isWhitespace(ch) && !isBrace(ch) && !isOperator(ch) && !isComparison(ch) && !isCompound(ch) && !isBrace(ch) && !isParen(ch) && !isBracket(ch) && !isEmpty(ch) && (ch != rune('\n')) && (ch != rune('#'))
 }
 
 // is white space: note that a newline is NOT considered whitespace
@@ -288,3 +386,25 @@ func isEmpty(ch rune) bool {
 func isDigit(ch rune) bool {
 	return rune('0') <= ch && ch <= rune('9')
 }
+
+// radix returns the base of a number prefixed by "&" and the given
+// character, or zero if it isn't a known prefix.
+func radix(ch rune) int {
+	switch ch {
+	case rune('H'), rune('h'):
+		return 16
+	case rune('O'), rune('o'):
+		return 8
+	case rune('B'), rune('b'):
+		return 2
+	}
+	return 0
+}
+
+// isRadixDigit returns true if ch is a digit in the given base.
+func isRadixDigit(ch rune, base int) bool {
+	if isDigit(ch) {
+		return int(ch-rune('0')) < base
+	}
+	return base == 16 && strings.ContainsRune("abcdefABCDEF", ch)
+}
@@ -39,7 +39,7 @@ func TestMathOperators(t *testing.T) {
 
 // TestMiscTokens just tests the tokens we've not otherwise covered.
 func TestMiscTokens(t *testing.T) {
-	input := `(),:`
+	input := `(),:;#`
 
 	tests := []struct {
 		expectedType    token.Type
@@ -51,6 +51,8 @@ func TestMiscTokens(t *testing.T) {
 		{token.RBRACKET, ")"},
 		{token.COMMA, ","},
 		{token.COLON, ":"},
+		{token.SEMICOLON, ";"},
+		{token.HASH, "#"},
 		{token.NEWLINE, "\\n"},
 		{token.EOF, ""},
 	}
@@ -237,3 +239,144 @@ func TestNumber(t *testing.T) {
 		}
 	}
 }
+
+// TestExponent tests numbers written in scientific notation.
+func TestExponent(t *testing.T) {
+	input := `PRINT 1E3 2.5E-1 1.5e+10 -3.2E-4 1E EE`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		// implicit newline which is a pain.
+		{token.NEWLINE, "\\n"},
+		{token.PRINT, "PRINT"},
+		{token.INT, "1E3"},
+		{token.INT, "2.5E-1"},
+		{token.INT, "1.5e+10"},
+		{token.INT, "-3.2E-4"},
+		{token.INT, "1"},
+		{token.IDENT, "E"},
+		{token.IDENT, "EE"},
+		{token.NEWLINE, "\\n"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestRadix tests hexadecimal, octal, and binary numbers, which are
+// converted to decimal.
+func TestRadix(t *testing.T) {
+	input := `PRINT &H1F &hff &O17 &B1010 &H &B2 &HFFFFFFFFFFFFFFFFFF`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		// implicit newline which is a pain.
+		{token.NEWLINE, "\\n"},
+		{token.PRINT, "PRINT"},
+		{token.INT, "31"},
+		{token.INT, "255"},
+		{token.INT, "15"},
+		{token.INT, "10"},
+		{token.IDENT, "&H"},
+		{token.IDENT, "&B2"},
+		{token.INT, "&HFFFFFFFFFFFFFFFFFF"},
+		{token.NEWLINE, "\\n"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestIdentifierDigits ensures digits may follow the first character
+// of an identifier.
+func TestIdentifierDigits(t *testing.T) {
+	input := `A1 B2$ 3C TO10 GOTO20 STEP2 TOTAL1`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		// implicit newline which is a pain.
+		{token.NEWLINE, "\\n"},
+		{token.IDENT, "A1"},
+		{token.IDENT, "B2$"},
+		{token.INT, "3"},
+		{token.IDENT, "C"},
+		{token.TO, "TO"},
+		{token.INT, "10"},
+		{token.GOTO, "GOTO"},
+		{token.INT, "20"},
+		{token.STEP, "STEP"},
+		{token.INT, "2"},
+		{token.IDENT, "TOTAL1"},
+		{token.NEWLINE, "\\n"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+// TestComment ensures the text following REM is kept as it was written.
+func TestComment(t *testing.T) {
+	input := `10 REM  @url http://example.com/x_y : "x  
+20 REM
+30 PRINT 1`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		// implicit newline which is a pain.
+		{token.NEWLINE, "\\n"},
+		{token.LINENO, "10"},
+		{token.REM, "REM"},
+		{token.COMMENT, `@url http://example.com/x_y : "x`},
+		{token.NEWLINE, "\\n"},
+		{token.LINENO, "20"},
+		{token.REM, "REM"},
+		{token.NEWLINE, "\\n"},
+		{token.LINENO, "30"},
+		{token.PRINT, "PRINT"},
+		{token.INT, "1"},
+		{token.NEWLINE, "\\n"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}